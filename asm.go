@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+// asmText matches the TEXT directive starting an assembly function,
+// capturing its symbol.
+var asmText = regexp.MustCompile(`^\s*TEXT\s+([^\s(,]+)\(SB\)`)
+
+// asmLabel matches a label at the start of a line of assembly.
+var asmLabel = regexp.MustCompile(`^\s*[A-Za-z_][A-Za-z0-9_]*:`)
+
+// asmPseudo are the directives that don't emit instructions.
+var asmPseudo = map[string]bool{"TEXT": true, "DATA": true, "GLOBL": true, "PCDATA": true, "FUNCDATA": true, "NO_LOCAL_POINTERS": true}
+
+// getAsmRanges adds to funcs the functions of package pkgpath written in
+// the assembly files paths, from their TEXT directive to their last
+// instruction. Their statement lines are the lines with instructions.
+// Functions declared in Go without a body are replaced, file-local
+// symbols are skipped.
+func getAsmRanges(paths []string, pkgpath string, funcs map[string]*Func) error {
+	for _, path := range paths {
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var fn *Func
+		inComment, inDefine := false, false
+		for i, line := range strings.Split(string(buf), "\n") {
+			line, inComment = stripAsmComments(line, inComment)
+			if strings.HasPrefix(strings.TrimSpace(line), "#") || inDefine {
+				// preprocessor directives continue on the next line if
+				// they end with a backslash
+				inDefine = strings.HasSuffix(strings.TrimSpace(line), "\\")
+				continue
+			}
+			if m := asmText.FindStringSubmatch(line); m != nil {
+				fn = nil
+				if name, ok := asmFuncName(m[1], pkgpath); ok {
+					if old := funcs[name]; old == nil || old.openLine == 0 {
+						fn = &Func{Name: name, file: path, startLine: i + 1, endLine: i + 1, sigLine: i + 1, asm: true, returnLines: map[int]bool{}, stmtLines: map[int]bool{}, stmtStarts: map[int][]int{}}
+						funcs[name] = fn
+						logger.Debug("assembly function", "name", name, "file", path, "start", i+1)
+					}
+				}
+				continue
+			}
+			if fn == nil || !isAsmInstruction(line) {
+				continue
+			}
+			fn.stmtLines[i+1] = true
+			fn.stmtStarts[i+1] = []int{len(line) - len(strings.TrimLeft(asmLabel.ReplaceAllString(line, ""), " \t")) + 1}
+			fn.endLine = i + 1
+			if fn.firstLine == 0 {
+				fn.firstLine = i + 1
+			}
+		}
+	}
+	return nil
+}
+
+// asmFuncName returns the name of the function of package pkgpath with
+// assembly symbol sym, false if it isn't a function of the package.
+func asmFuncName(sym, pkgpath string) (string, bool) {
+	if strings.Contains(sym, "<>") {
+		return "", false
+	}
+	pkg, name, ok := strings.Cut(sym, "·")
+	if !ok {
+		return "", false
+	}
+	// slashes in import paths are written as division slashes
+	pkg = strings.ReplaceAll(pkg, "∕", "/")
+	if pkg != "" && pkg != pkgpath {
+		return "", false
+	}
+	return pkgpath + "." + strings.ReplaceAll(name, "·", "."), true
+}
+
+// stripAsmComments returns line without comments, inComment is true if
+// the line starts inside a /* */ comment, and whether the next one does.
+func stripAsmComments(line string, inComment bool) (string, bool) {
+	var b strings.Builder
+	for len(line) > 0 {
+		if inComment {
+			i := strings.Index(line, "*/")
+			if i < 0 {
+				return b.String(), true
+			}
+			line, inComment = line[i+2:], false
+			continue
+		}
+		i := strings.IndexByte(line, '/')
+		if i < 0 || i+1 >= len(line) {
+			b.WriteString(line)
+			break
+		}
+		switch line[i+1] {
+		case '/':
+			b.WriteString(line[:i])
+			return b.String(), false
+		case '*':
+			b.WriteString(line[:i])
+			line, inComment = line[i+2:], true
+		default:
+			b.WriteString(line[:i+1])
+			line = line[i+1:]
+		}
+	}
+	return b.String(), inComment
+}
+
+// isAsmInstruction returns true if line, without comments, contains an
+// instruction or a macro expanding to instructions.
+func isAsmInstruction(line string) bool {
+	line = asmLabel.ReplaceAllString(line, "")
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return false
+	}
+	op := line
+	if i := strings.IndexAny(op, " \t(;"); i >= 0 {
+		op = op[:i]
+	}
+	return !asmPseudo[op]
+}
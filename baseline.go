@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// baselineEntry identifies a finding across builds, the address isn't
+// part of it since it changes with every change to the program or the
+// toolchain.
+type baselineEntry struct {
+	Rule     string `json:"rule"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Func     string `json:"func"`
+	Instance string `json:"instance,omitempty"`
+}
+
+func newBaselineEntry(f Finding) baselineEntry {
+	return baselineEntry{f.Rule, relFile(f.File), f.Line, f.Func, f.Instance}
+}
+
+// baseline is a set of known findings that should not be reported.
+type baseline struct {
+	mu    sync.Mutex
+	known map[baselineEntry]bool // true once the finding has been seen
+}
+
+func loadBaseline(path string) (*baseline, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []baselineEntry
+	if err := json.Unmarshal(buf, &entries); err != nil {
+		return nil, err
+	}
+	b := &baseline{known: make(map[baselineEntry]bool)}
+	for _, e := range entries {
+		if e.Rule == "" {
+			// baselines written before findings had rules
+			return nil, fmt.Errorf("entry for %s:%d has no rule, regenerate the baseline with -update-baseline", e.File, e.Line)
+		}
+		b.known[e] = false
+	}
+	return b, nil
+}
+
+// suppressed returns true if f is in the baseline.
+func (b *baseline) suppressed(f Finding) bool {
+	if b == nil {
+		return false
+	}
+	e := newBaselineEntry(f)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.known[e]; !ok {
+		return false
+	}
+	b.known[e] = true
+	return true
+}
+
+// missing returns the entries of the baseline that were never seen.
+func (b *baseline) missing() []baselineEntry {
+	var r []baselineEntry
+	for e, seen := range b.known {
+		if !seen {
+			r = append(r, e)
+		}
+	}
+	sortBaselineEntries(r)
+	return r
+}
+
+func writeBaseline(path string, findings []Finding) error {
+	seen := make(map[baselineEntry]bool)
+	entries := []baselineEntry{}
+	for _, f := range findings {
+		e := newBaselineEntry(f)
+		if !seen[e] {
+			seen[e] = true
+			entries = append(entries, e)
+		}
+	}
+	return writeBaselineEntries(path, entries)
+}
+
+// writeBaselineEntries writes entries to the baseline file at path.
+func writeBaselineEntries(path string, entries []baselineEntry) error {
+	sortBaselineEntries(entries)
+	buf, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(buf, '\n'), 0666)
+}
+
+func sortBaselineEntries(entries []baselineEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Func != b.Func {
+			return a.Func < b.Func
+		}
+		if a.Instance != b.Instance {
+			return a.Instance < b.Instance
+		}
+		return a.Rule < b.Rule
+	})
+}
+
+// relFile returns path relative to the current directory, so that
+// baselines can be shared between checkouts in different places.
+func relFile(path string) string {
+	if wd, err := os.Getwd(); err == nil && filepath.IsAbs(path) {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			path = rel
+		}
+	}
+	return filepath.ToSlash(path)
+}
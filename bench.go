@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// phaseStats is the time spent and the memory allocated in a phase of
+// checking the inputs, summed over all the times it ran.
+type phaseStats struct {
+	name    string
+	n       int
+	wall    time.Duration
+	bytes   uint64
+	mallocs uint64
+}
+
+var (
+	phasesMu sync.Mutex
+	phases   map[string]*phaseStats // nil unless the bench subcommand is running
+	phaseSeq []*phaseStats          // phases in the order they first ran
+)
+
+// startPhase starts measuring phase name, the returned function ends it.
+// Phases are only measured by the bench subcommand, which checks one
+// input at a time: allocations are counted for the whole program.
+func startPhase(name string) func() {
+	if phases == nil {
+		return func() {}
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	start, bytes, mallocs := time.Now(), ms.TotalAlloc, ms.Mallocs
+	return func() {
+		wall := time.Since(start)
+		runtime.ReadMemStats(&ms)
+		phasesMu.Lock()
+		defer phasesMu.Unlock()
+		p := phases[name]
+		if p == nil {
+			p = &phaseStats{name: name}
+			phases[name] = p
+			phaseSeq = append(phaseSeq, p)
+		}
+		p.n++
+		p.wall += wall
+		p.bytes += ms.TotalAlloc - bytes
+		p.mallocs += ms.Mallocs - mallocs
+	}
+}
+
+// benchMain implements the bench subcommand: it checks the inputs, or a
+// generated program, a number of times and prints the time spent and the
+// memory allocated by each phase. It returns the exit status.
+func benchMain(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	runs := fs.Int("n", 5, "number of runs")
+	nfuncs := fs.Int("funcs", 500, "number of generic functions of the generated program")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: badlngenerics [flags] bench [-n runs] [-funcs n] [inputs]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	inputs := expandArgs(fs.Args())
+	if len(inputs) == 0 {
+		dir, err := os.MkdirTemp("", "badlngenerics-bench-")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "main.go")
+		if err := os.WriteFile(path, benchProgram(*nfuncs), 0666); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		inputs = []string{path}
+	}
+
+	phases = make(map[string]*phaseStats)
+	start := time.Now()
+	for i := 0; i < *runs; i++ {
+		for _, input := range inputs {
+			out := checkInput(ctx, argInput(input), [2]string{})
+			if out.failed {
+				os.Stdout.Write(out.Bytes())
+				return exitError
+			}
+		}
+		logger.Info("bench run done", "run", i+1, "elapsed", time.Since(start))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "phase\tcalls/run\ttime/run\tMB/run\tallocs/run\t\n")
+	for _, p := range phaseSeq {
+		n := uint64(*runs)
+		fmt.Fprintf(w, "%s\t%d\t%v\t%.1f\t%d\t\n", p.name, p.n / *runs, (p.wall / time.Duration(n)).Round(time.Microsecond), float64(p.bytes/n)/(1<<20), p.mallocs/n)
+	}
+	fmt.Fprintf(w, "total\t\t%v\t\t\t\n", (time.Since(start) / time.Duration(*runs)).Round(time.Microsecond))
+	w.Flush()
+	return exitClean
+}
+
+// benchProgram returns the source of a program with nfuncs generic
+// functions, each with closures, loops and deferred calls and
+// instantiated with three types.
+func benchProgram(nfuncs int) []byte {
+	var b strings.Builder
+	b.WriteString("package main\n\nimport \"fmt\"\n\n")
+	for i := 0; i < nfuncs; i++ {
+		fmt.Fprintf(&b, `func G%d[T any](v T, n int) (r []T) {
+	defer func() {
+		if e := recover(); e != nil {
+			fmt.Println(e)
+		}
+	}()
+	f := func(x T) T {
+		return x
+	}
+	for i := 0; i < n; i++ {
+		if i%%2 == 0 {
+			r = append(r, f(v))
+		} else {
+			r = append(r, v)
+		}
+	}
+	switch len(r) {
+	case 0:
+		fmt.Println("empty")
+	default:
+		fmt.Println(len(r))
+	}
+	return r
+}
+
+`, i)
+	}
+	b.WriteString("func main() {\n")
+	for i := 0; i < nfuncs; i++ {
+		fmt.Fprintf(&b, "\tG%d(1, 2)\n\tG%d(\"a\", 2)\n\tG%d(struct{}{}, 2)\n", i, i, i)
+	}
+	b.WriteString("}\n")
+	return []byte(b.String())
+}
+
+// cpuProfile and memProfile are the files the profiles are written to,
+// set with -cpuprofile and -memprofile.
+var cpuProfile, memProfile string
+
+// startProfiles starts the CPU profile.
+func startProfiles() error {
+	if cpuProfile == "" {
+		return nil
+	}
+	f, err := os.Create(cpuProfile)
+	if err != nil {
+		return err
+	}
+	return pprof.StartCPUProfile(f)
+}
+
+// exit stops the CPU profile, writes the memory profile, removes the
+// programs read from stdin and -e and exits with status code.
+func exit(code int) {
+	if cpuProfile != "" {
+		pprof.StopCPUProfile()
+	}
+	if memProfile != "" {
+		runtime.GC()
+		f, err := os.Create(memProfile)
+		if err == nil {
+			err = pprof.WriteHeapProfile(f)
+			f.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not write memory profile: %v\n", err)
+		}
+	}
+	if snippetDir != "" {
+		os.RemoveAll(snippetDir)
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"debug/dwarf"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+type Dwarfable interface {
+	DWARF() (*dwarf.Data, error)
+	Close() error
+}
+
+// builtBinary is an executable built in a temporary directory, which is
+// removed when the executable is closed unless -keep was passed.
+type builtBinary struct {
+	Dwarfable
+	path string
+}
+
+func (b *builtBinary) Close() error {
+	err := b.Dwarfable.Close()
+	if !keep {
+		os.RemoveAll(filepath.Dir(b.path))
+	}
+	return err
+}
+
+// buildRetryDelay is the delay before the first retry of a build that
+// failed for a transient reason, it doubles with each retry.
+const buildRetryDelay = time.Second
+
+// transientBuildErrors are parts of the output of the go command when a
+// build fails for a reason that can go away by itself: downloading modules
+// and races between the go commands run in parallel on the build cache.
+var transientBuildErrors = []string{
+	"dial tcp",
+	"i/o timeout",
+	"connection reset",
+	"connection refused",
+	"TLS handshake timeout",
+	"unexpected EOF",
+	"502 Bad Gateway",
+	"503 Service Unavailable",
+	"504 Gateway Timeout",
+	"text file busy",
+	"resource temporarily unavailable",
+	"too many open files",
+}
+
+// transientBuildError returns true if out, the output of a go command that
+// failed, is the output of a transient failure.
+func transientBuildError(out string) bool {
+	for _, s := range transientBuildErrors {
+		if strings.Contains(out, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildError is returned when an input fails to build.
+type buildError struct {
+	path string
+	out  string // output of the go command
+}
+
+func (err *buildError) Error() string {
+	return fmt.Sprintf("error compiling %s: %s", err.path, err.out)
+}
+
+// build builds input in with gocmd for target, a GOOS/GOARCH pair or the
+// empty string for the host. The go command is killed if ctx is canceled.
+func build(ctx context.Context, gocmd, target string, in input) (*builtBinary, error) {
+	path := in.String()
+	dir, err := os.MkdirTemp("", "badlngenerics-")
+	if err != nil {
+		return nil, err
+	}
+	goos := runtime.GOOS
+	if v := envValue("GOOS"); v != "" {
+		goos = v
+	}
+	var env []string
+	if target != "" {
+		var goarch string
+		goos, goarch, _ = strings.Cut(target, "/")
+		env = []string{"GOOS=" + goos, "GOARCH=" + goarch}
+	}
+	tgt := filepath.Join(dir, "badlngenerics-test")
+	if goos == "windows" {
+		tgt += ".exe"
+	}
+	args := []string{"build", "-o", tgt}
+	if in.test() {
+		args = []string{"test", "-c", "-o", tgt}
+	}
+	if in.libTest != nil {
+		src := filepath.Join(dir, libTestName)
+		if err := os.WriteFile(src, in.libTest.src, 0666); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+		overlay, err := json.Marshal(map[string]any{"Replace": map[string]string{in.libTest.path: src}})
+		must(err)
+		if err := os.WriteFile(filepath.Join(dir, "overlay.json"), overlay, 0666); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+		args = append(args, "-overlay="+filepath.Join(dir, "overlay.json"))
+	}
+	switch {
+	case gcflags != "":
+		args = append(args, "-gcflags="+gcflags)
+	case inline:
+		args = append(args, "-gcflags=-N")
+	default:
+		args = append(args, "-gcflags=-N -l")
+	}
+	if ldflags != "" {
+		args = append(args, "-ldflags="+ldflags)
+	}
+	if tags != "" {
+		args = append(args, "-tags="+tags)
+	}
+	if buildmode != "" {
+		args = append(args, "-buildmode="+buildmode)
+	}
+	args = append(args, in.buildArgs()...)
+	if in.libTest != nil && in.files != nil {
+		args = append(args, in.libTest.path)
+	}
+	// the output of every attempt is kept, the failures before the last
+	// one can explain it
+	var outs []string
+	for attempt := 1; ; attempt++ {
+		var out []byte
+		out, err = goCmd(ctx, gocmd, env, args...).CombinedOutput()
+		if err == nil {
+			break
+		}
+		outs = append(outs, strings.TrimSpace(string(out)))
+		if ctx.Err() != nil || attempt > buildRetries || !transientBuildError(string(out)) {
+			break
+		}
+		delay := buildRetryDelay << (attempt - 1)
+		logger.Info("retrying build", "input", path, "attempt", attempt, "delay", delay)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("building %s: %w", path, context.Cause(ctx))
+		}
+		if len(outs) == 1 {
+			return nil, &buildError{path, outs[0]}
+		}
+		for i := range outs {
+			outs[i] = fmt.Sprintf("attempt %d of %d:\n%s", i+1, len(outs), outs[i])
+		}
+		return nil, &buildError{path, strings.Join(outs, "\n")}
+	}
+	f := openBinary(tgt)
+	if f == nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("could not open executable built from %s", path)
+	}
+	return &builtBinary{f, tgt}, nil
+}
+
+// detachedBinary is an executable whose debug info was moved to a separate
+// file.
+type detachedBinary struct {
+	Dwarfable
+	debug Dwarfable // file containing the debug info
+}
+
+func (b *detachedBinary) DWARF() (*dwarf.Data, error) {
+	return b.debug.DWARF()
+}
+
+func (b *detachedBinary) Close() error {
+	b.debug.Close()
+	return b.Dwarfable.Close()
+}
+
+// openBinary opens the executable at path, which can be either an ELF,
+// Mach-O or PE file or a WebAssembly module.
+func openBinary(path string) Dwarfable {
+	if f, _ := elf.Open(path); f != nil {
+		if !elfHasDebugInfo(f) {
+			if df := openELFDebugFile(path, f); df != nil {
+				return &detachedBinary{f, df}
+			}
+		}
+		return f
+	}
+	if f := openMachO(path); f != nil {
+		return f
+	}
+	if f, _ := pe.Open(path); f != nil {
+		return f
+	}
+	if f, _ := openWasm(path); f != nil {
+		return f
+	}
+	return nil
+}
+
+// openMachO opens the Mach-O executable at path. When the executable was
+// externally linked its debug info could have been moved by dsymutil into
+// a dSYM bundle next to it, in which case the bundle is opened instead.
+func openMachO(path string) Dwarfable {
+	f, _ := macho.Open(path)
+	if f == nil {
+		return nil
+	}
+	if f.Section("__debug_info") != nil || f.Section("__zdebug_info") != nil {
+		return f
+	}
+	dsym := filepath.Join(path+".dSYM", "Contents", "Resources", "DWARF", filepath.Base(path))
+	if df, _ := macho.Open(dsym); df != nil {
+		return &detachedBinary{f, df}
+	}
+	return f
+}
+
+// debugDirs are the directories searched for separate debug info files.
+var debugDirs = []string{"/usr/lib/debug"}
+
+// elfHasDebugInfo returns true if f contains debug info, stripped
+// executables can still have the section headers of the debug sections.
+func elfHasDebugInfo(f *elf.File) bool {
+	for _, name := range []string{".debug_info", ".zdebug_info"} {
+		if s := f.Section(name); s != nil && s.Type != elf.SHT_NOBITS {
+			return true
+		}
+	}
+	return false
+}
+
+// openELFDebugFile opens the separate debug info file of the stripped ELF
+// executable f at path, located through its build ID or its
+// .gnu_debuglink section like gdb does.
+func openELFDebugFile(path string, f *elf.File) *elf.File {
+	if s := f.Section(".note.gnu.build-id"); s != nil {
+		data, _ := s.Data()
+		b := &dbuf{data: data, order: f.ByteOrder}
+		namesz, descsz := b.u32(), b.u32()
+		b.u32() // type
+		b.bytes(int(namesz+3) &^ 3)
+		if id := b.bytes(int(descsz)); len(id) > 1 {
+			for _, dir := range debugDirs {
+				name := filepath.Join(dir, ".build-id", fmt.Sprintf("%x", id[:1]), fmt.Sprintf("%x.debug", id[1:]))
+				if df, _ := elf.Open(name); df != nil {
+					return df
+				}
+			}
+		}
+	}
+
+	s := f.Section(".gnu_debuglink")
+	if s == nil {
+		return nil
+	}
+	data, _ := s.Data()
+	i := bytes.IndexByte(data, 0)
+	if i <= 0 || len(data) < 4 {
+		return nil
+	}
+	name, crc := string(data[:i]), f.ByteOrder.Uint32(data[len(data)-4:])
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	dir := filepath.Dir(path)
+	candidates := []string{filepath.Join(dir, name), filepath.Join(dir, ".debug", name)}
+	for _, ddir := range debugDirs {
+		candidates = append(candidates, filepath.Join(ddir, dir, name))
+	}
+	for _, name := range candidates {
+		buf, err := os.ReadFile(name)
+		if err != nil || crc32.ChecksumIEEE(buf) != crc {
+			continue
+		}
+		if df, _ := elf.NewFile(bytes.NewReader(buf)); df != nil {
+			return df
+		}
+	}
+	return nil
+}
+
+// debugSection returns the uncompressed contents of the debug section
+// called name (without prefix, for example "loclists" for .debug_loclists)
+// or nil if the executable doesn't have it.
+func debugSection(f Dwarfable, name string) []byte {
+	var data []byte
+	compressed := false
+	switch f := f.(type) {
+	case *builtBinary:
+		return debugSection(f.Dwarfable, name)
+	case *detachedBinary:
+		return debugSection(f.debug, name)
+	case *splitBinary:
+		if data, ok := f.sections[name]; ok {
+			return data
+		}
+		return debugSection(f.Dwarfable, name)
+	case *elf.File:
+		// sections compressed with SHF_COMPRESSED are decompressed by Data
+		if s := f.Section(".debug_" + name); s != nil {
+			data, _ = s.Data()
+		} else if s := f.Section(".zdebug_" + name); s != nil {
+			data, _ = s.Data()
+			compressed = true
+		}
+	case *macho.File:
+		if s := f.Section("__debug_" + name); s != nil {
+			data, _ = s.Data()
+		} else if s := f.Section("__zdebug_" + name); s != nil {
+			data, _ = s.Data()
+			compressed = true
+		}
+	case *pe.File:
+		if s := f.Section(".debug_" + name); s != nil {
+			data, _ = s.Data()
+			if s.VirtualSize != 0 && s.VirtualSize < uint32(len(data)) {
+				data = data[:s.VirtualSize]
+			}
+		} else if s := f.Section(".zdebug_" + name); s != nil {
+			data, _ = s.Data()
+			compressed = true
+		}
+	case *wasmFile:
+		data = f.sections[".debug_"+name]
+	}
+	if compressed && bytes.HasPrefix(data, []byte("ZLIB")) {
+		// debug/elf already decompresses .zdebug sections
+		data = decompressZdebug(data)
+	}
+	return data
+}
+
+// decompressZdebug decompresses the contents of a .zdebug section, which
+// start with the string "ZLIB" followed by the big endian uncompressed
+// size and by the zlib stream.
+func decompressZdebug(data []byte) []byte {
+	if len(data) < 12 || string(data[:4]) != "ZLIB" {
+		return nil
+	}
+	sz := binary.BigEndian.Uint64(data[4:12])
+	// the size comes from the file, deflate can't compress more than
+	// about 1032 to 1
+	if sz > 1032*uint64(len(data)) {
+		return nil
+	}
+	rd, err := zlib.NewReader(bytes.NewReader(data[12:]))
+	if err != nil {
+		return nil
+	}
+	defer rd.Close()
+	r, err := io.ReadAll(io.LimitReader(rd, int64(sz)))
+	if err != nil || uint64(len(r)) != sz {
+		return nil
+	}
+	return r
+}
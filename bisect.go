@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/version"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// bisectMain implements the bisect subcommand: it finds the first Go
+// release, or the first commit of a checkout of the Go repository, whose
+// toolchain produces a finding for the input that the -good one doesn't
+// produce. It returns the exit status.
+func bisectMain(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("bisect", flag.ExitOnError)
+	good := fs.String("good", "", "release, or revision with -repo, without the finding")
+	bad := fs.String("bad", "", "release, gotip, or revision with -repo, with the finding")
+	rule := fs.String("rule", "", "rule ID of the finding, by default any finding that happens with -bad and not with -good")
+	repo := fs.String("repo", "", "git checkout of the Go repository, -good and -bad are revisions built with make.bash")
+	versionsFlag := fs.String("versions", "", "comma separated releases to bisect instead of the ones listed on go.dev/dl")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: badlngenerics [flags] bisect -good version -bad version [-rule id] [-repo dir] [-versions list] input\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	inputs := groupFiles(expandArgs(fs.Args()))
+	if *good == "" || *bad == "" || len(inputs) != 1 {
+		fs.Usage()
+		return exitError
+	}
+	input := inputs[0]
+
+	// the go command would switch to the toolchain required by go.mod
+	goEnv = append(goEnv, "GOTOOLCHAIN=local")
+	// findings are only collected, like with -json
+	jsonOutput = true
+
+	var steps []string
+	var setup func(step string) (string, error)
+	var err error
+	if *repo != "" {
+		var head string
+		head, err = gitOutput(*repo, "rev-parse", "HEAD")
+		if err == nil {
+			defer gitOutput(*repo, "checkout", "--quiet", head)
+			steps, err = gitRevisions(*repo, *good, *bad)
+		}
+		setup = func(rev string) (string, error) { return buildToolchain(ctx, *repo, rev) }
+	} else {
+		steps, err = releases(*good, *bad, *versionsFlag)
+		setup = func(v string) (string, error) { return setupDL(v, false) }
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if len(steps) < 2 {
+		fmt.Fprintf(os.Stderr, "nothing to bisect between %s and %s\n", *good, *bad)
+		return exitError
+	}
+
+	check := func(step string) (map[string]Finding, error) {
+		gocmd, err := setup(step)
+		if err != nil {
+			return nil, err
+		}
+		goCommand = gocmd
+		out := checkInput(ctx, input, [2]string{})
+		if out.failed {
+			return nil, fmt.Errorf("could not check %s with %s:\n%s", input, step, out.String())
+		}
+		r := make(map[string]Finding)
+		for _, f := range out.findings {
+			if *rule == "" || f.Rule == *rule {
+				r[minimizeKey(f)] = f
+			}
+		}
+		return r, nil
+	}
+
+	badFs, err := check(steps[len(steps)-1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	goodFs, err := check(steps[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	targets := make(map[string]bool)
+	for k, f := range badFs {
+		if _, ok := goodFs[k]; !ok {
+			targets[k] = true
+			fmt.Printf("only with %s: %s:%d %s %s %s\n", steps[len(steps)-1], baseName(f.File), f.Line, f.Func, f.Rule, f.Message)
+		}
+	}
+	if len(targets) == 0 {
+		fmt.Printf("no finding happens with %s and not with %s\n", steps[len(steps)-1], steps[0])
+		return exitClean
+	}
+
+	lo, hi := 0, len(steps)-1
+	for hi-lo > 1 && ctx.Err() == nil {
+		mid := (lo + hi) / 2
+		fs, err := check(steps[mid])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		found := false
+		for k := range fs {
+			found = found || targets[k]
+		}
+		if found {
+			hi = mid
+			fmt.Printf("%s: bad\n", steps[mid])
+		} else {
+			lo = mid
+			fmt.Printf("%s: good\n", steps[mid])
+		}
+	}
+	if ctx.Err() != nil {
+		return exitError
+	}
+	fmt.Printf("first bad: %s\nlast good: %s\n", steps[hi], steps[lo])
+	return exitClean
+}
+
+// releases returns the Go releases from good to bad, which can be gotip,
+// in order. If list isn't empty it is the comma separated list of releases
+// to choose from, otherwise the stable releases listed on go.dev/dl are
+// used.
+func releases(good, bad, list string) ([]string, error) {
+	for _, v := range []string{good, bad} {
+		if !version.IsValid(v) && v != "gotip" {
+			return nil, fmt.Errorf("%s is not a Go release", v)
+		}
+	}
+	var all []string
+	if list != "" {
+		all = strings.Split(list, ",")
+	} else {
+		resp, err := http.Get("https://go.dev/dl/?mode=json&include=all")
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		var rels []struct {
+			Version string
+			Stable  bool
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&rels); err != nil {
+			return nil, fmt.Errorf("listing Go releases: %v", err)
+		}
+		for _, rel := range rels {
+			if rel.Stable {
+				all = append(all, rel.Version)
+			}
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return version.Compare(all[i], all[j]) < 0 })
+
+	var r []string
+	for _, v := range all {
+		if version.Compare(v, good) >= 0 && (bad == "gotip" || version.Compare(v, bad) <= 0) {
+			r = append(r, v)
+		}
+	}
+	if bad == "gotip" {
+		r = append(r, "gotip")
+	}
+	return r, nil
+}
+
+// gitRevisions returns good followed by the commits of the first parent
+// history of the Go repository checked out in src after good, up to bad.
+func gitRevisions(src, good, bad string) ([]string, error) {
+	first, err := gitOutput(src, "rev-parse", "--short", good)
+	if err != nil {
+		return nil, err
+	}
+	out, err := gitOutput(src, "rev-list", "--first-parent", "--reverse", "--abbrev-commit", good+".."+bad)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{first}, strings.Fields(out)...), nil
+}
+
+// gitOutput runs git in dir and returns its output without the trailing
+// newline.
+func gitOutput(dir string, args ...string) (string, error) {
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// buildToolchain checks out rev in the Go repository in src, builds it and
+// returns its go command.
+func buildToolchain(ctx context.Context, src, rev string) (string, error) {
+	if _, err := gitOutput(src, "checkout", "--quiet", "--detach", rev); err != nil {
+		return "", err
+	}
+	script := "./make.bash"
+	if runtime.GOOS == "windows" {
+		script = "make.bat"
+	}
+	logger.Info("building toolchain", "rev", rev)
+	cmd := exec.CommandContext(ctx, script)
+	cmd.Dir = filepath.Join(src, "src")
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("building %s: %v", rev, err)
+	}
+	return filepath.Join(src, "bin", "go"+exeSuffix()), nil
+}
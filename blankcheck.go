@@ -0,0 +1,64 @@
+package main
+
+import (
+	"debug/dwarf"
+)
+
+// checkBlankLines checks that the line entries of each function point at
+// lines containing code, but not only the closing braces of inner blocks:
+// a debugger should never stop at a blank line or a comment. The closing
+// brace of the function itself is where its epilogue goes.
+func checkBlankLines(dw *dwarf.Data, funcRanges []FuncRange) []Finding {
+	if !blankLines {
+		return nil
+	}
+
+	var r []Finding
+
+	idx := newFuncIndex(funcRanges)
+
+	forEachFuncLineEntry(dw, funcRanges, func(lne *dwarf.LineEntry) {
+		if lne.EndSequence || (onlyStmt && !lne.IsStmt) {
+			return
+		}
+		fr := getFunc(lne.Address, idx)
+		if fr == nil {
+			return
+		}
+		fn, name := fr.Fn, fr.Name
+		if inl := fr.inlinedAt(lne.Address); inl != nil {
+			if inl.Fn == nil {
+				return
+			}
+			fn, name = inl.Fn, inl.Name
+		}
+		if fn.src == nil || fn.src.directives || !sameFile(lne.File.Name, fn.file) || !fn.contains(lne.File.Name, lne.Line) {
+			// wrong lines are reported by checkLines
+			return
+		}
+		var rule, msg string
+		switch {
+		case !fn.src.code[lne.Line]:
+			rule, msg = "LINE_WITHOUT_CODE", "line without code"
+		case fn.src.braces[lne.Line] && lne.Line != fn.endLine:
+			rule, msg = "STMT_ON_BRACE", "line with only the closing brace of a block"
+		default:
+			return
+		}
+		r = append(r, Finding{
+			Check:     "blank-line",
+			Rule:      rule,
+			File:      lne.File.Name,
+			Line:      lne.Line,
+			PC:        lne.Address,
+			Func:      fn.Name,
+			Instance:  instanceName(name, fn),
+			StartLine: fn.startLine,
+			EndLine:   fn.endLine,
+			IsStmt:    lne.IsStmt,
+			Message:   msg,
+		})
+	})
+
+	return r
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+)
+
+// checkBlocks checks that the lexical blocks of each function are nested
+// inside their parent scope, don't overlap with their siblings and are
+// declared inside the function.
+func checkBlocks(dw *dwarf.Data, funcRanges []FuncRange) []Finding {
+	var r []Finding
+	for i := range funcRanges {
+		r = append(r, checkFuncBlocks(dw, &funcRanges[i])...)
+	}
+	return r
+}
+
+func checkFuncBlocks(dw *dwarf.Data, fr *FuncRange) []Finding {
+	var r []Finding
+	finding := func(check, rule string, line int, pc uint64, format string, args ...interface{}) {
+		r = append(r, Finding{
+			Check:     check,
+			Rule:      rule,
+			File:      fr.Fn.file,
+			Line:      line,
+			PC:        pc,
+			Func:      fr.Fn.Name,
+			Instance:  instanceName(fr.Name, fr.Fn),
+			StartLine: fr.Fn.startLine,
+			EndLine:   fr.Fn.endLine,
+			Message:   fmt.Sprintf(format, args...),
+		})
+	}
+
+	// ranges of the blocks already seen, by parent scope
+	siblings := make(map[dwarf.Offset][][2]uint64)
+
+	err := walkScopes(dw, fr, func(e *dwarf.Entry, parent scope) {
+		if line, ok := e.Val(dwarf.AttrDeclLine).(int64); ok && parent.off != fr.Offset {
+			if !fr.Fn.contains("", int(line)) {
+				name, _ := entryName(dw, e)
+				finding("block-decl", "BLOCK_DECL_OUT_OF_RANGE", int(line), fr.lowpc(), "%s %s declared outside of function", e.Tag, name)
+			}
+		}
+
+		if e.Tag != dwarf.TagLexDwarfBlock {
+			return
+		}
+		rngs, err := dw.Ranges(e)
+		if err != nil {
+			finding("block-range", "BLOCK_NOT_NESTED", fr.Fn.startLine, fr.lowpc(), "lexical block at %#x: %v", e.Offset, err)
+			return
+		}
+		if line, ok := e.Val(dwarf.AttrDeclLine).(int64); ok && !fr.Fn.contains("", int(line)) {
+			finding("block-decl", "BLOCK_DECL_OUT_OF_RANGE", int(line), fr.lowpc(), "lexical block at %#x declared outside of function", e.Offset)
+		}
+		for _, rng := range rngs {
+			if !containedIn(rng, parent.rngs) {
+				finding("block-range", "BLOCK_NOT_NESTED", fr.Fn.startLine, rng[0], "lexical block range %#x-%#x outside of its parent scope", rng[0], rng[1])
+			}
+			for _, sib := range siblings[parent.off] {
+				if rng[0] < sib[1] && sib[0] < rng[1] {
+					finding("block-range", "BLOCK_NOT_NESTED", fr.Fn.startLine, rng[0], "lexical block range %#x-%#x overlaps sibling block %#x-%#x", rng[0], rng[1], sib[0], sib[1])
+				}
+			}
+		}
+		siblings[parent.off] = append(siblings[parent.off], rngs...)
+	})
+	if err != nil {
+		return append(r, funcMalformedFinding(fr, err, "reading the entries of the subprogram"))
+	}
+
+	return r
+}
+
+// containedIn returns true if rng is entirely contained in one of rngs.
+func containedIn(rng [2]uint64, rngs [][2]uint64) bool {
+	for _, r := range rngs {
+		if r[0] <= rng[0] && rng[1] <= r[1] {
+			return true
+		}
+	}
+	return false
+}
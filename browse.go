@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// if tui the findings are browsed interactively after checking all the
+// inputs instead of being printed
+var tui bool
+
+// browser is the state of the interactive browser of -tui. It has three
+// levels, the inputs, the functions with findings of an input and the
+// findings of a function, plus the finding selected in the last one.
+type browser struct {
+	in      *bufio.Scanner
+	out     io.Writer
+	inputs  []string
+	results []*output
+
+	input   int    // selected input, -1 at the first level
+	fn      string // selected function, "" at the first two levels
+	finding int    // selected finding of fn, -1 if none
+
+	triaged map[baselineEntry]bool
+}
+
+const browseHelp = `commands:
+  N        select the N-th input, function or finding of the list
+  u        go up a level
+  l        list the inputs, functions or findings again
+  n, p     select the next or the previous finding
+  s [N]    show N source lines around the selected finding, 10 by default
+  d        show the disassembly around the selected finding
+  t        mark the selected finding as triaged, adding it to the -baseline file
+  q        quit
+`
+
+// browseMain lets the user browse the results of checking inputs, reading
+// commands from in.
+func browseMain(in io.Reader, out io.Writer, inputs []string, results []*output) int {
+	b := &browser{in: bufio.NewScanner(in), out: out, inputs: inputs, results: results, input: -1, finding: -1, triaged: make(map[baselineEntry]bool)}
+	if len(inputs) == 1 {
+		b.input = 0
+	}
+	fmt.Fprint(out, "type ? for help\n")
+	b.list()
+	for {
+		fmt.Fprintf(out, "%s> ", b.location())
+		if !b.in.Scan() {
+			fmt.Fprintln(out)
+			return exitClean
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(b.in.Text()), " ")
+		if n, err := strconv.Atoi(cmd); err == nil {
+			b.selectItem(n)
+			continue
+		}
+		switch cmd {
+		case "":
+		case "?", "h", "help":
+			fmt.Fprint(out, browseHelp)
+		case "q", "quit":
+			return exitClean
+		case "u":
+			b.up()
+		case "l":
+			b.list()
+		case "n", "p":
+			b.move(cmd == "n")
+		case "s":
+			n := 10
+			if arg != "" {
+				var err error
+				if n, err = strconv.Atoi(arg); err != nil {
+					fmt.Fprintf(out, "not a number of lines: %s\n", arg)
+					continue
+				}
+			}
+			b.showSource(n)
+		case "d":
+			b.showDisasm()
+		case "t":
+			b.triage()
+		default:
+			fmt.Fprintf(out, "unknown command %q, type ? for help\n", cmd)
+		}
+	}
+}
+
+// location returns the prompt describing the selection.
+func (b *browser) location() string {
+	switch {
+	case b.input < 0:
+		return "inputs"
+	case b.fn == "":
+		return b.inputs[b.input]
+	case b.finding < 0:
+		return b.inputs[b.input] + " " + b.fn
+	}
+	return fmt.Sprintf("%s %s #%d", b.inputs[b.input], b.fn, b.finding+1)
+}
+
+// funcs returns the functions with findings of the selected input, sorted
+// by name, and the number of findings of each one.
+func (b *browser) funcs() ([]string, map[string]int) {
+	count := make(map[string]int)
+	var names []string
+	for _, f := range b.results[b.input].findings {
+		if count[f.Func] == 0 {
+			names = append(names, f.Func)
+		}
+		count[f.Func]++
+	}
+	sort.Strings(names)
+	return names, count
+}
+
+// findings returns the findings of the selected function.
+func (b *browser) findings() []Finding {
+	var r []Finding
+	for _, f := range b.results[b.input].findings {
+		if f.Func == b.fn {
+			r = append(r, f)
+		}
+	}
+	return r
+}
+
+// list prints the items of the current level.
+func (b *browser) list() {
+	switch {
+	case b.input < 0:
+		for i, input := range b.inputs {
+			out := b.results[i]
+			status := fmt.Sprintf("%d findings", len(out.findings))
+			if out.failed {
+				status = "failed"
+			}
+			fmt.Fprintf(b.out, "%4d  %s (%s)\n", i+1, input, status)
+		}
+	case b.fn == "":
+		out := b.results[b.input]
+		if out.failed {
+			fmt.Fprint(b.out, out.String())
+		}
+		names, count := b.funcs()
+		if len(names) == 0 {
+			fmt.Fprintln(b.out, "no findings")
+		}
+		for i, name := range names {
+			fmt.Fprintf(b.out, "%4d  %s (%d findings)\n", i+1, name, count[name])
+		}
+	default:
+		for i, f := range b.findings() {
+			mark := " "
+			if b.triaged[newBaselineEntry(f)] {
+				mark = "*"
+			}
+			if i == b.finding {
+				mark = ">"
+			}
+			fmt.Fprintf(b.out, "%4d %s %s\n", i+1, mark, findingText(f))
+		}
+	}
+}
+
+// selectItem selects the n-th item of the current level and goes down a
+// level, except for findings.
+func (b *browser) selectItem(n int) {
+	switch {
+	case b.input < 0:
+		if n < 1 || n > len(b.inputs) {
+			fmt.Fprintf(b.out, "no input %d\n", n)
+			return
+		}
+		b.input = n - 1
+	case b.fn == "":
+		names, _ := b.funcs()
+		if n < 1 || n > len(names) {
+			fmt.Fprintf(b.out, "no function %d\n", n)
+			return
+		}
+		b.fn = names[n-1]
+	default:
+		fs := b.findings()
+		if n < 1 || n > len(fs) {
+			fmt.Fprintf(b.out, "no finding %d\n", n)
+			return
+		}
+		b.finding = n - 1
+		b.showFinding()
+		return
+	}
+	b.list()
+}
+
+// up goes up a level.
+func (b *browser) up() {
+	switch {
+	case b.fn != "":
+		b.fn, b.finding = "", -1
+	case b.input >= 0 && len(b.inputs) > 1:
+		b.input = -1
+	default:
+		return
+	}
+	b.list()
+}
+
+// move selects the next finding of the function, or the previous one.
+func (b *browser) move(next bool) {
+	fs := b.findings()
+	if b.fn == "" || len(fs) == 0 {
+		fmt.Fprintln(b.out, "select a function first")
+		return
+	}
+	switch {
+	case next && b.finding+1 < len(fs):
+		b.finding++
+	case !next && b.finding > 0:
+		b.finding--
+	default:
+		fmt.Fprintln(b.out, "no more findings")
+		return
+	}
+	b.showFinding()
+}
+
+// selected returns the selected finding.
+func (b *browser) selected() (Finding, bool) {
+	if b.fn == "" || b.finding < 0 {
+		fmt.Fprintln(b.out, "select a finding first")
+		return Finding{}, false
+	}
+	return b.findings()[b.finding], true
+}
+
+func (b *browser) showFinding() {
+	f, ok := b.selected()
+	if !ok {
+		return
+	}
+	fmt.Fprintln(b.out, findingText(f))
+	if f.StartLine > 0 {
+		fmt.Fprintf(b.out, "\t%s, lines %d-%d\n", f.Func, f.StartLine, f.EndLine)
+	}
+}
+
+// showSource prints n source lines around the line of the selected
+// finding.
+func (b *browser) showSource(n int) {
+	f, ok := b.selected()
+	if !ok {
+		return
+	}
+	path := f.File
+	if srcDir != "" {
+		path = filepath.Join(srcDir, baseName(path))
+	}
+	lines, err := sourceLines(path)
+	if err != nil {
+		fmt.Fprintln(b.out, err)
+		return
+	}
+	if f.Line < 1 || f.Line > len(lines) {
+		fmt.Fprintf(b.out, "%s has no line %d\n", path, f.Line)
+		return
+	}
+	fmt.Fprintf(b.out, "%s\n", path)
+	for i := max(f.Line-n, 1); i <= min(f.Line+n, len(lines)); i++ {
+		mark := "  "
+		if i == f.Line {
+			mark = "=>"
+		}
+		fmt.Fprintf(b.out, "%s %4d %s\n", mark, i, lines[i-1])
+	}
+}
+
+// showDisasm prints the instructions around the selected finding.
+func (b *browser) showDisasm() {
+	f, ok := b.selected()
+	if !ok {
+		return
+	}
+	if len(f.Disasm) == 0 {
+		fmt.Fprintln(b.out, "no disassembly for this finding")
+	}
+	for _, inst := range f.Disasm {
+		fmt.Fprintf(b.out, "\t%s\n", inst)
+	}
+}
+
+// triage adds the selected finding to the baseline file.
+func (b *browser) triage() {
+	f, ok := b.selected()
+	if !ok {
+		return
+	}
+	if baselineFile == "" {
+		fmt.Fprintln(b.out, "triaging findings needs -baseline")
+		return
+	}
+	e := newBaselineEntry(f)
+	if b.triaged[e] {
+		fmt.Fprintln(b.out, "already triaged")
+		return
+	}
+	if err := addBaselineEntry(baselineFile, e); err != nil {
+		fmt.Fprintf(b.out, "could not write baseline: %v\n", err)
+		return
+	}
+	b.triaged[e] = true
+	fmt.Fprintf(b.out, "added to %s\n", baselineFile)
+}
+
+// addBaselineEntry adds e to the baseline file at path, creating it if it
+// doesn't exist.
+func addBaselineEntry(path string, e baselineEntry) error {
+	var entries []baselineEntry
+	buf, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(buf, &entries); err != nil {
+			return err
+		}
+	}
+	for _, e2 := range entries {
+		if e2 == e {
+			return nil
+		}
+	}
+	return writeBaselineEntries(path, append(entries, e))
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// if cacheDir is set the findings of each input are stored in it and
+// reused while its sources, the toolchain and the settings don't change
+var cacheDir string
+
+// cacheIgnoredFlags are the flags that don't change the findings of an
+// input. The toolchain flags are part of the identity of the toolchain.
+var cacheIgnoredFlags = map[string]bool{
+	"cache": true, "p": true, "timeout": true, "q": true, "v": true, "vv": true,
+	"json": true, "sarif": true, "format": true, "context": true, "config": true,
+	"cpuprofile": true, "memprofile": true, "db": true, "baseline": true,
+	"update-baseline": true, "strict-baseline": true, "max-findings": true,
+	"fatal-build-errors": true, "build-retries": true, "go": true, "goroot": true,
+	"gotip": true, "update-gotip": true, "tui": true,
+}
+
+// cacheEntry is a cached result.
+type cacheEntry struct {
+	Input    string    `json:"input"`
+	Findings []Finding `json:"findings"`
+}
+
+// cacheable returns true if the results of checking inputs can be cached,
+// the outputs that aren't findings are never cached.
+func cacheable() bool {
+	return cacheDir != "" && compare == "" && len(modes) == 0 && !keep && !stats && !heatmap && heatmapHTML == "" && !listInstantiations
+}
+
+// cacheKey returns the key of the findings of input in, a hash of the
+// files of its packages and of their dependencies outside of the standard
+// library, of the toolchain, of the flags and of this executable. It
+// returns "" if the key can't be computed.
+func cacheKey(ctx context.Context, in input) string {
+	if !cacheable() {
+		return ""
+	}
+	arg := in.String()
+	h := sha256.New()
+	self, err := selfHash()
+	if err != nil {
+		logger.Debug("not caching", "input", arg, "err", err)
+		return ""
+	}
+	fmt.Fprintf(h, "badlngenerics %s\n", self)
+	tc, err := toolchainID(ctx, goCommand)
+	if err != nil {
+		logger.Debug("not caching", "input", arg, "err", err)
+		return ""
+	}
+	fmt.Fprintf(h, "toolchain %s\n", tc)
+	var settings []string
+	flag.VisitAll(func(f *flag.Flag) {
+		if !cacheIgnoredFlags[f.Name] {
+			settings = append(settings, f.Name+"="+f.Value.String())
+		}
+	})
+	fmt.Fprintf(h, "flags %q\nenv %q\n", settings, goEnv)
+	if err := hashSources(ctx, h, in); err != nil {
+		logger.Debug("not caching", "input", arg, "err", err)
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashSources writes to h the files of the packages of input in and of
+// their dependencies outside of the standard library, with the go.mod
+// files of their modules.
+func hashSources(ctx context.Context, h hash.Hash, in input) error {
+	args := []string{"list", "-deps", "-json=Dir,Standard,GoFiles,CgoFiles,SFiles,CFiles,HFiles,TestGoFiles,XTestGoFiles,EmbedFiles,Module"}
+	if in.test() {
+		args = append(args, "-test")
+	}
+	if tags != "" {
+		args = append(args, "-tags="+tags)
+	}
+	out, err := goCmd(ctx, goCommand, nil, append(args, in.buildArgs()...)...).Output()
+	if err != nil {
+		return fmt.Errorf("listing dependencies of %s: %v", in, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var pkg struct {
+			Dir                               string
+			Standard                          bool
+			GoFiles, CgoFiles, SFiles, CFiles []string
+			HFiles, TestGoFiles, XTestGoFiles []string
+			EmbedFiles                        []string
+			Module                            *struct{ GoMod string }
+		}
+		if err := dec.Decode(&pkg); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if pkg.Standard {
+			continue
+		}
+		var files []string
+		for _, names := range [][]string{pkg.GoFiles, pkg.CgoFiles, pkg.SFiles, pkg.CFiles, pkg.HFiles, pkg.TestGoFiles, pkg.XTestGoFiles, pkg.EmbedFiles} {
+			for _, name := range names {
+				if filepath.IsAbs(name) {
+					// generated by the go command, like the main
+					// package of tests, from the other files
+					continue
+				}
+				files = append(files, filepath.Join(pkg.Dir, name))
+			}
+		}
+		if pkg.Module != nil && pkg.Module.GoMod != "" {
+			// the go version of the module changes the semantics of the
+			// program
+			files = append(files, pkg.Module.GoMod)
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			buf, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "file %s %d\n", file, len(buf))
+			h.Write(buf)
+		}
+	}
+	return nil
+}
+
+// selfHash returns the hash of this executable, new versions can find
+// different problems.
+var selfHash = sync.OnceValues(func() (string, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return hashFile(path)
+})
+
+var toolchainIDs sync.Map // go command -> *toolchainIDResult
+
+type toolchainIDResult struct {
+	once sync.Once
+	id   string
+	err  error
+}
+
+// toolchainID returns a hash of the environment of the go command gocmd and
+// of its compiler and linker, which changes with every patch to the
+// toolchain even if its version doesn't.
+func toolchainID(ctx context.Context, gocmd string) (string, error) {
+	v, _ := toolchainIDs.LoadOrStore(gocmd, &toolchainIDResult{})
+	r := v.(*toolchainIDResult)
+	r.once.Do(func() {
+		h := sha256.New()
+		env, err := goCmd(ctx, gocmd, nil, "env").Output()
+		if err != nil {
+			r.err = fmt.Errorf("%s env: %v", gocmd, err)
+			return
+		}
+		for _, line := range strings.Split(string(env), "\n") {
+			// GOGCCFLAGS contains a different temporary directory every
+			// time
+			if !strings.Contains(line, "GOGCCFLAGS=") {
+				fmt.Fprintln(h, line)
+			}
+		}
+		for _, tool := range []string{"compile", "link"} {
+			out, err := goCmd(ctx, gocmd, nil, "tool", "-n", tool).Output()
+			if err != nil {
+				r.err = fmt.Errorf("%s tool -n %s: %v", gocmd, tool, err)
+				return
+			}
+			sum, err := hashFile(strings.TrimSpace(string(out)))
+			if err != nil {
+				r.err = err
+				return
+			}
+			fmt.Fprintf(h, "%s %s\n", tool, sum)
+		}
+		r.id = hex.EncodeToString(h.Sum(nil))
+	})
+	return r.id, r.err
+}
+
+// hashFile returns the hash of the contents of the file at path.
+func hashFile(path string) (string, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, fh); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readCache returns the findings cached with key.
+func readCache(key string) ([]Finding, bool) {
+	buf, err := os.ReadFile(filepath.Join(cacheDir, key+".json"))
+	if err != nil {
+		return nil, false
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(buf, &e); err != nil {
+		return nil, false
+	}
+	return e.Findings, true
+}
+
+// writeCache stores the findings fs of input arg with key.
+func writeCache(key, arg string, fs []Finding) {
+	if err := os.MkdirAll(cacheDir, 0777); err != nil {
+		logger.Debug("could not write cache", "err", err)
+		return
+	}
+	buf, err := json.Marshal(cacheEntry{arg, fs})
+	must(err)
+	// renamed into place so that concurrent runs never read a partial
+	// entry
+	tmp, err := os.CreateTemp(cacheDir, "tmp-")
+	if err != nil {
+		logger.Debug("could not write cache", "err", err)
+		return
+	}
+	_, err = tmp.Write(buf)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(cacheDir, key+".json"))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		logger.Debug("could not write cache", "err", err)
+	}
+}
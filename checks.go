@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"debug/dwarf"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Check is a check of the debug info of the functions of a package.
+// Checks are registered with registerCheck and can be selected with
+// -checks.
+type Check interface {
+	// Name is the name used to select the check with -checks.
+	Name() string
+	Run(ctx context.Context, bin *Binary, src *SourceInfo) []Finding
+}
+
+// Binary is the executable being checked.
+type Binary struct {
+	DW         *dwarf.Data
+	File       Dwarfable
+	Path       string      // path of the executable
+	FuncRanges []FuncRange // address ranges of the checked functions
+}
+
+// SourceInfo is the source of the package being checked.
+type SourceInfo struct {
+	Pkgpath string
+	Funcs   map[string]*Func
+}
+
+// checkFunc adapts a function to the Check interface.
+type checkFunc struct {
+	name string
+	run  func(bin *Binary, src *SourceInfo) []Finding
+}
+
+func (c checkFunc) Name() string { return c.name }
+
+func (c checkFunc) Run(ctx context.Context, bin *Binary, src *SourceInfo) []Finding {
+	return c.run(bin, src)
+}
+
+// registeredChecks are run in the order they are registered.
+var registeredChecks []Check
+
+// registerCheck adds c to the checks run on every executable.
+func registerCheck(c Check) {
+	for _, c2 := range registeredChecks {
+		if c2.Name() == c.Name() {
+			panic(fmt.Sprintf("check %s registered twice", c.Name()))
+		}
+	}
+	registeredChecks = append(registeredChecks, c)
+}
+
+func init() {
+	for _, c := range []checkFunc{
+		{"range", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkLines(bin.DW, src.Funcs, bin.FuncRanges)
+		}},
+		{"line-directive", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkLineDirectives(bin.DW, bin.FuncRanges)
+		}},
+		{"line-sequence", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkSequences(bin.DW, bin.FuncRanges)
+		}},
+		{"decl", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkDecls(bin.DW, bin.FuncRanges)
+		}},
+		{"param", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkParams(bin.DW, bin.FuncRanges)
+		}},
+		{"prologue", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkPrologues(bin.DW, bin.FuncRanges)
+		}},
+		{"pre-prologue", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkPrePrologue(bin.DW, bin.FuncRanges)
+		}},
+		{"stmt-coverage", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkStmtCoverage(bin.DW, bin.FuncRanges)
+		}},
+		{"stmt-boundary", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkStmtBoundaries(bin.DW, bin.FuncRanges)
+		}},
+		{"line-pc", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkLinePCs(bin.DW, bin.FuncRanges)
+		}},
+		{"column", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkColumns(bin.DW, bin.FuncRanges)
+		}},
+		{"line-density", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkDensity(bin.DW, bin.FuncRanges)
+		}},
+		{"blank-line", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkBlankLines(bin.DW, bin.FuncRanges)
+		}},
+		{"range-func", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkRangeFuncs(bin.DW, bin.FuncRanges)
+		}},
+		{"loc", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkVariables(bin.DW, bin.File, bin.FuncRanges)
+		}},
+		{"loc-stmt", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkStmtLocations(bin.DW, bin.File, bin.FuncRanges)
+		}},
+		{"type-die", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkTypes(bin.DW, bin.FuncRanges)
+		}},
+		{"block", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkBlocks(bin.DW, bin.FuncRanges)
+		}},
+		{"abstract-origin", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkAbstractOrigins(bin.DW, bin.FuncRanges)
+		}},
+		{"subprogram-range", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkSubprogramRanges(bin.DW, bin.File, src.Funcs)
+		}},
+		{"orphan-line", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkOrphanLines(bin.DW, bin.File)
+		}},
+		{"missing-func", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkMissingFuncs(bin.File, bin.FuncRanges, src.Funcs)
+		}},
+		{"pclntab", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkPclntab(bin.DW, bin.File, bin.FuncRanges)
+		}},
+		{"symtab", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkSymbols(bin.File, bin.FuncRanges)
+		}},
+		{"cfi", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkFrames(bin.DW, bin.File, bin.FuncRanges)
+		}},
+		{"wrapper", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkWrappers(bin.DW, src.Pkgpath, src.Funcs)
+		}},
+		{"go-defer-wrapper", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkGoDeferWrappers(bin.DW, src.Pkgpath, src.Funcs)
+		}},
+		{"file-table", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkFileTable(bin.DW, bin.File, src.Pkgpath)
+		}},
+		{"compile-unit", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkCompileUnit(bin.DW, src.Pkgpath, bin.FuncRanges)
+		}},
+		{"inline-call", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkInlinedCalls(bin.FuncRanges)
+		}},
+		{"line-header", func(bin *Binary, src *SourceInfo) []Finding {
+			return checkLineHeader(bin.DW, bin.File, src.Pkgpath)
+		}},
+	} {
+		registerCheck(c)
+	}
+}
+
+// enabledChecks are the names of the checks selected with -checks, nil
+// if all checks are enabled.
+var enabledChecks map[string]bool
+
+// parseChecks parses the argument of -checks, a comma separated list of
+// check names.
+func parseChecks(s string) (map[string]bool, error) {
+	r := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		found := false
+		for _, c := range registeredChecks {
+			if c.Name() == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown check %q, known checks: %s", name, strings.Join(checkNames(), ","))
+		}
+		r[name] = true
+	}
+	return r, nil
+}
+
+// checkNames returns the sorted names of the registered checks.
+func checkNames() []string {
+	r := make([]string, 0, len(registeredChecks))
+	for _, c := range registeredChecks {
+		r = append(r, c.Name())
+	}
+	sort.Strings(r)
+	return r
+}
+
+// checkedFunc returns true if the function called name is selected by
+// -func and -exclude-func.
+func checkedFunc(name string) bool {
+	return (funcFilter == nil || funcFilter.MatchString(name)) && (excludeFunc == nil || !excludeFunc.MatchString(name))
+}
+
+// filterFuncRanges returns the ranges of the functions in funcRanges
+// selected by -func and -exclude-func.
+func filterFuncRanges(funcRanges []FuncRange) []FuncRange {
+	if funcFilter == nil && excludeFunc == nil {
+		return funcRanges
+	}
+	r := []FuncRange{}
+	for _, fr := range funcRanges {
+		if checkedFunc(fr.Fn.Name) {
+			r = append(r, fr)
+		}
+	}
+	return r
+}
+
+// runChecks returns the problems found with the debug info of file, the
+// executable at path built for target, for the functions in funcs, which
+// belong to package pkgpath. If ctx is canceled the findings of the checks
+// already run are returned with the cause. Also added to out are:
+//   - with -stats, the statistics of the functions
+//   - with -heatmap or -heatmap-html, their heatmaps
+//   - with -list-instantiations, the instantiations of the generic
+//     functions, and nothing is checked
+//   - with ndjson, the findings of each check as it returns them
+func runChecks(ctx context.Context, out *output, dw *dwarf.Data, file Dwarfable, path, pkgpath, target string, funcs map[string]*Func) (fs []Finding, err error) {
+	defer func() {
+		if err != nil && ctx.Err() == nil {
+			err = fmt.Errorf("could not read the debug info of %s: %v", path, err)
+		}
+	}()
+	defer recoverMalformed(&err)
+
+	endDWARF := startPhase("dwarf")
+	renamePkgClosures(dw, pkgpath, funcs)
+	funcRanges, malformed := getPCRanges(dw, funcs)
+	bin := &Binary{DW: dw, File: file, Path: path, FuncRanges: filterFuncRanges(funcRanges)}
+	endDWARF()
+	if stats {
+		out.stats = append(out.stats, lineStats(dw, bin.FuncRanges)...)
+		out.versions = append(out.versions, dwarfVersions(dw, file)...)
+	}
+	if heatmap || heatmapHTML != "" {
+		out.heatmaps = append(out.heatmaps, lineHeatmaps(dw, bin.FuncRanges)...)
+	}
+	if listInstantiations {
+		out.instantiations = append(out.instantiations, collectInstantiations(dw, bin.FuncRanges)...)
+		return nil, nil
+	}
+	src := &SourceInfo{Pkgpath: pkgpath, Funcs: funcs}
+	// the findings of each check are complete when it returns, with
+	// ndjson they are printed right away
+	found := func(batch []Finding) {
+		var r []Finding
+		for _, f := range batch {
+			setSeverity(&f)
+			if (f.Check == "dwarf-malformed" || checkedFunc(f.Func)) && f.Severity >= minSeverity {
+				f.Target = target
+				r = append(r, f)
+			}
+		}
+		r = groupFindings(r)
+		if disasm {
+			if err := disassembleFindings(ctx, path, dw, bin.FuncRanges, r); err != nil {
+				fmt.Fprintln(out, err)
+			}
+		}
+		out.stream(r)
+		fs = append(fs, r...)
+	}
+	found(malformed)
+	units := compileUnits(dw)
+	for _, c := range registeredChecks {
+		if ctx.Err() != nil {
+			return fs, context.Cause(ctx)
+		}
+		if enabledChecks == nil || enabledChecks[c.Name()] {
+			n := len(fs)
+			endCheck := startPhase("check " + c.Name())
+			found(runCheck(ctx, c, bin, src, units))
+			endCheck()
+			logger.Debug("ran check", "check", c.Name(), "executable", path, "findings", len(fs)-n)
+		}
+	}
+	return fs, nil
+}
+
+// runCheck runs c, if the debug info can't be read the findings of c are
+// replaced by one reporting the error.
+func runCheck(ctx context.Context, c Check, bin *Binary, src *SourceInfo, units []dwarfUnit) (fs []Finding) {
+	var err error
+	defer func() {
+		if err != nil {
+			fs = []Finding{malformedFinding(units, err, "check %s stopped", c.Name())}
+		}
+	}()
+	defer recoverMalformed(&err)
+	return c.Run(ctx, bin, src)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// sourceFile describes a parsed source file for the column and blank
+// line checks.
+type sourceFile struct {
+	tf         *token.File
+	starts     map[int]bool // offsets where a node of the AST starts
+	code       map[int]bool // lines where a node of the AST starts or ends
+	braces     map[int]bool // lines containing only closing braces of blocks
+	directives bool         // the file contains //line directives
+}
+
+func newSourceFile(fset *token.FileSet, file *ast.File) *sourceFile {
+	src := &sourceFile{tf: fset.File(file.Pos()), starts: make(map[int]bool), code: make(map[int]bool), braces: make(map[int]bool)}
+	rbraces := make(map[token.Pos]bool)
+	ends := make(map[int][]token.Pos)
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case nil, *ast.Comment, *ast.CommentGroup:
+			return false
+		case *ast.BlockStmt:
+			rbraces[n.Rbrace] = true
+		}
+		src.starts[src.tf.Offset(n.Pos())] = true
+		src.code[src.tf.Line(n.Pos())] = true
+		end := src.tf.Line(n.End() - 1)
+		src.code[end] = true
+		ends[end] = append(ends[end], n.End()-1)
+		return true
+	})
+	starts := make(map[int]bool)
+	for off := range src.starts {
+		starts[src.tf.Line(src.tf.Pos(off))] = true
+	}
+	for line, ps := range ends {
+		if starts[line] {
+			continue
+		}
+		src.braces[line] = true
+		for _, p := range ps {
+			if !rbraces[p] {
+				src.braces[line] = false
+			}
+		}
+	}
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			if strings.HasPrefix(c.Text, "//line ") || strings.HasPrefix(c.Text, "/*line ") {
+				src.directives = true
+			}
+		}
+	}
+	return src
+}
+
+// lineLen returns the length in bytes of line, without the newline.
+func (src *sourceFile) lineLen(line int) int {
+	lines := src.tf.Lines()
+	end := src.tf.Size()
+	if line < len(lines) {
+		end = lines[line] - 1
+	}
+	return end - lines[line-1]
+}
+
+// checkColumns checks that the non-zero columns of the line entries of
+// each function are inside their line and, for is_stmt entries, that they
+// point at the start of a node of the AST.
+func checkColumns(dw *dwarf.Data, funcRanges []FuncRange) []Finding {
+	if !columns {
+		return nil
+	}
+
+	var r []Finding
+
+	idx := newFuncIndex(funcRanges)
+
+	forEachFuncLineEntry(dw, funcRanges, func(lne *dwarf.LineEntry) {
+		if lne.EndSequence || lne.Column == 0 {
+			return
+		}
+		fr := getFunc(lne.Address, idx)
+		if fr == nil {
+			return
+		}
+		fn, name := fr.Fn, fr.Name
+		if inl := fr.inlinedAt(lne.Address); inl != nil {
+			if inl.Fn == nil {
+				return
+			}
+			fn, name = inl.Fn, inl.Name
+		}
+		if fn.src == nil || fn.src.directives || !sameFile(lne.File.Name, fn.file) || lne.Line < 1 || lne.Line > fn.src.tf.LineCount() {
+			// wrong lines are reported by checkLines
+			return
+		}
+		var rule, msg string
+		switch n := fn.src.lineLen(lne.Line); {
+		case lne.Column > n:
+			rule, msg = "COLUMN_OUT_OF_RANGE", fmt.Sprintf("column %d past the end of the line (%d bytes)", lne.Column, n)
+		case lne.IsStmt && !fn.src.starts[fn.src.tf.Offset(fn.src.tf.LineStart(lne.Line))+lne.Column-1]:
+			rule, msg = "COLUMN_NOT_AT_STMT", fmt.Sprintf("column %d is not the start of a statement or expression", lne.Column)
+		default:
+			return
+		}
+		r = append(r, Finding{
+			Check:     "column",
+			Rule:      rule,
+			File:      lne.File.Name,
+			Line:      lne.Line,
+			PC:        lne.Address,
+			Func:      fn.Name,
+			Instance:  instanceName(name, fn),
+			StartLine: fn.startLine,
+			EndLine:   fn.endLine,
+			IsStmt:    lne.IsStmt,
+			Message:   msg,
+		})
+	})
+
+	return r
+}
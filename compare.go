@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// compareToolchains builds in with both go commands in gocmds and reports
+// the findings that only happen with one of them.
+func compareToolchains(ctx context.Context, out *output, gocmds [2]string, in input, pkgpath string, funcs map[string]*Func) {
+	var fs [2][]Finding
+	for i := range gocmds {
+		var err error
+		fs[i], err = check(ctx, out, gocmds[i], "", in, pkgpath, funcs)
+		if err != nil {
+			out.error(err)
+			return
+		}
+	}
+
+	// addresses change between toolchains, findings are matched using the
+	// function, its instantiation, the source line and the rule.
+	key := func(f Finding) string {
+		return fmt.Sprintf("%s %s %s:%d %s", f.Func, f.Instance, f.File, f.Line, f.Rule)
+	}
+
+	for i := range fs {
+		other := make(map[string]bool)
+		for _, f := range fs[1-i] {
+			other[key(f)] = true
+		}
+		for _, f := range fs[i] {
+			if !other[key(f)] {
+				f.Toolchain = gocmds[i]
+				out.report(f)
+			}
+		}
+	}
+}
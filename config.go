@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// configName is the name of the configuration file looked for in the
+// directory of the first input and its parents.
+const configName = "badlngenerics.toml"
+
+// config is a configuration file, a subset of TOML where every top level
+// key is the name of a flag and its value is used when the flag isn't set
+// on the command line:
+//
+//	stmt-boundaries = true
+//	checks = ["stmt-coverage", "range"]
+//	goroot = "../go"
+//	exclude-rules = ["IS_STMT_NOT_AT_STMT"]
+//
+//	[dir."testdata/old"]
+//	severity = "error"
+//	exclude-func = "^main\\.legacy"
+//
+// The dir tables narrow the findings reported in the files of a directory
+// with checks, exclude-func, exclude-rules and severity, the table of the
+// innermost directory applies. exclude-rules can also be used at the top
+// level. Relative paths are relative to the directory of the file.
+type config struct {
+	path  string
+	flags []configValue
+	dirs  []*dirConfig
+}
+
+// configValue is a key of a configuration file with its values, more than
+// one if it is an array.
+type configValue struct {
+	key    string
+	values []string
+	line   int
+}
+
+// dirConfig are the settings of a directory.
+type dirConfig struct {
+	dir          string
+	checks       map[string]bool
+	excludeFunc  *regexp.Regexp
+	excludeRules map[string]bool
+	severity     severity
+}
+
+// conf is the configuration file in use, nil if there is none.
+var conf *config
+
+// configPathFlags are the flags whose values in a configuration file are
+// paths relative to the file.
+var configPathFlags = map[string]bool{"go": true, "goroot": true, "compare": true, "baseline": true, "db": true, "binary": true, "src": true}
+
+// configToolchainFlags select the toolchain, only one of them can be used
+// so none from the configuration file is used if any is set on the
+// command line.
+var configToolchainFlags = map[string]bool{"go": true, "goroot": true, "gotip": true, "update-gotip": true, "compare": true}
+
+var configDirTable = regexp.MustCompile(`^\[\s*dir\.("(?:[^"\\]|\\.)*"|'[^']*'|[A-Za-z0-9_-]+)\s*\]$`)
+var configKey = regexp.MustCompile(`^([A-Za-z0-9_-]+)\s*=\s*(.*)$`)
+
+// findConfig returns the path of the configuration file found walking up
+// from the directory of the first of args that exists, or from the
+// current directory, "" if there is none.
+func findConfig(args []string) string {
+	dir := "."
+	for _, arg := range args {
+		arg = strings.TrimSuffix(arg, "...")
+		if fi, err := os.Stat(arg); err == nil {
+			dir = arg
+			if !fi.IsDir() {
+				dir = filepath.Dir(arg)
+			}
+			break
+		}
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, configName)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// loadConfig reads the configuration file at path.
+func loadConfig(path string) (*config, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &config{path: path}
+	root := &dirConfig{dir: filepath.Dir(abs)}
+	c.dirs = append(c.dirs, root)
+	cur := root
+	errorf := func(line int, format string, args ...interface{}) error {
+		return fmt.Errorf("%s:%d: %s", path, line, fmt.Sprintf(format, args...))
+	}
+
+	s := bufio.NewScanner(fh)
+	for lineno := 1; s.Scan(); lineno++ {
+		line := strings.TrimSpace(stripConfigComment(s.Text()))
+		if line == "" {
+			continue
+		}
+		if m := configDirTable.FindStringSubmatch(line); m != nil {
+			dir, err := parseConfigString(m[1])
+			if err != nil {
+				return nil, errorf(lineno, "%v", err)
+			}
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(root.dir, dir)
+			}
+			cur = &dirConfig{dir: filepath.Clean(dir)}
+			c.dirs = append(c.dirs, cur)
+			continue
+		}
+		m := configKey.FindStringSubmatch(line)
+		if m == nil {
+			return nil, errorf(lineno, "expected key = value or [dir.\"path\"]")
+		}
+		key := m[1]
+		values, err := parseConfigValue(m[2])
+		if err != nil {
+			return nil, errorf(lineno, "%s: %v", key, err)
+		}
+
+		switch key {
+		case "exclude-rules":
+			if cur.excludeRules == nil {
+				cur.excludeRules = make(map[string]bool)
+			}
+			for _, v := range values {
+				cur.excludeRules[v] = true
+			}
+			continue
+		}
+		if cur != root {
+			switch key {
+			case "checks":
+				cur.checks, err = parseChecks(strings.Join(values, ","))
+			case "exclude-func":
+				cur.excludeFunc, err = regexp.Compile(strings.Join(values, "|"))
+			case "severity":
+				cur.severity, err = parseSeverity(strings.Join(values, ""))
+			default:
+				err = fmt.Errorf("not a setting of a directory")
+			}
+			if err != nil {
+				return nil, errorf(lineno, "%s: %v", key, err)
+			}
+			continue
+		}
+		if flag.Lookup(key) == nil {
+			return nil, errorf(lineno, "unknown flag %s", key)
+		}
+		if configPathFlags[key] {
+			for i, v := range values {
+				values[i] = configPath(root.dir, key, v)
+			}
+		}
+		c.flags = append(c.flags, configValue{key, values, lineno})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// configPath returns the value v of the path flag key of a configuration
+// file in dir, relative to dir. The go command is only a path if it
+// contains a separator, otherwise it is looked up in PATH.
+func configPath(dir, key, v string) string {
+	if key == "compare" {
+		gocmds := strings.Split(v, ",")
+		for i := range gocmds {
+			gocmds[i] = configPath(dir, "go", gocmds[i])
+		}
+		return strings.Join(gocmds, ",")
+	}
+	if v == "" || filepath.IsAbs(v) || (key == "go" && !strings.ContainsRune(v, filepath.Separator) && !strings.ContainsRune(v, '/')) {
+		return v
+	}
+	return filepath.Join(dir, v)
+}
+
+// setFlags sets the flags of the configuration file not set on the command
+// line.
+func (c *config) setFlags() error {
+	set := make(map[string]bool)
+	toolchainSet := false
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+		toolchainSet = toolchainSet || configToolchainFlags[f.Name]
+	})
+	for _, v := range c.flags {
+		if set[v.key] || (toolchainSet && configToolchainFlags[v.key]) {
+			continue
+		}
+		values := v.values
+		if v.key != "env" {
+			// repeatable flags take one value at a time, the others a
+			// comma separated list
+			values = []string{strings.Join(values, ",")}
+		}
+		for _, value := range values {
+			if err := flag.Set(v.key, value); err != nil {
+				return fmt.Errorf("%s:%d: %s: %v", c.path, v.line, v.key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// excluded returns true if f is excluded by the settings of the innermost
+// directory of the configuration containing its file, the last table if
+// more than one is for the same directory.
+func (c *config) excluded(f Finding) bool {
+	if c == nil {
+		return false
+	}
+	file, err := filepath.Abs(f.File)
+	if err != nil {
+		return false
+	}
+	var d *dirConfig
+	for _, dc := range c.dirs {
+		if (d == nil || len(dc.dir) >= len(d.dir)) && (file == dc.dir || strings.HasPrefix(file, dc.dir+string(filepath.Separator))) {
+			d = dc
+		}
+	}
+	if d == nil {
+		return false
+	}
+	return (d.checks != nil && !d.checks[f.Check]) ||
+		(d.excludeFunc != nil && d.excludeFunc.MatchString(f.Func)) ||
+		d.excludeRules[f.Rule] ||
+		f.Severity < d.severity
+}
+
+// stripConfigComment returns line without its comment.
+func stripConfigComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == 0 && c == '#':
+			return line[:i]
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == '"' && c == '\\':
+			i++
+		case c == quote:
+			quote = 0
+		}
+	}
+	return line
+}
+
+// parseConfigValue parses a value of a configuration file: a string, a
+// boolean, a number or an array of them on a single line.
+func parseConfigValue(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "[") {
+		v, rest, err := parseConfigScalar(s)
+		if err == nil && rest != "" {
+			err = fmt.Errorf("unexpected %q", rest)
+		}
+		return []string{v}, err
+	}
+	if !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("arrays must be on a single line")
+	}
+	s = strings.TrimSpace(s[1 : len(s)-1])
+	var r []string
+	for s != "" {
+		v, rest, err := parseConfigScalar(s)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, v)
+		rest = strings.TrimSpace(rest)
+		if rest != "" && rest[0] != ',' {
+			return nil, fmt.Errorf("expected , before %q", rest)
+		}
+		s = strings.TrimSpace(strings.TrimPrefix(rest, ","))
+	}
+	return r, nil
+}
+
+// parseConfigScalar parses the string, boolean or number at the start of
+// s, returning it and the rest of s.
+func parseConfigScalar(s string) (string, string, error) {
+	if s == "" {
+		return "", "", fmt.Errorf("missing value")
+	}
+	if s[0] == '"' || s[0] == '\'' {
+		end := 1
+		for end < len(s) && s[end] != s[0] {
+			if s[0] == '"' && s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		v, err := parseConfigString(s[:end+1])
+		return v, s[end+1:], err
+	}
+	end := strings.IndexAny(s, ", \t]")
+	if end < 0 {
+		end = len(s)
+	}
+	v := s[:end]
+	if v != "true" && v != "false" {
+		if _, err := strconv.ParseFloat(strings.ReplaceAll(v, "_", ""), 64); err != nil {
+			return "", "", fmt.Errorf("bad value %q", v)
+		}
+		v = strings.ReplaceAll(v, "_", "")
+	}
+	return v, s[end:], nil
+}
+
+// parseConfigString parses a quoted string, or a bare key.
+func parseConfigString(s string) (string, error) {
+	switch s[0] {
+	case '"':
+		return strconv.Unquote(s)
+	case '\'':
+		// literal strings have no escapes
+		return s[1 : len(s)-1], nil
+	}
+	return s, nil
+}
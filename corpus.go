@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// corpusMain implements the corpus subcommand: it checks every program of
+// a corpus of reproducers and compares the findings with the golden file
+// of each program, reporting the new findings as regressions and the ones
+// that no longer happen as improvements. It returns the exit status.
+func corpusMain(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("corpus", flag.ExitOnError)
+	update := fs.Bool("update", false, "rewrite the golden files with the current findings")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: badlngenerics [flags] corpus [-update] dir/...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitError
+	}
+
+	inputs := expandArgs(fs.Args())
+	outs := make([]chan *output, len(inputs))
+	sem := make(chan struct{}, parallel)
+	for i := range inputs {
+		outs[i] = make(chan *output, 1)
+		go func(i int) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			outs[i] <- checkInput(ctx, argInput(inputs[i]), [2]string{})
+		}(i)
+	}
+
+	status := exitClean
+	nregr, nimpr := 0, 0
+	for i, input := range inputs {
+		out := <-outs[i]
+		if out.failed {
+			os.Stdout.Write(out.Bytes())
+			status = exitError
+			continue
+		}
+		got := goldenLines(out.findings)
+		path := goldenFile(input)
+
+		if *update {
+			if err := writeGolden(path, got); err != nil {
+				fmt.Println(err)
+				status = exitError
+			}
+			continue
+		}
+
+		want, err := readGolden(path)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Println(err)
+			status = exitError
+			continue
+		}
+		for _, line := range got {
+			if !want[line] {
+				fmt.Printf("%s: regression: %s\n", input, line)
+				nregr++
+			}
+			delete(want, line)
+		}
+		impr := make([]string, 0, len(want))
+		for line := range want {
+			impr = append(impr, line)
+		}
+		sort.Strings(impr)
+		for _, line := range impr {
+			fmt.Printf("%s: improvement: %s\n", input, line)
+		}
+		nimpr += len(impr)
+	}
+
+	if *update {
+		return status
+	}
+	fmt.Printf("%d programs, %d regressions, %d improvements\n", len(inputs), nregr, nimpr)
+	if status == exitClean && nregr+nimpr > 0 {
+		// golden files must be updated for improvements too
+		status = exitFindings
+	}
+	return status
+}
+
+// goldenFile returns the path of the golden file of a corpus input, next
+// to the file for single file programs and inside the directory for
+// packages.
+func goldenFile(input string) string {
+	if strings.HasSuffix(input, ".go") {
+		return strings.TrimSuffix(input, ".go") + ".golden"
+	}
+	return filepath.Join(input, "findings.golden")
+}
+
+// goldenLines returns the lines of the golden file for findings fs. The
+// addresses and messages are left out since they change with unrelated
+// changes to the toolchain.
+func goldenLines(fs []Finding) []string {
+	seen := make(map[string]bool)
+	r := []string{}
+	for _, f := range fs {
+		name := f.Func
+		if f.Instance != "" {
+			name = f.Instance
+		}
+		line := fmt.Sprintf("%s:%d %s %s", baseName(f.File), f.Line, name, f.Check)
+		if !seen[line] {
+			seen[line] = true
+			r = append(r, line)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+func readGolden(path string) (map[string]bool, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return map[string]bool{}, err
+	}
+	defer fh.Close()
+	r := make(map[string]bool)
+	s := bufio.NewScanner(fh)
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			r[line] = true
+		}
+	}
+	return r, s.Err()
+}
+
+func writeGolden(path string, lines []string) error {
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return os.WriteFile(path, []byte(b.String()), 0666)
+}
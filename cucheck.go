@@ -0,0 +1,118 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// goProducer is the prefix of DW_AT_producer for compile units produced
+// by the Go compiler, followed by the version and the compiler flags.
+const goProducer = "Go cmd/compile "
+
+// checkCompileUnit checks the attributes of the compile unit of package
+// pkgpath: the language must be Go, the producer must be the Go compiler
+// and record the -N and -l flags the executable was built with, and the
+// source files of the functions checked must be reachable from the file
+// table, joining relative names with DW_AT_comp_dir.
+func checkCompileUnit(dw *dwarf.Data, pkgpath string, funcRanges []FuncRange) []Finding {
+	cu := compileUnit(dw, pkgpath)
+	if cu == nil {
+		return nil
+	}
+
+	var r []Finding
+	finding := func(rule, file, format string, args ...interface{}) {
+		r = append(r, Finding{
+			Check:   "compile-unit",
+			Rule:    rule,
+			File:    file,
+			Func:    pkgpath,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if lang, ok := cu.Val(dwarf.AttrLanguage).(int64); !ok {
+		finding("CU_LANGUAGE", "", "compile unit has no DW_AT_language")
+	} else if lang != dwLangGo {
+		finding("CU_LANGUAGE", "", "DW_AT_language is %#x instead of DW_LANG_Go", lang)
+	}
+
+	producer, _ := cu.Val(dwarf.AttrProducer).(string)
+	switch {
+	case producer == "":
+		finding("CU_PRODUCER", "", "compile unit has no DW_AT_producer")
+	case !strings.HasPrefix(producer, goProducer):
+		finding("CU_PRODUCER", "", "DW_AT_producer %q isn't the Go compiler", producer)
+	default:
+		var flags string
+		if i := strings.Index(producer, ";"); i >= 0 {
+			flags = producer[i+1:]
+		}
+		// without -N or -l the checks expecting unoptimized code report
+		// findings that aren't bugs
+		if hasCompilerFlag(flags, "-N") == optimized {
+			finding("CU_PRODUCER_FLAGS", "", "DW_AT_producer %q, expected optimizations to be %s", producer, enabled(optimized))
+		}
+		if hasCompilerFlag(flags, "-l") == inline {
+			finding("CU_PRODUCER_FLAGS", "", "DW_AT_producer %q, expected inlining to be %s", producer, enabled(inline))
+		}
+	}
+
+	if srcDir != "" {
+		// the sources were moved, the file table can't refer to them
+		return r
+	}
+	compDir, _ := cu.Val(dwarf.AttrCompDir).(string)
+	lnrdr, err := dw.LineReader(cu)
+	mustDecode(err)
+	if lnrdr == nil {
+		return r
+	}
+	var tableFiles []os.FileInfo
+	for _, f := range lnrdr.Files() {
+		if f == nil {
+			continue
+		}
+		path := f.Name
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(compDir, path)
+		}
+		if fi, err := os.Stat(path); err == nil {
+			tableFiles = append(tableFiles, fi)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, fr := range funcRanges {
+		fn := fr.Fn
+		if fr.CU == nil || fr.CU.Offset != cu.Offset || fn.adjusted || seen[fn.file] {
+			// files named by //line directives aren't in the file table
+			continue
+		}
+		seen[fn.file] = true
+		fi, err := os.Stat(fn.file)
+		if err != nil {
+			continue
+		}
+		found := false
+		for _, tfi := range tableFiles {
+			if os.SameFile(fi, tfi) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			finding("CU_FILE_UNRESOLVED", fn.file, "source file not reachable from the file table with DW_AT_comp_dir %q", compDir)
+		}
+	}
+	return r
+}
+
+func enabled(b bool) string {
+	if b {
+		return "enabled"
+	}
+	return "disabled"
+}
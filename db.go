@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const dbSchema = `CREATE TABLE IF NOT EXISTS runs (
+	id INTEGER PRIMARY KEY,
+	time TEXT,
+	toolchain TEXT,
+	goos TEXT,
+	goarch TEXT,
+	flags TEXT,
+	inputs INTEGER,
+	failed INTEGER,
+	findings INTEGER
+);
+CREATE TABLE IF NOT EXISTS findings (
+	run INTEGER REFERENCES runs(id),
+	check_name TEXT,
+	rule TEXT,
+	severity TEXT,
+	file TEXT,
+	line INTEGER,
+	pc INTEGER,
+	func TEXT,
+	instance TEXT,
+	is_stmt INTEGER,
+	toolchain TEXT,
+	target TEXT,
+	message TEXT,
+	count INTEGER
+);
+`
+
+// writeDB appends a row for the run, which checked the given number of
+// inputs of which failed could not be checked, and one for each of its
+// findings to the SQLite database at path, creating it if needed. The
+// standard library has no SQLite driver, the statements are run by the
+// sqlite3 command.
+func writeDB(path string, inputs, failed int, findings []Finding) error {
+	env, err := goCmd(context.Background(), goCommand, nil, "env", "GOVERSION", "GOOS", "GOARCH").Output()
+	if err != nil {
+		return fmt.Errorf("go env: %v", err)
+	}
+	v := strings.Fields(string(env))
+	if len(v) != 3 {
+		return fmt.Errorf("unexpected output of go env: %q", env)
+	}
+
+	var b strings.Builder
+	b.WriteString(dbSchema)
+	b.WriteString("BEGIN;\n")
+	fmt.Fprintf(&b, "INSERT INTO runs (time, toolchain, goos, goarch, flags, inputs, failed, findings) VALUES (%s, %s, %s, %s, %s, %d, %d, %d);\n",
+		sqlString(time.Now().UTC().Format(time.RFC3339)), sqlString(v[0]), sqlString(v[1]), sqlString(v[2]),
+		sqlString(strings.Join(os.Args[1:], " ")), inputs, failed, len(findings))
+	b.WriteString("CREATE TEMP TABLE run AS SELECT last_insert_rowid() AS id;\n")
+	for _, f := range findings {
+		isStmt := 0
+		if f.IsStmt {
+			isStmt = 1
+		}
+		count := f.Count
+		if count == 0 {
+			count = 1
+		}
+		fmt.Fprintf(&b, "INSERT INTO findings VALUES ((SELECT id FROM run), %s, %s, %s, %s, %d, %d, %s, %s, %d, %s, %s, %s, %d);\n",
+			sqlString(f.Check), sqlString(f.Rule), sqlString(f.Severity.String()), sqlString(relFile(f.File)), f.Line, int64(f.PC),
+			sqlString(f.Func), sqlString(f.Instance), isStmt, sqlString(f.Toolchain), sqlString(f.Target), sqlString(f.Message), count)
+	}
+	b.WriteString("COMMIT;\n")
+
+	cmd := exec.Command("sqlite3", "-bail", path)
+	cmd.Stdin = strings.NewReader(b.String())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sqlite3: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// sqlString quotes s as an SQL string literal.
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
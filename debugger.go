@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"debug/dwarf"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerCheck(debuggerCheck{"gdb", "GDB_MISMATCH", &useGDB})
+	registerCheck(debuggerCheck{"lldb", "LLDB_MISMATCH", &useLLDB})
+}
+
+// debuggerCheck asks an external debugger, run in batch mode, the line of
+// every is_stmt line entry address of the checked functions and the
+// addresses of every line with line entries, and reports the answers that
+// don't agree with the line table. It only runs with -gdb or -lldb.
+type debuggerCheck struct {
+	name    string // gdb or lldb
+	rule    string
+	enabled *bool
+}
+
+func (d debuggerCheck) Name() string { return d.name }
+
+// lineQuery is a source line whose addresses are asked to the debugger.
+type lineQuery struct {
+	file string
+	line int
+}
+
+func (d debuggerCheck) Run(ctx context.Context, bin *Binary, src *SourceInfo) []Finding {
+	if !*d.enabled {
+		return nil
+	}
+
+	// is_stmt addresses of each function and addresses of each of its lines
+	idx := newFuncIndex(bin.FuncRanges)
+	type funcEntries struct {
+		fr    *FuncRange
+		pcs   map[uint64]int
+		lines map[int]map[uint64]bool
+	}
+	byFunc := make(map[*Func]*funcEntries)
+	var fns []*Func
+	forEachFuncLineEntry(bin.DW, bin.FuncRanges, func(lne *dwarf.LineEntry) {
+		if lne.EndSequence || lne.File == nil {
+			return
+		}
+		fr := getFunc(lne.Address, idx)
+		if fr == nil || fr.Fn.adjusted || fr.inlinedAt(lne.Address) != nil || !sameFile(lne.File.Name, fr.Fn.file) {
+			return
+		}
+		e := byFunc[fr.Fn]
+		if e == nil {
+			e = &funcEntries{fr, make(map[uint64]int), make(map[int]map[uint64]bool)}
+			byFunc[fr.Fn] = e
+			fns = append(fns, fr.Fn)
+		}
+		if lne.IsStmt {
+			e.pcs[lne.Address] = lne.Line
+		}
+		if e.lines[lne.Line] == nil {
+			e.lines[lne.Line] = make(map[uint64]bool)
+		}
+		e.lines[lne.Line][lne.Address] = true
+	})
+
+	var pcs []uint64
+	var lines []lineQuery
+	for _, fn := range fns {
+		for pc := range byFunc[fn].pcs {
+			pcs = append(pcs, pc)
+		}
+		for line := range byFunc[fn].lines {
+			lines = append(lines, lineQuery{fn.file, line})
+		}
+	}
+	sort.Slice(pcs, func(i, j int) bool { return pcs[i] < pcs[j] })
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].file != lines[j].file {
+			return lines[i].file < lines[j].file
+		}
+		return lines[i].line < lines[j].line
+	})
+	if len(pcs) == 0 {
+		return nil
+	}
+
+	var pcLines map[uint64]lineQuery
+	var linePCs [][]uint64
+	var err error
+	switch d.name {
+	case "gdb":
+		pcLines, linePCs, err = queryGDB(ctx, bin.Path, pcs, lines)
+	case "lldb":
+		pcLines, linePCs, err = queryLLDB(ctx, bin.Path, pcs, lines)
+	}
+	if err != nil {
+		return []Finding{{Check: d.name, Rule: d.rule, File: bin.Path, Message: err.Error()}}
+	}
+
+	var r []Finding
+	finding := func(fr *FuncRange, line int, pc uint64, format string, args ...interface{}) {
+		r = append(r, Finding{
+			Check:     d.name,
+			Rule:      d.rule,
+			File:      fr.Fn.file,
+			Line:      line,
+			PC:        pc,
+			Func:      fr.Fn.Name,
+			Instance:  instanceName(fr.Name, fr.Fn),
+			StartLine: fr.Fn.startLine,
+			EndLine:   fr.Fn.endLine,
+			IsStmt:    true,
+			Message:   fmt.Sprintf(format, args...),
+		})
+	}
+	for _, pc := range pcs {
+		fr := getFunc(pc, idx)
+		want := byFunc[fr.Fn].pcs[pc]
+		got, ok := pcLines[pc]
+		switch {
+		case !ok:
+			finding(fr, want, pc, "%s finds no line for the address", d.name)
+		case got.line != want || baseName(got.file) != baseName(fr.Fn.file):
+			// debuggers don't always print the full path
+			finding(fr, want, pc, "%s maps the address to %s:%d", d.name, baseName(got.file), got.line)
+		}
+	}
+	for i, q := range lines {
+		var e *funcEntries
+		for _, fn := range fns {
+			if fn.file == q.file && byFunc[fn].lines[q.line] != nil {
+				e = byFunc[fn]
+				break
+			}
+		}
+		if len(linePCs[i]) == 0 {
+			finding(e.fr, q.line, e.fr.lowpc(), "%s finds no address for the line", d.name)
+		}
+		for _, pc := range linePCs[i] {
+			if getFunc(pc, idx) == nil {
+				// wrappers also have entries for the lines of the
+				// functions they wrap
+				continue
+			}
+			found := false
+			for _, fn := range fns {
+				if fn.file == q.file && byFunc[fn].lines[q.line][pc] {
+					found = true
+					break
+				}
+			}
+			if !found {
+				finding(e.fr, q.line, pc, "%s maps the line to an address without a line entry for it", d.name)
+			}
+		}
+	}
+	return r
+}
+
+var (
+	gdbLineRE  = regexp.MustCompile(`^Line (\d+) of "([^"]+)"`)
+	gdbStartRE = regexp.MustCompile(`^Line (\d+) of "[^"]+" starts at address (0x[0-9a-f]+)`)
+)
+
+// queryGDB asks gdb the lines of pcs and the addresses of lines in the
+// executable at path. The answers for the addresses are indexed by
+// address, the ones for the lines by their index in lines.
+func queryGDB(ctx context.Context, path string, pcs []uint64, lines []lineQuery) (map[uint64]lineQuery, [][]uint64, error) {
+	// the answers are separated by markers since errors don't have a
+	// fixed number of lines
+	var script bytes.Buffer
+	for _, pc := range pcs {
+		fmt.Fprintf(&script, "echo @@pc %#x\\n\ninfo line *%#x\n", pc, pc)
+	}
+	for i, q := range lines {
+		fmt.Fprintf(&script, "echo @@line %d\\n\ninfo line %s:%d\n", i, q.file, q.line)
+	}
+	out, err := runDebugger(ctx, path, script.Bytes(), "gdb", "-batch", "-nx", "-x")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pcLines := make(map[uint64]lineQuery)
+	linePCs := make([][]uint64, len(lines))
+	var pc uint64
+	cur := -1
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if s, ok := strings.CutPrefix(line, "@@pc "); ok {
+			pc, _ = strconv.ParseUint(s, 0, 64)
+			cur = -1
+			continue
+		}
+		if s, ok := strings.CutPrefix(line, "@@line "); ok {
+			cur, _ = strconv.Atoi(s)
+			pc = 0
+			continue
+		}
+		switch {
+		case pc != 0:
+			if m := gdbLineRE.FindStringSubmatch(line); m != nil {
+				n, _ := strconv.Atoi(m[1])
+				pcLines[pc] = lineQuery{m[2], n}
+			}
+		case cur >= 0 && cur < len(lines):
+			if m := gdbStartRE.FindStringSubmatch(line); m != nil {
+				n, _ := strconv.Atoi(m[1])
+				addr, _ := strconv.ParseUint(m[2], 0, 64)
+				if n == lines[cur].line {
+					linePCs[cur] = append(linePCs[cur], addr)
+				}
+			}
+		}
+	}
+	return pcLines, linePCs, nil
+}
+
+var (
+	lldbAddressRE = regexp.MustCompile(`^Address: .*\[(0x[0-9a-f]+)\]`)
+	lldbSummaryRE = regexp.MustCompile(`^Summary: .* at (.+?):(\d+)(:\d+)?$`)
+	lldbBpRE      = regexp.MustCompile(`^(\d+)\.\d+: where = .* at (.+?):(\d+)(:\d+)?, address = (0x[0-9a-f]+)`)
+)
+
+// queryLLDB is like queryGDB but for lldb, the addresses are looked up
+// with image lookup and the lines with a breakpoint each, numbered in
+// order.
+func queryLLDB(ctx context.Context, path string, pcs []uint64, lines []lineQuery) (map[uint64]lineQuery, [][]uint64, error) {
+	var script bytes.Buffer
+	for _, pc := range pcs {
+		fmt.Fprintf(&script, "image lookup --address %#x\n", pc)
+	}
+	for _, q := range lines {
+		fmt.Fprintf(&script, "breakpoint set --file %s --line %d\n", q.file, q.line)
+	}
+	script.WriteString("breakpoint list\n")
+	out, err := runDebugger(ctx, path, script.Bytes(), "lldb", "--batch", "--no-lldbinit", "-s")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pcLines := make(map[uint64]lineQuery)
+	linePCs := make([][]uint64, len(lines))
+	var pc uint64
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if m := lldbAddressRE.FindStringSubmatch(line); m != nil {
+			pc, _ = strconv.ParseUint(m[1], 0, 64)
+			continue
+		}
+		if m := lldbSummaryRE.FindStringSubmatch(line); m != nil && pc != 0 {
+			n, _ := strconv.Atoi(m[2])
+			pcLines[pc] = lineQuery{m[1], n}
+			pc = 0
+			continue
+		}
+		if m := lldbBpRE.FindStringSubmatch(line); m != nil {
+			bp, _ := strconv.Atoi(m[1])
+			n, _ := strconv.Atoi(m[3])
+			addr, _ := strconv.ParseUint(m[5], 0, 64)
+			if bp >= 1 && bp <= len(lines) && n == lines[bp-1].line {
+				linePCs[bp-1] = append(linePCs[bp-1], addr)
+			}
+		}
+	}
+	return pcLines, linePCs, nil
+}
+
+// runDebugger runs the debugger command args, followed by the path of
+// script, on the executable at path and returns its output.
+func runDebugger(ctx context.Context, path string, script []byte, args ...string) (string, error) {
+	dir, err := os.MkdirTemp("", "badlngenerics-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	scriptPath := filepath.Join(dir, "script")
+	if err := os.WriteFile(scriptPath, script, 0666); err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], scriptPath, path)...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil && out.Len() == 0 {
+		return "", fmt.Errorf("running %s: %v", args[0], err)
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+func init() {
+	registerCheck(deferCheck{})
+}
+
+// deferCheck disassembles the functions with defer statements and checks
+// the lines of the calls generated for them: the calls registering a
+// deferred call must be attributed to the defer statement and the calls
+// running the deferred calls, runtime.deferreturn and the open-coded
+// calls of the defer wrappers, to a defer statement or to an exit of the
+// function, a return statement or the closing brace. Line 0 is always
+// accepted. Open-coded deferred calls made through a register can't be
+// told apart from other indirect calls and aren't checked. It only runs
+// with -defer-lines.
+type deferCheck struct{}
+
+func (deferCheck) Name() string { return "defer-line" }
+
+func (deferCheck) Run(ctx context.Context, bin *Binary, src *SourceInfo) []Finding {
+	if !deferLines {
+		return nil
+	}
+	var r []Finding
+	for i := range bin.FuncRanges {
+		fr := &bin.FuncRanges[i]
+		fn := fr.Fn
+		if fn.adjusted || !hasDefer(fn) {
+			continue
+		}
+		for _, rng := range fr.Rngs {
+			if ctx.Err() != nil {
+				return r
+			}
+			insts, err := objdump(ctx, bin.Path, rng)
+			if err != nil {
+				r = append(r, Finding{Check: "defer-line", Rule: "DEFER_DISASM_FAILED", Func: fn.Name, Instance: instanceName(fr.Name, fn), PC: rng[0], Message: fmt.Sprintf("could not disassemble: %v", err)})
+				break
+			}
+			if err := annotate(bin.DW, fr.CU, insts); err != nil {
+				r = append(r, funcMalformedFinding(fr, err, "reading the line table"))
+				break
+			}
+			for _, inst := range insts {
+				callee, exit := deferCall(inst.text)
+				lne := inst.lne
+				if callee == "" || lne == nil || lne.Line == 0 || fr.inlinedAt(inst.pc) != nil {
+					continue
+				}
+				if sameFile(lne.File.Name, fn.file) && (inDeferStmt(fn, lne.Line) || exit && (fn.returnLines[lne.Line] || lne.Line == fn.endLine)) {
+					continue
+				}
+				rule, what := "DEFER_REGISTER_LINE", "the defer statement"
+				if exit {
+					rule, what = "DEFER_EXIT_LINE", "a defer statement, a return statement or the closing brace"
+				}
+				r = append(r, Finding{
+					Check:     "defer-line",
+					Rule:      rule,
+					File:      lne.File.Name,
+					Line:      lne.Line,
+					PC:        inst.pc,
+					Func:      fn.Name,
+					Instance:  instanceName(fr.Name, fn),
+					StartLine: fn.startLine,
+					EndLine:   fn.endLine,
+					IsStmt:    lne.IsStmt,
+					Message:   fmt.Sprintf("call to %s attributed to line %d instead of %s", callee, lne.Line, what),
+				})
+			}
+		}
+	}
+	return r
+}
+
+// hasDefer returns true if fn contains a defer statement.
+func hasDefer(fn *Func) bool {
+	for _, stmt := range fn.goDefers {
+		if stmt.kind == "defer" {
+			return true
+		}
+	}
+	return false
+}
+
+// inDeferStmt returns true if line is one of the lines of a defer
+// statement of fn.
+func inDeferStmt(fn *Func, line int) bool {
+	for _, stmt := range fn.goDefers {
+		if stmt.kind == "defer" && line >= stmt.start && line <= stmt.end {
+			return true
+		}
+	}
+	return false
+}
+
+// deferCall returns the function called by the instruction text if it's
+// one of the calls generated for defer statements, exit is set for the
+// calls running the deferred calls at the exits of the function.
+func deferCall(text string) (callee string, exit bool) {
+	fields := strings.Fields(text)
+	if len(fields) < 2 || fields[0] != "CALL" {
+		return "", false
+	}
+	callee = strings.TrimSuffix(fields[1], "(SB)")
+	switch {
+	case strings.HasPrefix(callee, "runtime.deferproc"), callee == "runtime.deferrangefunc":
+		return callee, false
+	case callee == "runtime.deferreturn", strings.Contains(callee, ".deferwrap"):
+		return callee, true
+	}
+	return "", false
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+func init() {
+	registerCheck(delveCheck{})
+}
+
+// delveCheck sets a breakpoint, through the JSON-RPC API of a headless
+// Delve, on every line with statements of the checked functions and
+// checks that it resolves to addresses inside the function. It only runs
+// with -delve.
+type delveCheck struct{}
+
+func (delveCheck) Name() string { return "delve" }
+
+func (delveCheck) Run(ctx context.Context, bin *Binary, src *SourceInfo) []Finding {
+	if !useDelve {
+		return nil
+	}
+	client, stop, err := startDelve(ctx, bin.Path)
+	if err != nil {
+		return []Finding{{Check: "delve", Rule: "DELVE_BREAKPOINT", File: bin.Path, Message: err.Error()}}
+	}
+	defer stop()
+
+	idx := newFuncIndex(bin.FuncRanges)
+	var r []Finding
+	seen := make(map[*Func]bool)
+	for i := range bin.FuncRanges {
+		fr := &bin.FuncRanges[i]
+		fn := fr.Fn
+		if seen[fn] || fn.adjusted {
+			continue
+		}
+		seen[fn] = true
+		finding := func(line int, pc uint64, format string, args ...interface{}) {
+			r = append(r, Finding{
+				Check:     "delve",
+				Rule:      "DELVE_BREAKPOINT",
+				File:      fn.file,
+				Line:      line,
+				PC:        pc,
+				Func:      fn.Name,
+				StartLine: fn.startLine,
+				EndLine:   fn.endLine,
+				Message:   fmt.Sprintf(format, args...),
+			})
+		}
+
+		lines := make([]int, 0, len(fn.stmtLines))
+		for line := range fn.stmtLines {
+			lines = append(lines, line)
+		}
+		sort.Ints(lines)
+		for _, line := range lines {
+			if ctx.Err() != nil {
+				return r
+			}
+			var out delveFindLocationOut
+			err := client.Call("RPCServer.FindLocation", delveFindLocationIn{Scope: delveEvalScope{GoroutineID: -1}, Loc: fmt.Sprintf("%s:%d", fn.file, line)}, &out)
+			if err != nil {
+				finding(line, fr.lowpc(), "can not set a breakpoint: %v", err)
+				continue
+			}
+			for _, loc := range out.Locations {
+				pcs := loc.PCs
+				if len(pcs) == 0 {
+					pcs = []uint64{loc.PC}
+				}
+				for _, pc := range pcs {
+					if delveInFunc(idx, fn, pc) {
+						continue
+					}
+					name := "unknown function"
+					if loc.Function != nil {
+						name = loc.Function.Name
+					}
+					finding(line, pc, "breakpoint set at %#x in %s", pc, name)
+				}
+			}
+		}
+	}
+	return r
+}
+
+// delveInFunc returns true if pc belongs to fn or to a call of fn inlined
+// in one of the checked functions.
+func delveInFunc(idx funcIndex, fn *Func, pc uint64) bool {
+	fr := getFunc(pc, idx)
+	if fr == nil {
+		return false
+	}
+	if inl := fr.inlinedAt(pc); inl != nil {
+		return inl.Fn == fn
+	}
+	return fr.Fn == fn
+}
+
+// startDelve starts a headless Delve for the executable at path and
+// returns a client for its API and a function stopping it.
+func startDelve(ctx context.Context, path string) (*rpc.Client, func(), error) {
+	cmd := exec.CommandContext(ctx, "dlv", "exec", "--headless", "--api-version=2", "--listen=127.0.0.1:0", path)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("starting dlv: %v", err)
+	}
+	kill := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+
+	const listening = "API server listening at: "
+	addr := ""
+	s := bufio.NewScanner(stdout)
+	for s.Scan() {
+		if line := s.Text(); strings.HasPrefix(line, listening) {
+			addr = strings.TrimSpace(line[len(listening):])
+			break
+		}
+	}
+	if addr == "" {
+		kill()
+		return nil, nil, fmt.Errorf("dlv did not start listening")
+	}
+	// the output of the executable must not block it
+	go func() {
+		for s.Scan() {
+		}
+	}()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		kill()
+		return nil, nil, fmt.Errorf("connecting to dlv: %v", err)
+	}
+	client := jsonrpc.NewClient(conn)
+	return client, func() {
+		client.Call("RPCServer.Detach", delveDetachIn{Kill: true}, &struct{}{})
+		client.Close()
+		kill()
+	}, nil
+}
+
+// arguments and results of the Delve API methods used
+type (
+	delveEvalScope struct {
+		GoroutineID  int64
+		Frame        int
+		DeferredCall int
+	}
+
+	delveFindLocationIn struct {
+		Scope                     delveEvalScope
+		Loc                       string
+		IncludeNonExecutableLines bool
+	}
+
+	delveFindLocationOut struct {
+		Locations []struct {
+			PC       uint64   `json:"pc"`
+			PCs      []uint64 `json:"pcs"`
+			Function *struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		}
+	}
+
+	delveDetachIn struct {
+		Kill bool
+	}
+)
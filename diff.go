@@ -0,0 +1,158 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// funcLines is the part of the line table of a function compared by diff.
+type funcLines struct {
+	entries  map[string]int  // number of entries for each file:line
+	stmt     map[string]bool // file:line with an is_stmt entry
+	prologue string          // file:line of prologue_end
+}
+
+// diffMain implements the diff subcommand: it compares the line tables of
+// the functions with the same name in two executables and returns the exit
+// status.
+func diffMain(args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "usage: badlngenerics diff old.bin new.bin\n")
+		return exitError
+	}
+	var fls [2]map[string]*funcLines
+	for i := range args {
+		var err error
+		fls[i], err = readFuncLines(args[i])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	}
+
+	names := make([]string, 0, len(fls[0]))
+	for name := range fls[0] {
+		if fls[1][name] != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	status := exitClean
+	for _, name := range names {
+		if diffFunc(name, args, fls[0][name], fls[1][name]) {
+			status = exitFindings
+		}
+	}
+	return status
+}
+
+// diffFunc prints the differences between the line tables old and new of
+// function name and returns true if there are any.
+func diffFunc(name string, paths []string, old, new *funcLines) bool {
+	changed := false
+	printf := func(format string, args ...interface{}) {
+		changed = true
+		fmt.Printf("%s: %s\n", name, fmt.Sprintf(format, args...))
+	}
+
+	var lines []string
+	for line := range old.entries {
+		lines = append(lines, line)
+	}
+	for line := range new.entries {
+		if old.entries[line] == 0 {
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		switch {
+		case new.entries[line] == 0:
+			printf("%s only in %s", line, paths[0])
+		case old.entries[line] == 0:
+			printf("%s only in %s", line, paths[1])
+		case old.stmt[line] != new.stmt[line]:
+			if old.stmt[line] {
+				printf("%s is_stmt only in %s", line, paths[0])
+			} else {
+				printf("%s is_stmt only in %s", line, paths[1])
+			}
+		}
+	}
+
+	if old.prologue != new.prologue {
+		printf("prologue_end moved from %q to %q", old.prologue, new.prologue)
+	}
+
+	return changed
+}
+
+// readFuncLines returns the line table of every function of the executable
+// at path. File names are reduced to their base name so that executables
+// built from different directories or with different GOROOTs can be
+// compared.
+func readFuncLines(path string) (map[string]*funcLines, error) {
+	file := openBinary(path)
+	if file == nil {
+		return nil, fmt.Errorf("could not open executable %s", path)
+	}
+	defer file.Close()
+	dw, err := file.DWARF()
+	if err != nil {
+		return nil, fmt.Errorf("could not read debug info of %s: %v", path, err)
+	}
+
+	var frs []FuncRange
+	rdr := dw.Reader()
+	for {
+		e, err := rdr.Next()
+		must(err)
+		if e == nil {
+			break
+		}
+		if e.Tag != dwarf.TagCompileUnit && e.Tag != dwarf.TagSubprogram {
+			rdr.SkipChildren()
+			continue
+		}
+		if e.Tag != dwarf.TagSubprogram {
+			continue
+		}
+		rdr.SkipChildren()
+		name, ok := entryName(dw, e)
+		rngs, err := dw.Ranges(e)
+		must(err)
+		if !ok || len(rngs) == 0 {
+			continue
+		}
+		frs = append(frs, FuncRange{Rngs: rngs, Name: name})
+	}
+	idx := newFuncIndex(frs)
+
+	r := make(map[string]*funcLines)
+	forEachLineEntry(dw, func(lne *dwarf.LineEntry) {
+		if lne.EndSequence {
+			return
+		}
+		fr := getFunc(lne.Address, idx)
+		if fr == nil {
+			return
+		}
+		fl := r[fr.Name]
+		if fl == nil {
+			fl = &funcLines{entries: make(map[string]int), stmt: make(map[string]bool)}
+			r[fr.Name] = fl
+		}
+		line := fmt.Sprintf("%s:%d", baseName(lne.File.Name), lne.Line)
+		fl.entries[line]++
+		if lne.IsStmt {
+			fl.stmt[line] = true
+		}
+		if lne.PrologueEnd && fl.prologue == "" {
+			fl.prologue = line
+		}
+	})
+	return r, nil
+}
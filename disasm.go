@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"debug/dwarf"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// number of instructions disassembled before and after the PC of a finding
+const disasmWindow = 5
+
+// disassembleFindings sets the Disasm field of the findings fs, reported
+// for the executable at path, to the instructions around their PC, each
+// one annotated with the line entry covering it.
+func disassembleFindings(ctx context.Context, path string, dw *dwarf.Data, funcRanges []FuncRange, fs []Finding) error {
+	idx := newFuncIndex(funcRanges)
+	insts := make(map[[2]uint64][]instruction)
+	for i := range fs {
+		fr := getFunc(fs[i].PC, idx)
+		if fr == nil {
+			continue
+		}
+		for _, rng := range fr.Rngs {
+			if fs[i].PC < rng[0] || fs[i].PC >= rng[1] {
+				continue
+			}
+			if _, ok := insts[rng]; !ok {
+				is, err := objdump(ctx, path, rng)
+				if err != nil {
+					return fmt.Errorf("disassembling %s: %v", fr.Name, err)
+				}
+				if err := annotate(dw, fr.CU, is); err != nil {
+					return fmt.Errorf("reading the line table of %s: %v", fr.Name, err)
+				}
+				insts[rng] = is
+			}
+			fs[i].Disasm = window(insts[rng], fs[i].PC)
+		}
+	}
+	return nil
+}
+
+// instruction is an instruction of a function with the line entry covering
+// its address.
+type instruction struct {
+	pc   uint64
+	text string
+	lne  *dwarf.LineEntry
+}
+
+// objdump disassembles the address range rng of the executable at path
+// with go tool objdump.
+func objdump(ctx context.Context, path string, rng [2]uint64) ([]instruction, error) {
+	out, err := goCmd(ctx, goCommand, nil, "tool", "objdump", path, fmt.Sprintf("%#x", rng[0]), fmt.Sprintf("%#x", rng[1])).Output()
+	if err != nil {
+		return nil, err
+	}
+	var r []instruction
+	for _, line := range strings.Split(string(out), "\n") {
+		// file:line, address, encoding and instruction separated by tabs
+		var fields []string
+		for _, f := range strings.Split(line, "\t") {
+			if f = strings.TrimSpace(f); f != "" {
+				fields = append(fields, f)
+			}
+		}
+		if len(fields) < 4 {
+			continue
+		}
+		pc, err := strconv.ParseUint(fields[1], 0, 64)
+		if err != nil {
+			continue
+		}
+		r = append(r, instruction{pc: pc, text: strings.Join(fields[3:], " ")})
+	}
+	return r, nil
+}
+
+// annotate sets the line entry of each instruction in insts to the entry
+// of the line table of cu covering its address.
+func annotate(dw *dwarf.Data, cu *dwarf.Entry, insts []instruction) error {
+	var lnes []dwarf.LineEntry
+	err := forEachCULineEntry(dw, cu, func(lne *dwarf.LineEntry) {
+		lnes = append(lnes, *lne)
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(lnes, func(i, j int) bool { return lnes[i].Address < lnes[j].Address })
+	for i := range insts {
+		// the last entry at or before the instruction
+		j := sort.Search(len(lnes), func(j int) bool { return lnes[j].Address > insts[i].pc }) - 1
+		if j >= 0 && !lnes[j].EndSequence {
+			insts[i].lne = &lnes[j]
+		}
+	}
+	return nil
+}
+
+// window formats the instructions of insts around pc.
+func window(insts []instruction, pc uint64) []string {
+	i := sort.Search(len(insts), func(i int) bool { return insts[i].pc >= pc })
+	start, end := i-disasmWindow, i+disasmWindow+1
+	if start < 0 {
+		start = 0
+	}
+	if end > len(insts) {
+		end = len(insts)
+	}
+	var r []string
+	for _, inst := range insts[start:end] {
+		mark := "  "
+		if inst.pc == pc {
+			mark = "=>"
+		}
+		pos := "no line entry"
+		if lne := inst.lne; lne != nil && lne.File != nil {
+			pos = fmt.Sprintf("%s:%d", baseName(lne.File.Name), lne.Line)
+			if lne.IsStmt {
+				pos += " is_stmt"
+			}
+			if lne.PrologueEnd {
+				pos += " prologue_end"
+			}
+		}
+		r = append(r, fmt.Sprintf("%s %#x %-28s %s", mark, inst.pc, pos, inst.text))
+	}
+	return r
+}
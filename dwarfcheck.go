@@ -0,0 +1,855 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"debug/dwarf"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type FuncRange struct {
+	Rngs     [][2]uint64 // sorted address ranges of the function
+	Fn       *Func
+	Name     string // name of the function in the debug info, for generic functions it includes the shapes of the instantiation
+	Inlined  []InlinedCall
+	DeclFile string
+	DeclLine int
+	Offset   dwarf.Offset // offset of the subprogram entry
+	CU       *dwarf.Entry // compile unit containing the function
+}
+
+// InlinedCall is a call inlined inside a function.
+type InlinedCall struct {
+	Rngs       [][2]uint64
+	Fn         *Func // inlined function, nil if it isn't one of the checked functions
+	Name       string
+	Caller     *Func // function containing the call, nil if it isn't one of the checked functions
+	CallerName string
+	Depth      int // 1 for calls inlined directly into the function, 2 for calls inlined into those, etc.
+	CallFile   string
+	CallLine   int
+}
+
+// renamePkgClosures renames the closures of the package level variable
+// initializers of package pkgpath in funcs, and the closures they contain,
+// after the subprogram of dw declared at the same position: the compiler
+// numbers them in initialization order, getLineRanges in source order.
+func renamePkgClosures(dw *dwarf.Data, pkgpath string, funcs map[string]*Func) {
+	prefix := pkgpath + ".init.func"
+	isPkgClosure := func(name string) bool {
+		n, ok := strings.CutPrefix(name, prefix)
+		if !ok || n == "" {
+			return false
+		}
+		for _, c := range n {
+			if c < '0' || c > '9' {
+				return false
+			}
+		}
+		return true
+	}
+
+	type pos struct {
+		file string
+		line int
+	}
+	src := make(map[pos]string)
+	for name, fn := range funcs {
+		if isPkgClosure(name) {
+			p := pos{filepath.ToSlash(filepath.Clean(fn.file)), fn.startLine}
+			if _, dup := src[p]; dup {
+				// closures on the same line can't be told apart
+				src[p] = ""
+				continue
+			}
+			src[p] = name
+		}
+	}
+	cu := withSkeleton(dw, compileUnit(dw, pkgpath))
+	if len(src) == 0 || cu == nil {
+		return
+	}
+	lnrdr, err := dw.LineReader(cu)
+	if err != nil || lnrdr == nil {
+		return
+	}
+	files := lnrdr.Files()
+
+	renames := make(map[string]string)
+	rdr := dw.Reader()
+	rdr.Seek(cu.Offset)
+	rdr.Next()
+	for {
+		e, err := rdr.Next()
+		if err != nil || e == nil || e.Tag == dwarf.TagCompileUnit {
+			// errors are reported by getPCRanges
+			break
+		}
+		if e.Tag != dwarf.TagSubprogram {
+			continue
+		}
+		rdr.SkipChildren()
+		name, _ := e.Val(dwarf.AttrName).(string)
+		file, okfile := e.Val(dwarf.AttrDeclFile).(int64)
+		line, okline := e.Val(dwarf.AttrDeclLine).(int64)
+		if !isPkgClosure(name) || !okfile || !okline {
+			continue
+		}
+		p := pos{filepath.ToSlash(filepath.Clean(lineFileName(files, file))), int(line)}
+		if old := src[p]; old != "" && old != name {
+			renames[old] = name
+		}
+	}
+
+	moved := make(map[string]*Func)
+	for name, fn := range funcs {
+		for old, new := range renames {
+			if rest, ok := strings.CutPrefix(name, old); ok && (rest == "" || rest[0] == '.' || rest[0] == '-') {
+				logger.Debug("renamed package level closure", "name", name, "new", new+rest)
+				delete(funcs, name)
+				fn.Name = new + rest
+				moved[fn.Name] = fn
+				break
+			}
+		}
+	}
+	for name, fn := range moved {
+		funcs[name] = fn
+	}
+}
+
+// getPCRanges returns the address ranges of the functions in funcs and a
+// finding for each compile unit that couldn't be read completely, the
+// functions after the error are skipped.
+func getPCRanges(dw *dwarf.Data, funcs map[string]*Func) ([]FuncRange, []Finding) {
+	r := []FuncRange{}
+	var malformed []Finding
+	units := compileUnits(dw)
+
+	rdr := dw.Reader()
+
+	type frame struct {
+		fn    *Func
+		name  string
+		depth int
+	}
+	// stack of the entries with children enclosing the current one
+	stack := []frame{}
+	top := func() frame {
+		if len(stack) == 0 {
+			return frame{}
+		}
+		return stack[len(stack)-1]
+	}
+
+	var files []*dwarf.LineFile
+	var cu *dwarf.Entry
+	cur := -1  // index in r of the function being read
+	unit := -1 // index in units of the compile unit being read
+	addMalformed := func(err error, format string, args ...interface{}) {
+		f := malformedFinding(units, err, format, args...)
+		if f.Func == "" && unit >= 0 && unit < len(units) {
+			f.Func = units[unit].name
+		}
+		malformed = append(malformed, f)
+	}
+
+	// with -cu-filter only the compile units of the packages of funcs are
+	// read
+	var pkgs map[string]bool
+	if cuFilter {
+		pkgs = make(map[string]bool)
+		for name := range funcs {
+			pkgs[funcPackage(name)] = true
+		}
+	}
+
+	for {
+		e, err := rdr.Next()
+		if err != nil {
+			addMalformed(err, "functions of the compile unit skipped")
+			// continue with the next compile unit
+			unit++
+			if unit >= len(units) {
+				break
+			}
+			rdr.Seek(units[unit].off)
+			stack, cur = nil, -1
+			continue
+		}
+		if e == nil {
+			break
+		}
+		if e.Tag == 0 {
+			if len(stack) == 0 {
+				continue
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		fr := top()
+
+		switch e.Tag {
+		case dwarf.TagCompileUnit:
+			unit = unitAt(units, e.Offset)
+			if !isGoCompileUnit(e) || (pkgs != nil && !pkgs[compileUnitName(e)]) {
+				logger.Log(context.Background(), levelTrace, "skipped compile unit", "name", compileUnitName(e))
+				rdr.SkipChildren()
+				continue
+			}
+			logger.Debug("compile unit", "name", compileUnitName(e), "offset", e.Offset)
+			cu = withSkeleton(dw, e)
+			files = nil
+			if lnrdr, _ := dw.LineReader(cu); lnrdr != nil {
+				files = lnrdr.Files()
+			}
+
+		case dwarf.TagSubprogram:
+			cur = -1
+			fr = frame{}
+			name, okname := entryName(dw, e)
+			rngs, err := dw.Ranges(e)
+			if err != nil {
+				addMalformed(err, "ranges of subprogram %s at %#x", name, e.Offset)
+				break
+			}
+			if !okname || len(rngs) == 0 {
+				break
+			}
+			fn := funcs[withoutTypeParams(name)]
+			if fn == nil || isInstantiationWrapper(name) {
+				logger.Log(context.Background(), levelTrace, "skipped subprogram", "name", name)
+				break
+			}
+			if i, ok := e.Val(dwarf.AttrDeclFile).(int64); ok && !fn.adjusted {
+				// names are not unique: packages with the same path can
+				// come from different directories
+				if file := lineFileName(files, i); file != "" && !sameFile(file, fn.file) {
+					logger.Debug("subprogram declared in another file", "name", name, "file", file, "source", fn.file)
+					break
+				}
+			}
+			logger.Debug("subprogram", "name", name, "lowpc", fmt.Sprintf("%#x", rngs[0][0]), "ranges", len(rngs))
+			sort.Slice(rngs, func(i, j int) bool { return rngs[i][0] < rngs[j][0] })
+			r = append(r, FuncRange{Rngs: rngs, Fn: fn, Name: name, Offset: e.Offset, CU: cu})
+			cur = len(r) - 1
+			if i, ok := entryVal(dw, e, dwarf.AttrDeclFile).(int64); ok {
+				r[cur].DeclFile = lineFileName(files, i)
+			}
+			if line, ok := entryVal(dw, e, dwarf.AttrDeclLine).(int64); ok {
+				r[cur].DeclLine = int(line)
+			}
+			fr.fn, fr.name = fn, name
+
+		case dwarf.TagInlinedSubroutine:
+			if cur < 0 {
+				break
+			}
+			rngs, err := dw.Ranges(e)
+			if err != nil {
+				addMalformed(err, "ranges of inlined call at %#x", e.Offset)
+				break
+			}
+			inl := InlinedCall{Rngs: rngs, Caller: fr.fn, CallerName: fr.name, Depth: fr.depth + 1}
+			if name, ok := entryName(dw, e); ok {
+				inl.Fn, inl.Name = funcs[withoutTypeParams(name)], name
+			}
+			if i, ok := e.Val(dwarf.AttrCallFile).(int64); ok {
+				inl.CallFile = lineFileName(files, i)
+			}
+			if line, ok := e.Val(dwarf.AttrCallLine).(int64); ok {
+				inl.CallLine = int(line)
+			}
+			r[cur].Inlined = append(r[cur].Inlined, inl)
+			fr = frame{inl.Fn, inl.Name, inl.Depth}
+		}
+
+		if e.Children {
+			stack = append(stack, fr)
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].lowpc() < r[j].lowpc() })
+	return r, malformed
+}
+
+// isInstantiationWrapper returns true if name is the name of an
+// instantiation of a generic function with concrete types, which the
+// compiler generates as a wrapper calling the instantiation with shape
+// types.
+func isInstantiationWrapper(name string) bool {
+	return strings.Contains(name, "[") && !strings.Contains(name, "go.shape.")
+}
+
+// lowpc returns the lowest address of the function.
+func (fr *FuncRange) lowpc() uint64 {
+	return fr.Rngs[0][0]
+}
+
+const dwLangGo = 0x16
+
+// isGoCompileUnit returns true if the compile unit e was produced by the Go
+// compiler, executables using cgo also contain C compile units.
+func isGoCompileUnit(e *dwarf.Entry) bool {
+	lang, ok := e.Val(dwarf.AttrLanguage).(int64)
+	return !ok || lang == dwLangGo
+}
+
+// compileUnitName returns the name of compile unit e, for Go compile units
+// it's the path of the package.
+func compileUnitName(e *dwarf.Entry) string {
+	name, _ := e.Val(dwarf.AttrName).(string)
+	return name
+}
+
+// funcPackage returns the package path of the function called name.
+func funcPackage(name string) string {
+	i := strings.LastIndex(name, "/") + 1
+	if j := strings.Index(name[i:], "."); j >= 0 {
+		return name[:i+j]
+	}
+	return name
+}
+
+// compileUnit returns the compile unit for package pkgpath in dw, or nil
+// if there isn't one.
+func compileUnit(dw *dwarf.Data, pkgpath string) *dwarf.Entry {
+	rdr := dw.Reader()
+	for {
+		e, err := rdr.Next()
+		if err != nil || e == nil {
+			return nil
+		}
+		if e.Tag == dwarf.TagCompileUnit {
+			if compileUnitName(e) == pkgpath {
+				return withSkeleton(dw, e)
+			}
+		}
+		rdr.SkipChildren()
+	}
+}
+
+// entryName returns the name of e, following its abstract origin if it
+// doesn't have one (as is the case for inlined calls and for the out of
+// line copies of inlinable functions).
+func entryName(dw *dwarf.Data, e *dwarf.Entry) (string, bool) {
+	name, ok := entryVal(dw, e, dwarf.AttrName).(string)
+	return name, ok
+}
+
+// entryVal returns the value of attribute attr of e, or of its abstract
+// origin if e doesn't have it.
+func entryVal(dw *dwarf.Data, e *dwarf.Entry, attr dwarf.Attr) interface{} {
+	if v := e.Val(attr); v != nil {
+		return v
+	}
+	off, ok := e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+	if !ok {
+		return nil
+	}
+	rdr := dw.Reader()
+	rdr.Seek(off)
+	ae, err := rdr.Next()
+	if err != nil || ae == nil {
+		return nil
+	}
+	return ae.Val(attr)
+}
+
+// lineFileName returns the name of the i-th entry of a file table.
+func lineFileName(files []*dwarf.LineFile, i int64) string {
+	if i < 0 || int(i) >= len(files) || files[i] == nil {
+		return ""
+	}
+	return files[i].Name
+}
+
+// scope is an entry that can contain variables: a subprogram, a lexical
+// block or an inlined call.
+type scope struct {
+	off  dwarf.Offset
+	rngs [][2]uint64
+}
+
+// walkScopes calls fn for each entry contained in the subprogram of fr,
+// passing the innermost scope containing it. It stops at the first entry
+// that can't be read.
+func walkScopes(dw *dwarf.Data, fr *FuncRange, fn func(e *dwarf.Entry, parent scope)) error {
+	rdr := dw.Reader()
+	rdr.Seek(fr.Offset)
+	e, err := rdr.Next()
+	if err != nil {
+		return err
+	}
+	if e == nil || !e.Children {
+		return nil
+	}
+
+	// scopes enclosing the current entry
+	scopes := []scope{{fr.Offset, fr.Rngs}}
+
+	for len(scopes) > 0 {
+		e, err := rdr.Next()
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			break
+		}
+		if e.Tag == 0 {
+			scopes = scopes[:len(scopes)-1]
+			continue
+		}
+		parent := scopes[len(scopes)-1]
+		fn(e, parent)
+		if !e.Children {
+			continue
+		}
+		cur := parent
+		switch e.Tag {
+		case dwarf.TagLexDwarfBlock, dwarf.TagInlinedSubroutine:
+			cur.off = e.Offset
+			if rngs, err := dw.Ranges(e); err == nil && len(rngs) > 0 {
+				cur.rngs = rngs
+			}
+		}
+		scopes = append(scopes, cur)
+	}
+	return nil
+}
+
+// inlinedAt returns the innermost call inlined in fr containing pc.
+func (fr *FuncRange) inlinedAt(pc uint64) *InlinedCall {
+	var r *InlinedCall
+	for i := range fr.Inlined {
+		inl := &fr.Inlined[i]
+		if r != nil && inl.Depth <= r.Depth {
+			continue
+		}
+		for _, rng := range inl.Rngs {
+			if rng[0] <= pc && pc < rng[1] {
+				r = inl
+				break
+			}
+		}
+	}
+	return r
+}
+
+// baseName returns the last element of a file name from the line table,
+// executables built on windows use backslashes as path separators.
+func baseName(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+func checkLines(dw *dwarf.Data, funcs map[string]*Func, funcRanges []FuncRange) []Finding {
+	var r []Finding
+
+	idx := newFuncIndex(funcRanges)
+
+	forEachFuncLineEntry(dw, funcRanges, func(lne *dwarf.LineEntry) {
+		if lne.EndSequence {
+			// the address is past the end of the sequence, it can be the
+			// start of the next function
+			return
+		}
+		if onlyStmt && !allEntries && !lne.IsStmt {
+			return
+		}
+		fr := getFunc(lne.Address, idx)
+		if fr == nil {
+			return
+		}
+		logger.Log(context.Background(), levelTrace, "line entry", "pc", fmt.Sprintf("%#x", lne.Address), "file", lne.File.Name, "line", lne.Line, "is_stmt", lne.IsStmt, "func", fr.Name)
+		fn, name, check, rule := fr.Fn, fr.Name, "range", "LINE_OUT_OF_RANGE"
+		if inl := fr.inlinedAt(lne.Address); inl != nil {
+			if inl.Fn == nil {
+				// inlined from a function we aren't checking
+				return
+			}
+			fn, name, check, rule = inl.Fn, inl.Name, "inline-range", "INLINED_LINE_OUT_OF_RANGE"
+		}
+		if !fn.contains(lne.File.Name, lne.Line) {
+			r = append(r, Finding{
+				Check:     check,
+				Rule:      rule,
+				File:      lne.File.Name,
+				Line:      lne.Line,
+				PC:        lne.Address,
+				Func:      fn.Name,
+				Instance:  instanceName(name, fn),
+				StartLine: fn.startLine,
+				EndLine:   fn.endLine,
+				IsStmt:    lne.IsStmt,
+			})
+		}
+	})
+
+	return r
+}
+
+// checkLineDirectives checks that the files referenced by the line
+// entries of the functions affected by //line directives exist and are
+// long enough.
+func checkLineDirectives(dw *dwarf.Data, funcRanges []FuncRange) []Finding {
+	if !lineDirectives {
+		return nil
+	}
+
+	var r []Finding
+
+	idx := newFuncIndex(funcRanges)
+	lineCount := make(map[string]int) // -1 if the file can't be read
+	seen := make(map[string]bool)
+
+	forEachFuncLineEntry(dw, funcRanges, func(lne *dwarf.LineEntry) {
+		if lne.EndSequence {
+			return
+		}
+		fr := getFunc(lne.Address, idx)
+		if fr == nil || !fr.Fn.adjusted || fr.inlinedAt(lne.Address) != nil {
+			return
+		}
+		name := lne.File.Name
+		n, ok := lineCount[name]
+		if !ok {
+			n = -1
+			if buf, err := os.ReadFile(name); err == nil {
+				n = bytes.Count(buf, []byte{'\n'})
+				if len(buf) > 0 && buf[len(buf)-1] != '\n' {
+					n++
+				}
+			}
+			lineCount[name] = n
+		}
+		var msg string
+		switch {
+		case n < 0:
+			msg = "file referenced by //line directive not found"
+		case lne.Line > n:
+			msg = fmt.Sprintf("line referenced by //line directive past the end of the file (%d lines)", n)
+		default:
+			return
+		}
+		key := fmt.Sprintf("%s %s:%d", fr.Name, name, lne.Line)
+		if n < 0 {
+			key = fmt.Sprintf("%s %s", fr.Name, name)
+		}
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		r = append(r, Finding{
+			Check:     "line-directive",
+			Rule:      "LINE_DIRECTIVE_TARGET_MISSING",
+			File:      name,
+			Line:      lne.Line,
+			PC:        lne.Address,
+			Func:      fr.Fn.Name,
+			Instance:  instanceName(fr.Name, fr.Fn),
+			StartLine: fr.Fn.startLine,
+			EndLine:   fr.Fn.endLine,
+			IsStmt:    lne.IsStmt,
+			Message:   msg,
+		})
+	})
+
+	return r
+}
+
+// checkPrologues checks the prologue_end and epilogue_begin markers of
+// the line table. The compiler only emits prologue_end after the stack
+// check, so functions without one are not reported, but there must never
+// be more than one and it must be on the declaration line or on the first
+// statement of the function. Epilogues must be at a return statement or at
+// the closing brace.
+func checkPrologues(dw *dwarf.Data, funcRanges []FuncRange) []Finding {
+	var r []Finding
+
+	idx := newFuncIndex(funcRanges)
+	seen := map[*FuncRange]bool{}
+
+	forEachFuncLineEntry(dw, funcRanges, func(lne *dwarf.LineEntry) {
+		if !lne.PrologueEnd && !lne.EpilogueBegin {
+			return
+		}
+		fr := getFunc(lne.Address, idx)
+		if fr == nil || fr.inlinedAt(lne.Address) != nil {
+			return
+		}
+		fn := fr.Fn
+		f := Finding{
+			File:      lne.File.Name,
+			Line:      lne.Line,
+			PC:        lne.Address,
+			Func:      fn.Name,
+			Instance:  instanceName(fr.Name, fn),
+			StartLine: fn.startLine,
+			EndLine:   fn.endLine,
+			IsStmt:    lne.IsStmt,
+		}
+		if lne.PrologueEnd {
+			f.Check = "prologue"
+			switch {
+			case seen[fr]:
+				f.Rule = "PROLOGUE_DUPLICATE"
+				f.Message = "duplicate prologue_end"
+				r = append(r, f)
+			case lne.Line != fn.startLine && lne.Line != fn.openLine && lne.Line != fn.firstLine:
+				f.Rule = "PROLOGUE_MISPLACED"
+				f.Message = fmt.Sprintf("prologue_end not on first statement (line %d)", fn.firstLine)
+				r = append(r, f)
+			}
+			seen[fr] = true
+		}
+		if lne.EpilogueBegin && lne.Line != fn.endLine && !fn.returnLines[lne.Line] {
+			f.Check = "epilogue"
+			f.Rule = "EPILOGUE_MISPLACED"
+			f.Message = "epilogue_begin not on a return or closing brace"
+			r = append(r, f)
+		}
+	})
+
+	return r
+}
+
+// checkPrePrologue checks that the instructions before prologue_end, the
+// stack check and, in instantiations of generic functions, the setup of
+// the dictionary, are on the declaration line or on the line of the
+// opening brace. A breakpoint on a line of the body must not stop before
+// the frame is set up.
+func checkPrePrologue(dw *dwarf.Data, funcRanges []FuncRange) []Finding {
+	var r []Finding
+
+	idx := newFuncIndex(funcRanges)
+	pending := map[*FuncRange][]dwarf.LineEntry{}
+	done := map[*FuncRange]bool{}
+
+	forEachFuncLineEntry(dw, funcRanges, func(lne *dwarf.LineEntry) {
+		if lne.EndSequence {
+			return
+		}
+		fr := getFunc(lne.Address, idx)
+		if fr == nil || done[fr] || fr.inlinedAt(lne.Address) != nil {
+			return
+		}
+		if !lne.PrologueEnd {
+			pending[fr] = append(pending[fr], *lne)
+			return
+		}
+		done[fr] = true
+		fn := fr.Fn
+		reported := map[int]bool{}
+		for _, e := range pending[fr] {
+			inDecl := sameFile(e.File.Name, fn.file) && (e.Line == fn.startLine || e.Line == fn.openLine)
+			if inDecl || reported[e.Line] {
+				continue
+			}
+			reported[e.Line] = true
+			what := "the prologue"
+			if fn.generic {
+				what = "the prologue, where the dictionary is loaded,"
+			}
+			r = append(r, Finding{
+				Check:     "pre-prologue",
+				Rule:      "PROLOGUE_BODY_LINE",
+				File:      e.File.Name,
+				Line:      e.Line,
+				PC:        e.Address,
+				Func:      fn.Name,
+				Instance:  instanceName(fr.Name, fn),
+				StartLine: fn.startLine,
+				EndLine:   fn.endLine,
+				IsStmt:    e.IsStmt,
+				Message:   fmt.Sprintf("instruction of %s attributed to line %d instead of the declaration (line %d)", what, e.Line, fn.startLine),
+			})
+		}
+		delete(pending, fr)
+	})
+
+	return r
+}
+
+// forEachLineEntry calls fn for every entry of the line tables of all
+// compile units in dw.
+func forEachLineEntry(dw *dwarf.Data, fn func(lne *dwarf.LineEntry)) {
+	rdr := dw.Reader()
+
+	for {
+		e, err := rdr.Next()
+		mustDecode(err)
+		if e == nil {
+			break
+		}
+		if e.Tag != dwarf.TagCompileUnit {
+			continue
+		}
+		rdr.SkipChildren()
+		if !isGoCompileUnit(e) {
+			continue
+		}
+		mustDecode(forEachCULineEntry(dw, withSkeleton(dw, e), fn))
+	}
+}
+
+// forEachFuncLineEntry calls fn for every entry of the line tables of the
+// compile units containing funcRanges, the entries of the functions can't
+// be anywhere else.
+func forEachFuncLineEntry(dw *dwarf.Data, funcRanges []FuncRange, fn func(lne *dwarf.LineEntry)) {
+	for _, cu := range funcCompileUnits(funcRanges) {
+		mustDecode(forEachCULineEntry(dw, cu, fn))
+	}
+}
+
+// funcCompileUnits returns the compile units containing funcRanges.
+func funcCompileUnits(funcRanges []FuncRange) []*dwarf.Entry {
+	var cus []*dwarf.Entry
+	seen := make(map[dwarf.Offset]bool)
+	for i := range funcRanges {
+		if cu := funcRanges[i].CU; cu != nil && !seen[cu.Offset] {
+			seen[cu.Offset] = true
+			cus = append(cus, cu)
+		}
+	}
+	sort.Slice(cus, func(i, j int) bool { return cus[i].Offset < cus[j].Offset })
+	return cus
+}
+
+// forEachCULineEntry calls fn for every entry of the line table of compile
+// unit cu, reading them one at a time, until one can't be read.
+func forEachCULineEntry(dw *dwarf.Data, cu *dwarf.Entry, fn func(lne *dwarf.LineEntry)) error {
+	lnrdr, err := dw.LineReader(cu)
+	if err != nil || lnrdr == nil {
+		return err
+	}
+	var lne dwarf.LineEntry
+	for {
+		err := lnrdr.Next(&lne)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fn(&lne)
+	}
+}
+
+// checkDecls checks that the declaration coordinates of each function
+// match the position of its declaration in the source. The abstract
+// subprograms of inlined functions have no DW_AT_decl_file, their concrete
+// copies aren't checked against the file.
+func checkDecls(dw *dwarf.Data, funcRanges []FuncRange) []Finding {
+	var r []Finding
+	for _, fr := range funcRanges {
+		fn := fr.Fn
+		f := Finding{
+			File:      fr.DeclFile,
+			Line:      fr.DeclLine,
+			PC:        fr.lowpc(),
+			Func:      fn.Name,
+			Instance:  instanceName(fr.Name, fn),
+			StartLine: fn.startLine,
+			EndLine:   fn.endLine,
+		}
+		if fr.DeclLine != fn.startLine {
+			f.Check = "decl-line"
+			f.Rule = "DECL_LINE_MISMATCH"
+			r = append(r, f)
+		}
+		switch {
+		case fr.DeclFile == "":
+			if _, concrete := subprogramOrigin(dw, fr.Offset); !concrete {
+				f.Check = "decl-file"
+				f.Rule = "DECL_FILE_MISSING"
+				f.File = fn.file
+				f.Message = "subprogram has no DW_AT_decl_file"
+				r = append(r, f)
+			}
+		case !sameFile(fr.DeclFile, fn.file):
+			f.Check = "decl-file"
+			f.Rule = "DECL_FILE_MISMATCH"
+			r = append(r, f)
+		}
+	}
+	return r
+}
+
+// instanceName returns name, the name of an instantiation of generic
+// function fn, or the empty string if fn isn't generic.
+func instanceName(name string, fn *Func) string {
+	if name == fn.Name {
+		return ""
+	}
+	return name
+}
+
+// sameFile returns true if the file name a from the debug info refers to
+// the source file b.
+func sameFile(a, b string) bool {
+	return filepath.ToSlash(filepath.Clean(a)) == filepath.ToSlash(filepath.Clean(b))
+}
+
+// checkInlinedCalls checks that the call site of each inlined call is
+// inside the function containing it.
+func checkInlinedCalls(funcRanges []FuncRange) []Finding {
+	var r []Finding
+	for _, fr := range funcRanges {
+		for _, inl := range fr.Inlined {
+			if inl.Caller == nil {
+				continue
+			}
+			if !inl.Caller.contains(inl.CallFile, inl.CallLine) {
+				r = append(r, Finding{
+					Check:     "inline-call",
+					Rule:      "CALL_LINE_OUT_OF_RANGE",
+					File:      inl.CallFile,
+					Line:      inl.CallLine,
+					PC:        inl.Rngs[0][0],
+					Func:      inl.Caller.Name,
+					Instance:  instanceName(inl.CallerName, inl.Caller),
+					StartLine: inl.Caller.startLine,
+					EndLine:   inl.Caller.endLine,
+				})
+			}
+		}
+	}
+	return r
+}
+
+// funcIndex maps the address ranges of the checked functions to their
+// FuncRange, sorted by start address.
+type funcIndex []funcIndexEntry
+
+type funcIndexEntry struct {
+	rng [2]uint64
+	fr  *FuncRange
+}
+
+func newFuncIndex(funcRanges []FuncRange) funcIndex {
+	var idx funcIndex
+	for i := range funcRanges {
+		for _, rng := range funcRanges[i].Rngs {
+			idx = append(idx, funcIndexEntry{rng, &funcRanges[i]})
+		}
+	}
+	sort.Slice(idx, func(i, j int) bool { return idx[i].rng[0] < idx[j].rng[0] })
+	return idx
+}
+
+func getFunc(pc uint64, idx funcIndex) *FuncRange {
+	// find the last range starting at or before pc
+	i := sort.Search(len(idx), func(i int) bool { return idx[i].rng[0] > pc }) - 1
+	if i >= 0 && pc < idx[i].rng[1] {
+		return idx[i].fr
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"debug/dwarf"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// BenchmarkGetFunc looks up the function of every line entry of the
+// program generated by the bench subcommand with its default size.
+func BenchmarkGetFunc(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "main.go")
+	if err := os.WriteFile(path, benchProgram(500), 0666); err != nil {
+		b.Fatal(err)
+	}
+	funcs := make(map[string]*Func)
+	if err := getLineRanges([]string{path}, "main", funcs); err != nil {
+		b.Fatal(err)
+	}
+	file, err := build(context.Background(), goCommand, "", argInput(path))
+	if err != nil {
+		b.Skipf("could not build the program: %v", err)
+	}
+	defer file.Close()
+	dw, err := file.DWARF()
+	if err != nil {
+		b.Fatal(err)
+	}
+	funcRanges, _ := getPCRanges(dw, funcs)
+	var pcs []uint64
+	forEachLineEntry(dw, func(lne *dwarf.LineEntry) {
+		pcs = append(pcs, lne.Address)
+	})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx := newFuncIndex(funcRanges)
+		for _, pc := range pcs {
+			getFunc(pc, idx)
+		}
+	}
+	b.ReportMetric(float64(len(pcs)), "lookups/op")
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// checkFileTable checks the file table of the line table of package
+// pkgpath: the files used by line entries must exist, no file can be
+// listed twice and, if the table has MD5 checksums, they must match the
+// contents of the files.
+func checkFileTable(dw *dwarf.Data, file Dwarfable, pkgpath string) []Finding {
+	cu := compileUnit(dw, pkgpath)
+	if cu == nil {
+		return nil
+	}
+	lnrdr, err := dw.LineReader(cu)
+	mustDecode(err)
+	if lnrdr == nil {
+		return nil
+	}
+	files := lnrdr.Files()
+
+	var r []Finding
+	finding := func(rule, name, format string, args ...interface{}) {
+		r = append(r, Finding{
+			Check:   "file-table",
+			Rule:    rule,
+			File:    name,
+			Func:    pkgpath,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	seen := make(map[string]bool)
+	for _, f := range files {
+		if f == nil {
+			continue
+		}
+		if seen[f.Name] {
+			finding("FILE_DUPLICATE", f.Name, "listed more than once in the file table")
+		}
+		seen[f.Name] = true
+	}
+
+	used := make(map[*dwarf.LineFile]bool)
+	var lne dwarf.LineEntry
+	for lnrdr.Next(&lne) == nil {
+		used[lne.File] = true
+	}
+
+	compDir, _ := cu.Val(dwarf.AttrCompDir).(string)
+	var md5s [][]byte
+	if off, ok := cu.Val(dwarf.AttrStmtList).(int64); ok {
+		md5s = lineTableMD5s(debugSection(file, "line"), off, dw.Reader().ByteOrder())
+	}
+
+	for i, f := range files {
+		if f == nil || !used[f] || f.Name == "<autogenerated>" || f.Name == "?" || strings.HasPrefix(baseName(f.Name), "_cgo_") || baseName(f.Name) == libTestName {
+			// files generated by cgo are deleted after the build, the
+			// test file of libraries only exists in the overlay
+			continue
+		}
+		path := f.Name
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(compDir, path)
+		}
+		buf, err := os.ReadFile(path)
+		if err != nil && !filepath.IsAbs(f.Name) {
+			// -trimpath executables use import paths for the standard
+			// library and only the base name for command-line-arguments
+			buf, err = os.ReadFile(filepath.Join(goroot(), "src", f.Name))
+			if err != nil && srcDir != "" {
+				buf, err = os.ReadFile(filepath.Join(srcDir, baseName(f.Name)))
+			}
+		}
+		if err != nil {
+			finding("FILE_MISSING", f.Name, "file not found")
+			continue
+		}
+		if i < len(md5s) && md5s[i] != nil {
+			if sum := md5.Sum(buf); !bytes.Equal(sum[:], md5s[i]) {
+				finding("FILE_CHECKSUM_MISMATCH", f.Name, "MD5 checksum %x doesn't match the contents of the file (%x)", md5s[i], sum)
+			}
+		}
+	}
+
+	return r
+}
+
+// goroot returns the GOROOT of the go command.
+var goroot = sync.OnceValue(func() string {
+	out, err := goCmd(context.Background(), goCommand, nil, "env", "GOROOT").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+})
+
+// DWARF 5 line number header content types and forms
+const (
+	lnctPath     = 0x1
+	lnctMD5      = 0x5
+	formBlock    = 0x09
+	formData1    = 0x0b
+	formData2    = 0x05
+	formData4    = 0x06
+	formData8    = 0x07
+	formData16   = 0x1e
+	formString   = 0x08
+	formStrp     = 0x0e
+	formUdata    = 0x0f
+	formLineStrp = 0x1f
+)
+
+// lineTableMD5s returns the MD5 checksums in the file table of the line
+// table at offset off of data, the contents of .debug_line, indexed like
+// the files returned by LineReader.Files. It returns nil for line tables
+// older than DWARF 5 or without checksums, debug/dwarf doesn't expose
+// them.
+func lineTableMD5s(data []byte, off int64, order binary.ByteOrder) [][]byte {
+	if off < 0 || off >= int64(len(data)) {
+		return nil
+	}
+	b := &dbuf{data: data, off: int(off), order: order}
+
+	offSize := 4
+	if b.u32() == 0xffffffff {
+		offSize = 8
+		b.bytes(8)
+	}
+	if b.u16() < 5 {
+		return nil
+	}
+	b.bytes(2) // address_size, segment_selector_size
+	b.bytes(offSize)
+	b.bytes(5) // minimum_instruction_length ... line_range
+	b.bytes(int(b.u8()) - 1)
+
+	// skipForm skips a value of form and returns it if it's a block
+	skipForm := func(form uint64) []byte {
+		switch form {
+		case formBlock:
+			return b.bytes(int(b.uleb()))
+		case formData1:
+			b.bytes(1)
+		case formData2:
+			b.bytes(2)
+		case formData4:
+			b.bytes(4)
+		case formData8:
+			b.bytes(8)
+		case formData16:
+			return b.bytes(16)
+		case formString:
+			for b.err == nil && b.u8() != 0 {
+			}
+		case formStrp, formLineStrp:
+			b.bytes(offSize)
+		case formUdata:
+			b.uleb()
+		default:
+			b.err = fmt.Errorf("unsupported form %#x in line table header", form)
+		}
+		return nil
+	}
+
+	// entries reads a directory or file name table, returning the values
+	// of content type want
+	entries := func(want uint64) [][]byte {
+		var format [][2]uint64
+		for n := b.u8(); n > 0 && b.err == nil; n-- {
+			format = append(format, [2]uint64{b.uleb(), b.uleb()})
+		}
+		var r [][]byte
+		for n := b.uleb(); n > 0 && b.err == nil; n-- {
+			var v []byte
+			for _, f := range format {
+				if x := skipForm(f[1]); f[0] == want {
+					v = x
+				}
+			}
+			r = append(r, v)
+		}
+		return r
+	}
+
+	entries(lnctPath)
+	md5s := entries(lnctMD5)
+	if b.err != nil {
+		return nil
+	}
+	for _, sum := range md5s {
+		if sum != nil {
+			return md5s
+		}
+	}
+	return nil
+}
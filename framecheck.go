@@ -0,0 +1,415 @@
+package main
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// fde is a frame description entry of .debug_frame or .eh_frame.
+type fde struct {
+	start, end uint64
+	cie        *cie
+	insts      []byte
+	err        error // error decoding the entry
+}
+
+// cie is a common information entry of .debug_frame or .eh_frame.
+type cie struct {
+	codeAlign uint64
+	dataAlign int64
+	insts     []byte
+	ptrEnc    byte // encoding of the addresses in the FDEs (.eh_frame only)
+	order     binary.ByteOrder
+}
+
+// checkFrames checks that each function is covered by exactly one FDE,
+// whose range matches the range of its subprogram, and that the CFA rules
+// of the FDE can be decoded and define the CFA at every PC.
+func checkFrames(dw *dwarf.Data, file Dwarfable, funcRanges []FuncRange) []Finding {
+	rdr := dw.Reader()
+	fdes := readFrames(debugSection(file, "frame"), false, 0, rdr.ByteOrder(), rdr.AddressSize())
+	if fdes == nil {
+		if s := ehFrame(file); s != nil {
+			data, _ := s.Data()
+			fdes = readFrames(data, true, s.Addr, rdr.ByteOrder(), rdr.AddressSize())
+		}
+	}
+	if fdes == nil {
+		return nil
+	}
+	sort.Slice(fdes, func(i, j int) bool { return fdes[i].start < fdes[j].start })
+
+	var r []Finding
+	for i := range funcRanges {
+		fr := &funcRanges[i]
+		finding := func(rule string, pc uint64, format string, args ...interface{}) {
+			r = append(r, Finding{
+				Check:     "cfi",
+				Rule:      rule,
+				File:      fr.Fn.file,
+				Line:      fr.Fn.startLine,
+				PC:        pc,
+				Func:      fr.Fn.Name,
+				Instance:  instanceName(fr.Name, fr.Fn),
+				StartLine: fr.Fn.startLine,
+				EndLine:   fr.Fn.endLine,
+				Message:   fmt.Sprintf(format, args...),
+			})
+		}
+
+		lowpc, highpc := fr.lowpc(), fr.Rngs[len(fr.Rngs)-1][1]
+		j := sort.Search(len(fdes), func(j int) bool { return fdes[j].end > lowpc })
+		var covering []*fde
+		for ; j < len(fdes) && fdes[j].start < highpc; j++ {
+			covering = append(covering, &fdes[j])
+		}
+
+		switch {
+		case len(covering) == 0:
+			finding("FDE_MISSING", lowpc, "no FDE covers the function")
+			continue
+		case len(covering) > 1:
+			finding("FDE_MISMATCH", lowpc, "covered by %d FDEs", len(covering))
+		}
+		f := covering[0]
+		if f.start != lowpc || f.end != highpc {
+			finding("FDE_MISMATCH", f.start, "FDE range %#x-%#x doesn't match the function range %#x-%#x", f.start, f.end, lowpc, highpc)
+		}
+		if f.err != nil {
+			finding("FDE_MISMATCH", f.start, "%v", f.err)
+			continue
+		}
+		if pc, err := runCFA(f); err != nil {
+			finding("FDE_MISMATCH", pc, "%v", err)
+		}
+	}
+	return r
+}
+
+// ehFrame returns the .eh_frame section of file, used when there is no
+// .debug_frame section.
+func ehFrame(file Dwarfable) *elf.Section {
+	switch f := file.(type) {
+	case *builtBinary:
+		return ehFrame(f.Dwarfable)
+	case *splitBinary:
+		return ehFrame(f.Dwarfable)
+	case *detachedBinary:
+		return ehFrame(f.Dwarfable)
+	case *elf.File:
+		return f.Section(".eh_frame")
+	}
+	return nil
+}
+
+// readFrames reads the FDEs in data, the contents of .debug_frame or, if
+// eh is set, of .eh_frame loaded at address addr.
+func readFrames(data []byte, eh bool, addr uint64, order binary.ByteOrder, addrSize int) []fde {
+	if len(data) == 0 {
+		return nil
+	}
+	cies := make(map[int]*cie)
+	var r []fde
+	b := &dbuf{data: data, order: order}
+	for b.off < len(data) && b.err == nil {
+		start := b.off
+		length, offSize := uint64(b.u32()), 4
+		if length == 0xffffffff {
+			length, offSize = b.addr(8), 8
+		}
+		if b.err != nil {
+			break
+		}
+		if length == 0 {
+			if eh {
+				// terminator
+				break
+			}
+			continue
+		}
+		end := b.off + int(length)
+		if length > uint64(len(data)) || end > len(data) {
+			break
+		}
+		idOff := b.off
+		id := b.addr(offSize)
+		isCIE := id == 0
+		if !eh {
+			isCIE = offSize == 4 && id == 0xffffffff || offSize == 8 && id == ^uint64(0)
+		}
+		if isCIE {
+			cies[start] = readCIE(&dbuf{data: data[:end], off: b.off, order: order}, eh, addrSize)
+		} else {
+			ciePos := int(id)
+			if eh {
+				ciePos = idOff - int(id)
+			}
+			r = append(r, readFDE(&dbuf{data: data[:end], off: b.off, order: order}, cies[ciePos], eh, addr, addrSize))
+		}
+		b.off = end
+	}
+	return r
+}
+
+// readCIE reads the body of a CIE, after its id.
+func readCIE(b *dbuf, eh bool, addrSize int) *cie {
+	c := &cie{order: b.order}
+	version := b.u8()
+	var aug []byte
+	for x := b.u8(); x != 0 && b.err == nil; x = b.u8() {
+		aug = append(aug, x)
+	}
+	if version >= 4 {
+		b.bytes(2) // address_size, segment_selector_size
+	}
+	c.codeAlign = b.uleb()
+	c.dataAlign = b.sleb()
+	if version == 1 {
+		b.u8()
+	} else {
+		b.uleb()
+	}
+	if eh && len(aug) > 0 && aug[0] == 'z' {
+		n := b.uleb()
+		augEnd := b.off + int(n)
+		for _, a := range aug[1:] {
+			switch a {
+			case 'R':
+				c.ptrEnc = b.u8()
+			case 'L':
+				b.u8()
+			case 'P':
+				readEncoded(b, b.u8(), 0, addrSize)
+			}
+		}
+		b.off = augEnd
+	}
+	if b.err != nil {
+		return nil
+	}
+	c.insts = b.data[b.off:]
+	return c
+}
+
+// readFDE reads the body of a FDE, after its CIE pointer.
+func readFDE(b *dbuf, c *cie, eh bool, addr uint64, addrSize int) fde {
+	if c == nil {
+		return fde{err: fmt.Errorf("FDE at %#x refers to a missing CIE", b.off)}
+	}
+	var f fde
+	f.cie = c
+	if eh {
+		f.start = readEncoded(b, c.ptrEnc, addr, addrSize)
+		f.end = f.start + readEncoded(b, c.ptrEnc&0xf, addr, addrSize)
+		b.bytes(int(b.uleb())) // augmentation data
+	} else {
+		f.start = b.addr(addrSize)
+		f.end = f.start + b.addr(addrSize)
+	}
+	if b.err != nil {
+		f.err = fmt.Errorf("truncated FDE")
+		return f
+	}
+	f.insts = b.data[b.off:]
+	return f
+}
+
+// pointer encodings used by .eh_frame
+const (
+	dwEhPeAbsptr  = 0x00
+	dwEhPeUleb128 = 0x01
+	dwEhPeUdata2  = 0x02
+	dwEhPeUdata4  = 0x03
+	dwEhPeUdata8  = 0x04
+	dwEhPeSleb128 = 0x09
+	dwEhPeSdata2  = 0x0a
+	dwEhPeSdata4  = 0x0b
+	dwEhPeSdata8  = 0x0c
+	dwEhPePcrel   = 0x10
+)
+
+// readEncoded reads a pointer with encoding enc, from a section loaded at
+// address addr.
+func readEncoded(b *dbuf, enc byte, addr uint64, addrSize int) uint64 {
+	pos := addr + uint64(b.off)
+	var v uint64
+	switch enc & 0xf {
+	case dwEhPeAbsptr:
+		v = b.addr(addrSize)
+	case dwEhPeUleb128:
+		v = b.uleb()
+	case dwEhPeUdata2:
+		v = uint64(b.u16())
+	case dwEhPeUdata4:
+		v = uint64(b.u32())
+	case dwEhPeUdata8:
+		v = b.addr(8)
+	case dwEhPeSleb128:
+		v = uint64(b.sleb())
+	case dwEhPeSdata2:
+		v = uint64(int16(b.u16()))
+	case dwEhPeSdata4:
+		v = uint64(int32(b.u32()))
+	case dwEhPeSdata8:
+		v = b.addr(8)
+	default:
+		b.err = fmt.Errorf("unsupported pointer encoding %#x", enc)
+	}
+	if enc&0x70 == dwEhPePcrel {
+		v += pos
+	}
+	return v
+}
+
+// call frame instructions
+const (
+	dwCfaAdvanceLoc        = 0x40
+	dwCfaOffset            = 0x80
+	dwCfaRestore           = 0xc0
+	dwCfaNop               = 0x00
+	dwCfaSetLoc            = 0x01
+	dwCfaAdvanceLoc1       = 0x02
+	dwCfaAdvanceLoc2       = 0x03
+	dwCfaAdvanceLoc4       = 0x04
+	dwCfaOffsetExtended    = 0x05
+	dwCfaRestoreExtended   = 0x06
+	dwCfaUndefined         = 0x07
+	dwCfaSameValue         = 0x08
+	dwCfaRegister          = 0x09
+	dwCfaRememberState     = 0x0a
+	dwCfaRestoreState      = 0x0b
+	dwCfaDefCfa            = 0x0c
+	dwCfaDefCfaRegister    = 0x0d
+	dwCfaDefCfaOffset      = 0x0e
+	dwCfaDefCfaExpression  = 0x0f
+	dwCfaExpression        = 0x10
+	dwCfaOffsetExtendedSf  = 0x11
+	dwCfaDefCfaSf          = 0x12
+	dwCfaDefCfaOffsetSf    = 0x13
+	dwCfaValOffset         = 0x14
+	dwCfaValOffsetSf       = 0x15
+	dwCfaValExpression     = 0x16
+	dwCfaGNUArgsSize       = 0x2e
+	dwCfaGNUNegOffsetExtnd = 0x2f
+)
+
+// runCFA executes the instructions of the CIE and of f and returns the
+// first PC where the CFA rule can't be decoded or isn't defined.
+func runCFA(f *fde) (uint64, error) {
+	type cfaRule struct {
+		defined  bool // the CFA is defined
+		register bool // the CFA is a register plus an offset
+	}
+
+	pc := f.start
+	var cur cfaRule
+	var stack []cfaRule
+
+	// advance moves to PC to, checking the row that ends there
+	advance := func(to uint64) error {
+		if to < pc || to > f.end {
+			return fmt.Errorf("advance to %#x outside of the FDE", to)
+		}
+		if to > pc && !cur.defined {
+			return fmt.Errorf("CFA not defined")
+		}
+		pc = to
+		return nil
+	}
+
+	run := func(insts []byte) error {
+		b := &dbuf{data: insts, order: f.cie.order}
+		for b.off < len(insts) {
+			op := b.u8()
+			var err error
+			switch op & 0xc0 {
+			case dwCfaAdvanceLoc:
+				err = advance(pc + uint64(op&0x3f)*f.cie.codeAlign)
+			case dwCfaOffset:
+				b.uleb()
+			case dwCfaRestore:
+			default:
+				switch op {
+				case dwCfaNop:
+				case dwCfaRememberState:
+					stack = append(stack, cur)
+				case dwCfaRestoreState:
+					if len(stack) == 0 {
+						err = fmt.Errorf("DW_CFA_restore_state without DW_CFA_remember_state")
+						break
+					}
+					cur = stack[len(stack)-1]
+					stack = stack[:len(stack)-1]
+				case dwCfaSetLoc:
+					err = fmt.Errorf("DW_CFA_set_loc not supported")
+				case dwCfaAdvanceLoc1:
+					err = advance(pc + uint64(b.u8())*f.cie.codeAlign)
+				case dwCfaAdvanceLoc2:
+					err = advance(pc + uint64(b.u16())*f.cie.codeAlign)
+				case dwCfaAdvanceLoc4:
+					err = advance(pc + uint64(b.u32())*f.cie.codeAlign)
+				case dwCfaOffsetExtended, dwCfaRegister, dwCfaValOffset:
+					b.uleb()
+					b.uleb()
+				case dwCfaOffsetExtendedSf, dwCfaValOffsetSf, dwCfaGNUNegOffsetExtnd:
+					b.uleb()
+					b.sleb()
+				case dwCfaRestoreExtended, dwCfaUndefined, dwCfaSameValue, dwCfaGNUArgsSize:
+					b.uleb()
+				case dwCfaDefCfa:
+					b.uleb()
+					b.uleb()
+					cur = cfaRule{true, true}
+				case dwCfaDefCfaSf:
+					b.uleb()
+					b.sleb()
+					cur = cfaRule{true, true}
+				case dwCfaDefCfaRegister:
+					b.uleb()
+					if !cur.register {
+						err = fmt.Errorf("DW_CFA_def_cfa_register without a register CFA rule")
+					}
+				case dwCfaDefCfaOffset:
+					b.uleb()
+					if !cur.register {
+						err = fmt.Errorf("DW_CFA_def_cfa_offset without a register CFA rule")
+					}
+				case dwCfaDefCfaOffsetSf:
+					b.sleb()
+					if !cur.register {
+						err = fmt.Errorf("DW_CFA_def_cfa_offset_sf without a register CFA rule")
+					}
+				case dwCfaDefCfaExpression:
+					b.bytes(int(b.uleb()))
+					cur = cfaRule{true, false}
+				case dwCfaExpression, dwCfaValExpression:
+					b.uleb()
+					b.bytes(int(b.uleb()))
+				default:
+					err = fmt.Errorf("unknown call frame instruction %#x", op)
+				}
+			}
+			if b.err != nil {
+				return fmt.Errorf("truncated call frame instructions")
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := run(f.cie.insts); err != nil {
+		return pc, fmt.Errorf("CIE: %v", err)
+	}
+	if err := run(f.insts); err != nil {
+		return pc, err
+	}
+	if err := advance(f.end); err != nil {
+		return pc, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"go/format"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// unconfirmedRules are the rules of heuristic checks, whose findings are
+// often not bugs. The gen subcommand only saves their findings after the
+// user confirms them, with -confirm.
+var unconfirmedRules = map[string]bool{
+	"STMT_WITHOUT_ENTRY":   true,
+	"LINE_DENSITY_ANOMALY": true,
+}
+
+// genMain implements the gen subcommand: it checks random programs using
+// generics and saves a minimized reproducer for the first finding of each
+// rule. It returns the exit status.
+func genMain(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("gen", flag.ExitOnError)
+	n := fs.Int("n", 100, "number of programs generated, 0 to run until interrupted")
+	seed := fs.Int64("seed", 0, "seed of the first program, the following ones use the next seeds; 0 for the current time")
+	outDir := fs.String("o", "gen-findings", "directory the reproducers are saved to")
+	doMinimize := fs.Bool("minimize", true, "minimize the reproducers")
+	confirm := fs.Bool("confirm", false, "ask whether to save the findings of heuristic checks instead of discarding them")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: badlngenerics [flags] gen [-n count] [-seed n] [-o dir] [-minimize=false] [-confirm]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitError
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	if err := os.MkdirAll(*outDir, 0777); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	dir, err := os.MkdirTemp("", "badlngenerics-gen-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer os.RemoveAll(dir)
+
+	stdin := bufio.NewScanner(os.Stdin)
+	status := exitClean
+	saved := make(map[string]bool) // rules with a reproducer
+	for i := 0; (*n == 0 || i < *n) && ctx.Err() == nil; i++ {
+		s := *seed + int64(i)
+		src := genProgram(rand.New(rand.NewSource(s)))
+		path := filepath.Join(dir, "main.go")
+		if err := os.WriteFile(path, src, 0666); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		out := checkInput(ctx, argInput(path), [2]string{})
+		if ctx.Err() != nil {
+			break
+		}
+		if out.failed {
+			// the generator should only produce valid programs
+			name := filepath.Join(*outDir, fmt.Sprintf("failed-%d.go", s))
+			os.WriteFile(name, src, 0666)
+			fmt.Printf("seed %d: program could not be checked, saved to %s\n%s", s, name, out.String())
+			status = exitError
+			continue
+		}
+		for _, f := range out.findings {
+			if saved[f.Rule] {
+				continue
+			}
+			if unconfirmedRules[f.Rule] && !(*confirm && confirmFinding(stdin, src, f)) {
+				logger.Info("unconfirmed finding discarded", "seed", s, "rule", f.Rule, "func", f.Func)
+				continue
+			}
+			saved[f.Rule] = true
+			if status == exitClean {
+				status = exitFindings
+			}
+			repro := src
+			if *doMinimize {
+				key := minimizeKey(f)
+				repro = minimize(ctx, src, func(src []byte) bool {
+					return reproduces(ctx, "main.go", src, key, [2]string{})
+				})
+			}
+			name := filepath.Join(*outDir, fmt.Sprintf("%s-%d.go", f.Rule, s))
+			header := fmt.Sprintf("// badlngenerics gen -seed %d: %s %s %s\n\n", s, f.Rule, f.Func, f.Message)
+			if err := os.WriteFile(name, append([]byte(header), repro...), 0666); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitError
+			}
+			fmt.Printf("seed %d: %s in %s, saved to %s\n", s, f.Rule, f.Func, name)
+		}
+		logger.Info("generated program checked", "seed", s, "findings", len(out.findings))
+	}
+	return status
+}
+
+// confirmFinding prints the finding f of the program src and asks the user
+// whether it's a bug, reading the answer from in.
+func confirmFinding(in *bufio.Scanner, src []byte, f Finding) bool {
+	lines := strings.Split(string(src), "\n")
+	fmt.Println(findingText(f))
+	for i := max(f.Line-3, 1); i <= min(f.Line+3, len(lines)); i++ {
+		mark := "  "
+		if i == f.Line {
+			mark = "=>"
+		}
+		fmt.Printf("\t%s %4d %s\n", mark, i, lines[i-1])
+	}
+	fmt.Print("is it a bug? [y/N] ")
+	if !in.Scan() {
+		fmt.Println()
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(in.Text()))
+	return answer == "y" || answer == "yes"
+}
+
+// genShapes are the types generic functions are instantiated with, with a
+// value of each.
+var genShapes = []struct {
+	typ, val   string
+	comparable bool
+}{
+	{"int", "1", true},
+	{"uint8", "2", true},
+	{"string", `"s"`, true},
+	{"float64", "1.5", true},
+	{"[]byte", `[]byte("b")`, false},
+	{"*int", "new(int)", true},
+	{"struct{ a, b int }", "struct{ a, b int }{1, 2}", true},
+	{"[2]string", `[2]string{"a", "b"}`, true},
+	{"P", `P{1, "p"}`, true},
+	{"any", "any(1)", true},
+	{"func() int", "func() int { return 1 }", false},
+}
+
+// genVar is a variable in scope in a generated function.
+type genVar struct {
+	name, typ  string
+	comparable bool
+}
+
+// genFunc is a generated generic function.
+type genFunc struct {
+	name       string
+	comparable []bool // constraint of each type parameter
+}
+
+type progGen struct {
+	r     *rand.Rand
+	b     strings.Builder
+	funcs []genFunc
+	n     int
+}
+
+// genProgram returns a random program with generic functions and types,
+// using closures, loops, deferred calls and range-over-func loops inside
+// them, instantiated with different shapes.
+func genProgram(r *rand.Rand) []byte {
+	g := &progGen{r: r}
+	g.printf("package main\n\nimport \"fmt\"\n\n")
+	g.printf("type P struct {\n\tx int\n\ts string\n}\n\n")
+	g.printf("func Seq[T any](v T) func(func(T) bool) {\n\treturn func(yield func(T) bool) {\n\t\tif !yield(v) {\n\t\t\treturn\n\t\t}\n\t\tyield(v)\n\t}\n}\n\n")
+	g.printf("type List[T any] []T\n\nfunc (l List[T]) Each(f func(T)) {\n\tfor _, e := range l {\n\t\tf(e)\n\t}\n}\n\n")
+
+	g.printf("type Box[T any] struct {\n\tv T\n\tn int\n}\n\n")
+	g.printf("func (b *Box[T]) Get() T {\n\tv := b.v\n\tn := b.n\n")
+	g.stmts("\t", []genVar{{"v", "T", false}}, 0, 2+g.r.Intn(4))
+	g.printf("\tb.n = n\n\treturn v\n}\n\n")
+	g.printf("func (b Box[T]) With(v T) Box[T] {\n\tb.v = v\n\treturn b\n}\n\n")
+
+	for i, nf := 0, 2+g.r.Intn(4); i < nf; i++ {
+		fn := genFunc{name: fmt.Sprintf("F%d", i)}
+		var tparams, params []string
+		var vars []genVar
+		for j, nt := 0, 1+g.r.Intn(2); j < nt; j++ {
+			cmp := g.r.Intn(2) == 0
+			tp, v := []string{"T", "U"}[j], []string{"x", "y"}[j]
+			constraint := "any"
+			if cmp {
+				constraint = "comparable"
+			}
+			fn.comparable = append(fn.comparable, cmp)
+			tparams = append(tparams, tp+" "+constraint)
+			params = append(params, v+" "+tp)
+			vars = append(vars, genVar{v, tp, cmp})
+		}
+		g.printf("func %s[%s](%s, n int) T {\n", fn.name, strings.Join(tparams, ", "), strings.Join(params, ", "))
+		g.stmts("\t", vars, 0, 3+g.r.Intn(6))
+		g.printf("\treturn x\n}\n\n")
+		g.funcs = append(g.funcs, fn)
+	}
+
+	g.printf("func main() {\n")
+	for _, fn := range g.funcs {
+		for k, ni := 0, 1+g.r.Intn(3); k < ni; k++ {
+			var targs, args []string
+			for _, cmp := range fn.comparable {
+				s := genShapes[g.r.Intn(len(genShapes))]
+				for cmp && !s.comparable {
+					s = genShapes[g.r.Intn(len(genShapes))]
+				}
+				targs = append(targs, s.typ)
+				args = append(args, s.val)
+			}
+			g.printf("\tfmt.Println(%s[%s](%s, %d))\n", fn.name, strings.Join(targs, ", "), strings.Join(args, ", "), g.r.Intn(4))
+		}
+	}
+	for k, nb := 0, 1+g.r.Intn(3); k < nb; k++ {
+		s := genShapes[g.r.Intn(len(genShapes))]
+		b := g.name("b")
+		g.printf("\t%s := &Box[%s]{v: %s}\n\tfmt.Println(%s.Get(), %s.With(%s).n)\n", b, s.typ, s.val, b, b, s.val)
+	}
+	g.printf("}\n")
+
+	src, err := format.Source([]byte(g.b.String()))
+	if err != nil {
+		panic(fmt.Sprintf("generated program doesn't parse: %v\n%s", err, g.b.String()))
+	}
+	return src
+}
+
+func (g *progGen) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.b, format, args...)
+}
+
+// name returns a new variable name starting with prefix.
+func (g *progGen) name(prefix string) string {
+	g.n++
+	return fmt.Sprintf("%s%d", prefix, g.n)
+}
+
+// stmts writes count random statements using the variables vars, all of
+// them are assignable, and the variable n of type int.
+func (g *progGen) stmts(indent string, vars []genVar, depth, count int) {
+	for i := 0; i < count; i++ {
+		v := vars[g.r.Intn(len(vars))]
+		kind := g.r.Intn(15)
+		if depth >= 2 && kind < 6 {
+			// no more nesting
+			kind += 6
+		}
+		switch kind {
+		case 0:
+			f, z := g.name("f"), g.name("z")
+			g.printf("%s%s := func(%s %s) %s {\n", indent, f, z, v.typ, v.typ)
+			g.stmts(indent+"\t", []genVar{{z, v.typ, v.comparable}}, depth+1, 1+g.r.Intn(3))
+			g.printf("%s\treturn %s\n%s}\n%s%s = %s(%s)\n", indent, z, indent, indent, v.name, f, v.name)
+		case 1:
+			iv := g.name("i")
+			g.printf("%sfor %s := 0; %s < n; %s++ {\n", indent, iv, iv, iv)
+			g.stmts(indent+"\t", vars, depth+1, 1+g.r.Intn(3))
+			g.printf("%s}\n", indent)
+		case 2:
+			s, e := g.name("s"), g.name("e")
+			g.printf("%s%s := []%s{%s, %s}\n%sfor _, %s := range %s {\n%s\t_ = %s\n", indent, s, v.typ, v.name, v.name, indent, e, s, indent, e)
+			g.stmts(indent+"\t", append(vars[:len(vars):len(vars)], genVar{e, v.typ, v.comparable}), depth+1, 1+g.r.Intn(3))
+			g.printf("%s}\n", indent)
+		case 3:
+			e := g.name("e")
+			g.printf("%sfor %s := range Seq(%s) {\n%s\t_ = %s\n", indent, e, v.name, indent, e)
+			g.stmts(indent+"\t", append(vars[:len(vars):len(vars)], genVar{e, v.typ, v.comparable}), depth+1, 1+g.r.Intn(3))
+			if g.r.Intn(2) == 0 {
+				g.printf("%s\tif n > 2 {\n%s\t\tbreak\n%s\t}\n", indent, indent, indent)
+			}
+			g.printf("%s}\n", indent)
+		case 4:
+			g.printf("%sswitch n {\n%scase 0:\n", indent, indent)
+			g.stmts(indent+"\t", vars, depth+1, 1+g.r.Intn(2))
+			g.printf("%sdefault:\n%s\tn--\n%s}\n", indent, indent, indent)
+		case 5:
+			if v.comparable {
+				g.printf("%sif %s == %s {\n", indent, v.name, v.name)
+			} else {
+				g.printf("%sif n > 1 {\n", indent)
+			}
+			g.stmts(indent+"\t", vars, depth+1, 1+g.r.Intn(2))
+			g.printf("%s}\n", indent)
+		case 6:
+			a := g.name("a")
+			g.printf("%s%s := %s\n%s_ = %s\n", indent, a, v.name, indent, a)
+		case 7:
+			m := g.name("m")
+			g.printf("%s%s := map[int]%s{0: %s}\n%s%s = %s[0]\n", indent, m, v.typ, v.name, indent, v.name, m)
+		case 8:
+			g.printf("%sdefer func() {\n%s\t_ = %s\n%s}()\n", indent, indent, v.name, indent)
+		case 9:
+			z := g.name("z")
+			g.printf("%sgo func(%s %s) {\n%s\t_ = %s\n%s}(%s)\n", indent, z, v.typ, indent, z, indent, v.name)
+		case 10:
+			b := g.name("b")
+			g.printf("%s%s := &Box[%s]{v: %s}\n%s%s = %s.Get()\n", indent, b, v.typ, v.name, indent, v.name, b)
+		case 11:
+			e := g.name("e")
+			g.printf("%sList[%s]{%s}.Each(func(%s %s) {\n%s\t_ = %s\n%s})\n", indent, v.typ, v.name, e, v.typ, indent, e, indent)
+		case 12:
+			c := g.name("c")
+			g.printf("%s%s := func() %s {\n%s\treturn %s\n%s}\n%s%s = %s()\n", indent, c, v.typ, indent, v.name, indent, indent, v.name, c)
+		case 13:
+			// call a function generated before this one
+			var callees []genFunc
+			for _, fn := range g.funcs {
+				if !fn.comparable[0] || v.comparable {
+					callees = append(callees, fn)
+				}
+			}
+			if len(callees) == 0 {
+				g.printf("%sn++\n", indent)
+				break
+			}
+			fn := callees[g.r.Intn(len(callees))]
+			args := strings.Repeat(v.name+", ", len(fn.comparable))
+			if len(fn.comparable) > 1 && fn.comparable[1] && !v.comparable {
+				args = v.name + ", 0, "
+			}
+			g.printf("%s%s = %s(%sn-1)\n", indent, v.name, fn.name, args)
+		default:
+			g.printf("%sfmt.Println(%s, n)\n", indent, v.name)
+		}
+	}
+}
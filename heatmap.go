@@ -0,0 +1,227 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// if heatmap a bar of the source lines of each function, shaded by the
+// number of line entries of each line, is printed
+var heatmap bool
+
+// if heatmapHTML is set the heatmaps of all inputs are written to it as an
+// HTML page
+var heatmapHTML string
+
+// funcHeatmap are the line entries of each source line of a function,
+// instantiations of generic functions are counted together.
+type funcHeatmap struct {
+	name, file string
+	startLine  int
+	counts     []int  // line entries of each line from startLine
+	stmt       []bool // lines with statements
+	outOfRange int    // line entries outside of the function
+}
+
+// lineHeatmaps returns the heatmaps of the functions in funcRanges, sorted
+// by name. Line entries of inlined calls belong to the inlined function
+// and aren't counted.
+func lineHeatmaps(dw *dwarf.Data, funcRanges []FuncRange) []funcHeatmap {
+	idx := newFuncIndex(funcRanges)
+	byFunc := make(map[*Func]*funcHeatmap)
+	for i := range funcRanges {
+		fn := funcRanges[i].Fn
+		if byFunc[fn] != nil {
+			continue
+		}
+		h := &funcHeatmap{name: fn.Name, file: fn.file, startLine: fn.startLine}
+		if n := fn.endLine - fn.startLine + 1; n > 0 {
+			h.counts = make([]int, n)
+			h.stmt = make([]bool, n)
+		}
+		for line := range fn.stmtLines {
+			if i := line - fn.startLine; i >= 0 && i < len(h.stmt) {
+				h.stmt[i] = true
+			}
+		}
+		byFunc[fn] = h
+	}
+
+	forEachFuncLineEntry(dw, funcRanges, func(lne *dwarf.LineEntry) {
+		if lne.EndSequence {
+			return
+		}
+		fr := getFunc(lne.Address, idx)
+		if fr == nil || fr.inlinedAt(lne.Address) != nil {
+			return
+		}
+		h := byFunc[fr.Fn]
+		if !fr.Fn.contains(lne.File.Name, lne.Line) {
+			h.outOfRange++
+			return
+		}
+		if i := lne.Line - h.startLine; sameFile(lne.File.Name, h.file) && i >= 0 && i < len(h.counts) {
+			h.counts[i]++
+		}
+	})
+
+	r := make([]funcHeatmap, 0, len(byFunc))
+	for _, h := range byFunc {
+		r = append(r, *h)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].name < r[j].name })
+	return r
+}
+
+// heatLevel returns the shade, from 0 to 4, of a line with n line entries.
+func heatLevel(n int) int {
+	switch {
+	case n == 0:
+		return 0
+	case n == 1:
+		return 1
+	case n < 4:
+		return 2
+	case n < 8:
+		return 3
+	}
+	return 4
+}
+
+// heatChars are the cells of the terminal heatmap by shade, heatMissing is
+// the cell of a line with statements and no line entries.
+var heatChars = []string{" ", "░", "▒", "▓", "█"}
+
+const heatMissing = "✗"
+
+// reportHeatmaps prints a bar for each function with a cell for each of
+// its lines, followed by a cell for the line entries outside of the
+// function. Colors are used if the output is a terminal.
+func (out *output) reportHeatmaps(heatmaps []funcHeatmap) {
+	if jsonOutput || sarifOutput || len(heatmaps) == 0 {
+		return
+	}
+	color := isTerminal(os.Stdout)
+	cell := func(level int, missing bool) string {
+		switch {
+		case missing && color:
+			return "\x1b[31m" + heatMissing + "\x1b[0m"
+		case missing:
+			return heatMissing
+		case color && level > 0:
+			return fmt.Sprintf("\x1b[38;5;%dm%s\x1b[0m", 226-6*(level-1), heatChars[level])
+		}
+		return heatChars[level]
+	}
+
+	width := 0
+	for _, h := range heatmaps {
+		width = max(width, len(h.name))
+	}
+	fmt.Fprintf(out, "line entries by line: %s none on a line with statements, %s 1, %s 2-3, %s 4-7, %s 8 or more, the last cell is outside of the function\n",
+		cell(0, true), cell(1, false), cell(2, false), cell(3, false), cell(4, false))
+	for _, h := range heatmaps {
+		var b strings.Builder
+		for i, n := range h.counts {
+			b.WriteString(cell(heatLevel(n), n == 0 && h.stmt[i]))
+		}
+		fmt.Fprintf(out, "%-*s %s:%d ▕%s▏%s", width, h.name, baseName(h.file), h.startLine, b.String(), cell(heatLevel(h.outOfRange), false))
+		if h.outOfRange > 0 {
+			fmt.Fprintf(out, " %d out of range", h.outOfRange)
+		}
+		fmt.Fprintln(out)
+	}
+}
+
+// isTerminal returns true if f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+var heatmapTemplate = template.Must(template.New("heatmap").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>badlngenerics heatmap</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; }
+td { padding: 1px 6px; white-space: nowrap; }
+.bar span { display: inline-block; width: 6px; height: 14px; }
+.l0 { background: #f4f4f4; }
+.l1 { background: #fed976; }
+.l2 { background: #fd8d3c; }
+.l3 { background: #e31a1c; }
+.l4 { background: #800026; }
+.missing { background: #3182bd; }
+.oor { margin-left: 6px; outline: 1px solid #888; }
+</style>
+</head>
+<body>
+<p>Line entries of each source line:
+<span class="bar"><span class="l0"></span></span> none,
+<span class="bar"><span class="missing"></span></span> none on a line with statements,
+<span class="bar"><span class="l1"></span></span> 1,
+<span class="bar"><span class="l2"></span></span> 2-3,
+<span class="bar"><span class="l3"></span></span> 4-7,
+<span class="bar"><span class="l4"></span></span> 8 or more.
+The last cell, outlined, counts the line entries outside of the function.</p>
+{{range .}}<h3>{{.Input}}</h3>
+<table>
+{{range .Funcs}}<tr><td>{{.Name}}</td><td>{{.File}}:{{.StartLine}}</td><td class="bar">{{range .Cells}}<span class="{{.Class}}" title="{{.Title}}"></span>{{end}}<span class="oor l{{.OutOfRangeLevel}}" title="{{.OutOfRange}} line entries out of range"></span></td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+// writeHeatmapHTML writes the heatmaps of each input as an HTML page.
+func writeHeatmapHTML(w io.Writer, inputs []string, heatmaps [][]funcHeatmap) error {
+	type cell struct{ Class, Title string }
+	type htmlFunc struct {
+		Name, File      string
+		StartLine       int
+		Cells           []cell
+		OutOfRange      int
+		OutOfRangeLevel int
+	}
+	type htmlInput struct {
+		Input string
+		Funcs []htmlFunc
+	}
+	var data []htmlInput
+	for i, hs := range heatmaps {
+		in := htmlInput{Input: inputs[i]}
+		for _, h := range hs {
+			f := htmlFunc{Name: h.name, File: baseName(h.file), StartLine: h.startLine, OutOfRange: h.outOfRange, OutOfRangeLevel: heatLevel(h.outOfRange)}
+			for j, n := range h.counts {
+				c := cell{Class: fmt.Sprintf("l%d", heatLevel(n)), Title: fmt.Sprintf("line %d: %d line entries", h.startLine+j, n)}
+				if n == 0 && h.stmt[j] {
+					c.Class = "missing"
+				}
+				f.Cells = append(f.Cells, c)
+			}
+			in.Funcs = append(in.Funcs, f)
+		}
+		data = append(data, in)
+	}
+	return heatmapTemplate.Execute(w, data)
+}
+
+// writeHeatmapFile writes the heatmaps of each input as an HTML page to the
+// file at path.
+func writeHeatmapFile(path string, inputs []string, heatmaps [][]funcHeatmap) error {
+	fh, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeHeatmapHTML(fh, inputs, heatmaps); err != nil {
+		fh.Close()
+		return err
+	}
+	return fh.Close()
+}
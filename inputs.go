@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expandArgs expands glob patterns and recursive directory patterns
+// (dir/...) in the command line arguments. It exits if a pattern is
+// invalid or doesn't match any input.
+func expandArgs(args []string) []string {
+	var r []string
+	for _, arg := range args {
+		switch {
+		case arg == "..." || strings.HasSuffix(arg, "/...") || strings.HasSuffix(arg, string(filepath.Separator)+"..."):
+			root := arg[:len(arg)-len("...")]
+			if root == "" {
+				root = "."
+			}
+			inputs := walkInputs(filepath.Clean(root))
+			if len(inputs) == 0 {
+				fmt.Fprintf(os.Stderr, "no inputs matching %s\n", arg)
+				exit(exitError)
+			}
+			r = append(r, inputs...)
+		case strings.ContainsAny(arg, "*?["):
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error expanding %s: %v\n", arg, err)
+				exit(exitError)
+			}
+			if len(matches) == 0 {
+				fmt.Fprintf(os.Stderr, "no inputs matching %s\n", arg)
+				exit(exitError)
+			}
+			r = append(r, matches...)
+		default:
+			r = append(r, arg)
+		}
+	}
+	return r
+}
+
+// walkInputs returns the inputs found in the directory tree rooted at root.
+// Like the go command, directories starting with '.' or '_' and testdata
+// directories are skipped.
+func walkInputs(root string) []string {
+	var r []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root {
+			name := d.Name()
+			if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" {
+				return filepath.SkipDir
+			}
+		}
+		r = append(r, dirInputs(path)...)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error walking %s: %v\n", root, err)
+	}
+	return r
+}
+
+// dirInputs returns the inputs contained in directory dir. A directory
+// holding a collection of standalone programs, like most corpora of
+// reproducers, results in one input per file, otherwise the directory is
+// a single package.
+func dirInputs(dir string) []string {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	files := matches[:0]
+	for _, file := range matches {
+		if !strings.HasSuffix(file, "_test.go") {
+			files = append(files, file)
+		}
+	}
+	switch len(files) {
+	case 0:
+		return nil
+	case 1:
+		return files
+	}
+	nmain := 0
+	for _, file := range files {
+		if hasMain(file) {
+			nmain++
+		}
+	}
+	if nmain > 1 {
+		return files
+	}
+	return []string{dir}
+}
+
+// input is what is built and checked as one program: .go files of the
+// same directory or a package directory or import path.
+type input struct {
+	files []string // .go files, nil for a package
+	pkg   string   // package directory or import path
+
+	// libTest, if not nil, is added to the package other than main of
+	// the input to build it as a test executable
+	libTest *libTest
+}
+
+// argInput returns the input specified by the command line argument arg,
+// a .go file or a package.
+func argInput(arg string) input {
+	if strings.HasSuffix(arg, ".go") {
+		return input{files: []string{arg}}
+	}
+	return input{pkg: arg}
+}
+
+// String returns the name of in in the output.
+func (in input) String() string {
+	if in.files != nil {
+		return strings.Join(in.files, " ")
+	}
+	return in.pkg
+}
+
+// buildArgs returns the arguments of the go command selecting in.
+func (in input) buildArgs() []string {
+	if in.files != nil {
+		return in.files
+	}
+	return []string{pkgArg(in.pkg)}
+}
+
+// test returns true if in is built with go test -c.
+func (in input) test() bool {
+	return testBinary || in.libTest != nil
+}
+
+// inputNames returns the names of ins in the output.
+func inputNames(ins []input) []string {
+	r := make([]string, len(ins))
+	for i, in := range ins {
+		r[i] = in.String()
+	}
+	return r
+}
+
+// groupFiles merges the .go files in args that are in the same directory
+// into a single input, so that a program split in several files is built
+// as one. Files of directories holding standalone programs, where more
+// than one file declares main, stay separate inputs.
+func groupFiles(args []string) []input {
+	byDir := make(map[string][]string)
+	for _, arg := range args {
+		if strings.HasSuffix(arg, ".go") {
+			dir := filepath.Dir(arg)
+			byDir[dir] = append(byDir[dir], arg)
+		}
+	}
+	var r []input
+	done := make(map[string]bool)
+	for _, arg := range args {
+		if !strings.HasSuffix(arg, ".go") {
+			r = append(r, argInput(arg))
+			continue
+		}
+		dir := filepath.Dir(arg)
+		files := byDir[dir]
+		nmain := 0
+		for _, file := range files {
+			if hasMain(file) {
+				nmain++
+			}
+		}
+		switch {
+		case len(files) == 1 || nmain > 1:
+			r = append(r, argInput(arg))
+		case !done[dir]:
+			done[dir] = true
+			r = append(r, input{files: files})
+		}
+	}
+	return r
+}
+
+// hasMain returns true if file declares a main function.
+func hasMain(file string) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return false
+	}
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "main" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+)
+
+// instantiation is a subprogram for an instantiation of a generic
+// function, printed by -list-instantiations.
+type instantiation struct {
+	fn      string // source function
+	name    string // name of the subprogram
+	shapes  string // type arguments of the instantiation
+	lowpc   uint64
+	highpc  uint64
+	entries int // line entries
+}
+
+// collectInstantiations returns the instantiations of the generic functions
+// in funcRanges, sorted by source function and address.
+func collectInstantiations(dw *dwarf.Data, funcRanges []FuncRange) []instantiation {
+	entries := countLineEntries(dw, funcRanges)
+
+	var r []instantiation
+	for i := range funcRanges {
+		fr := &funcRanges[i]
+		if instanceName(fr.Name, fr.Fn) == "" || len(fr.Rngs) == 0 {
+			continue
+		}
+		r = append(r, instantiation{
+			fn:      fr.Fn.Name,
+			name:    fr.Name,
+			shapes:  typeArgs(fr.Name),
+			lowpc:   fr.lowpc(),
+			highpc:  fr.Rngs[len(fr.Rngs)-1][1],
+			entries: entries[fr],
+		})
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].fn != r[j].fn {
+			return r[i].fn < r[j].fn
+		}
+		return r[i].lowpc < r[j].lowpc
+	})
+	return r
+}
+
+// countLineEntries returns the number of line entries of each function of
+// funcRanges.
+func countLineEntries(dw *dwarf.Data, funcRanges []FuncRange) map[*FuncRange]int {
+	idx := newFuncIndex(funcRanges)
+	entries := make(map[*FuncRange]int)
+	forEachFuncLineEntry(dw, funcRanges, func(lne *dwarf.LineEntry) {
+		if lne.EndSequence {
+			return
+		}
+		if fr := getFunc(lne.Address, idx); fr != nil {
+			entries[fr]++
+		}
+	})
+	return entries
+}
+
+// densityRatio is the ratio between the number of line entries of two
+// instantiations of the same generic function above which the one with
+// more entries is reported, set with -density-ratio. Zero disables the
+// check.
+var densityRatio float64
+
+// minDensityDiff is the smallest difference between the number of line
+// entries of two instantiations reported with -density-ratio, small
+// functions differ by a few entries often.
+const minDensityDiff = 8
+
+// checkDensity compares the number of line entries of the instantiations
+// of each generic function in funcRanges, they are compiled from the same
+// source and should have a similar number of entries for each source line.
+// An instantiation with many more entries than the sparsest one is
+// reported.
+func checkDensity(dw *dwarf.Data, funcRanges []FuncRange) []Finding {
+	if densityRatio <= 0 {
+		return nil
+	}
+	entries := countLineEntries(dw, funcRanges)
+	instances := make(map[*Func][]*FuncRange)
+	var fns []*Func
+	for i := range funcRanges {
+		fr := &funcRanges[i]
+		if instanceName(fr.Name, fr.Fn) == "" || entries[fr] == 0 {
+			continue
+		}
+		if instances[fr.Fn] == nil {
+			fns = append(fns, fr.Fn)
+		}
+		instances[fr.Fn] = append(instances[fr.Fn], fr)
+	}
+
+	var r []Finding
+	for _, fn := range fns {
+		frs := instances[fn]
+		sparsest := frs[0]
+		for _, fr := range frs[1:] {
+			if entries[fr] < entries[sparsest] {
+				sparsest = fr
+			}
+		}
+		lines := fn.endLine - fn.startLine + 1
+		for _, fr := range frs {
+			n, least := entries[fr], entries[sparsest]
+			if float64(n) <= densityRatio*float64(least) || n-least < minDensityDiff {
+				continue
+			}
+			r = append(r, Finding{
+				Check:     "line-density",
+				Rule:      "LINE_DENSITY_ANOMALY",
+				File:      fn.file,
+				Line:      fn.startLine,
+				PC:        fr.lowpc(),
+				Func:      fn.Name,
+				Instance:  instanceName(fr.Name, fn),
+				StartLine: fn.startLine,
+				EndLine:   fn.endLine,
+				Message:   fmt.Sprintf("%d line entries for %d source lines (%.1f per line) while %s has %d (%.1f per line)", n, lines, float64(n)/float64(lines), sparsest.Name, least, float64(least)/float64(lines)),
+			})
+		}
+	}
+	return r
+}
+
+// typeArgs returns the type arguments in the first pair of square brackets
+// of name.
+func typeArgs(name string) string {
+	depth, start := 0, -1
+	for i, c := range name {
+		switch c {
+		case '[':
+			if depth == 0 {
+				start = i + 1
+			}
+			depth++
+		case ']':
+			depth--
+			if depth == 0 && start >= 0 {
+				return name[start:i]
+			}
+		}
+	}
+	return ""
+}
+
+// reportInstantiations prints the instantiations listed by
+// -list-instantiations.
+func (out *output) reportInstantiations(insts []instantiation) {
+	if jsonOutput || sarifOutput {
+		return
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(w, "function\tsubprogram\tshapes\tpc range\tentries\n")
+	for _, inst := range insts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%#x-%#x\t%d\n", inst.fn, inst.name, inst.shapes, inst.lowpc, inst.highpc, inst.entries)
+	}
+	w.Flush()
+}
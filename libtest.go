@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+)
+
+// libTestName is the name of the test file added to packages other than
+// main, it doesn't exist on disk and is passed to the go command with
+// -overlay.
+const libTestName = "badlngenerics_test.go"
+
+// libTest is the test file added to a package other than main so that go
+// test -c produces an executable for it, even without tests, that links
+// all its functions.
+type libTest struct {
+	path string // path of the file in the directory of the package
+	src  []byte
+}
+
+// newLibTest returns the test file of pkg, a package other than main in
+// dir. Its init function references every function and method of pkg, so
+// that the linker doesn't discard them. Generic functions and methods of
+// generic types are instantiated with type arguments found by
+// instanceArgs, those that can't be instantiated aren't referenced.
+func newLibTest(pkg srcPackage, dir string) (*libTest, error) {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, file := range pkg.files {
+		f, err := parser.ParseFile(fset, file, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: importer.Default(), FakeImportC: true, Error: func(error) {}}
+	tpkg, _ := conf.Check(pkg.path, fset, files, nil)
+
+	var refs []string
+	scope := tpkg.Scope()
+	for _, name := range scope.Names() {
+		switch obj := scope.Lookup(name).(type) {
+		case *types.Func:
+			sig := obj.Type().(*types.Signature)
+			if sig.TypeParams().Len() == 0 {
+				refs = append(refs, name)
+				continue
+			}
+			if args, ok := instanceArgs(tpkg, obj.Type(), sig.TypeParams()); ok {
+				refs = append(refs, name+args)
+			}
+		case *types.TypeName:
+			named, ok := obj.Type().(*types.Named)
+			if !ok || obj.IsAlias() || types.IsInterface(named) {
+				continue
+			}
+			recv := name
+			if named.TypeParams().Len() > 0 {
+				args, ok := instanceArgs(tpkg, named, named.TypeParams())
+				if !ok {
+					continue
+				}
+				recv += args
+			}
+			for i := 0; i < named.NumMethods(); i++ {
+				m := named.Method(i)
+				if _, ptr := m.Type().(*types.Signature).Recv().Type().(*types.Pointer); ptr {
+					refs = append(refs, fmt.Sprintf("(*%s).%s", recv, m.Name()))
+				} else {
+					refs = append(refs, fmt.Sprintf("%s.%s", recv, m.Name()))
+				}
+			}
+		}
+	}
+	sort.Strings(refs)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "package %s\n\nvar badlngenericsKeep []any\n\nfunc init() {\n", tpkg.Name())
+	for _, ref := range refs {
+		fmt.Fprintf(&buf, "\tbadlngenericsKeep = append(badlngenericsKeep, %s)\n", ref)
+	}
+	fmt.Fprintf(&buf, "}\n")
+	return &libTest{filepath.Join(dir, libTestName), buf.Bytes()}, nil
+}
+
+// instanceArgs returns the type argument list, in brackets, instantiating
+// generic with the type parameters tparams. The argument of each type
+// parameter is int, or the first term of its constraint if it has a type
+// set, with the other type parameters replaced by their arguments. Only
+// types of the universe scope and of pkg are used, the generated file
+// doesn't import anything.
+func instanceArgs(pkg *types.Package, generic types.Type, tparams *types.TypeParamList) (string, bool) {
+	args := make(map[*types.TypeParam]types.Type)
+	// the constraint of a type parameter can refer to the ones after it
+	for progress := true; progress && len(args) < tparams.Len(); {
+		progress = false
+		for i := 0; i < tparams.Len(); i++ {
+			tp := tparams.At(i)
+			if args[tp] != nil {
+				continue
+			}
+			iface := tp.Constraint().Underlying().(*types.Interface)
+			var arg types.Type = types.Typ[types.Int]
+			for j := 0; j < iface.NumEmbeddeds(); j++ {
+				if u, ok := iface.EmbeddedType(j).(*types.Union); ok {
+					arg = substTypeParams(u.Term(0).Type(), args)
+					break
+				}
+			}
+			if arg != nil {
+				args[tp] = arg
+				progress = true
+			}
+		}
+	}
+	if len(args) < tparams.Len() {
+		return "", false
+	}
+	targs := make([]types.Type, tparams.Len())
+	for i := range targs {
+		targs[i] = args[tparams.At(i)]
+	}
+	if _, err := types.Instantiate(nil, generic, targs, true); err != nil {
+		return "", false
+	}
+	ok := true
+	qual := func(p *types.Package) string {
+		if p != pkg {
+			ok = false
+		}
+		return ""
+	}
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i, targ := range targs {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(types.TypeString(targ, qual))
+	}
+	buf.WriteString("]")
+	return buf.String(), ok
+}
+
+// substTypeParams returns t with the type parameters replaced by their
+// type in args, or nil if one of them isn't in args or t is a type it
+// can't be done for.
+func substTypeParams(t types.Type, args map[*types.TypeParam]types.Type) types.Type {
+	sub := func(t types.Type) types.Type { return substTypeParams(t, args) }
+	switch t := t.(type) {
+	case *types.TypeParam:
+		return args[t]
+	case *types.Basic:
+		return t
+	case *types.Named:
+		if t.TypeParams().Len() > 0 && t.TypeArgs().Len() == 0 {
+			return nil
+		}
+		for i := 0; i < t.TypeArgs().Len(); i++ {
+			if _, ok := t.TypeArgs().At(i).(*types.TypeParam); ok {
+				return nil
+			}
+		}
+		return t
+	case *types.Pointer:
+		if elem := sub(t.Elem()); elem != nil {
+			return types.NewPointer(elem)
+		}
+	case *types.Slice:
+		if elem := sub(t.Elem()); elem != nil {
+			return types.NewSlice(elem)
+		}
+	case *types.Array:
+		if elem := sub(t.Elem()); elem != nil {
+			return types.NewArray(elem, t.Len())
+		}
+	case *types.Chan:
+		if elem := sub(t.Elem()); elem != nil {
+			return types.NewChan(t.Dir(), elem)
+		}
+	case *types.Map:
+		key, elem := sub(t.Key()), sub(t.Elem())
+		if key != nil && elem != nil {
+			return types.NewMap(key, elem)
+		}
+	}
+	return nil
+}
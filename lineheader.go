@@ -0,0 +1,509 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// DWARF 5 line number header content types and forms, in addition to the
+// ones read by lineTableMD5s
+const (
+	lnctDirectoryIndex = 0x2
+	lnctTimestamp      = 0x3
+	lnctSize           = 0x4
+	lnctLoUser         = 0x2000
+	lnctHiUser         = 0x3fff
+
+	formAddr   = 0x01
+	formStrx   = 0x1a
+	formAddrx  = 0x1b
+	formStrx1  = 0x25
+	formStrx4  = 0x28
+	formAddrx1 = 0x29
+	formAddrx4 = 0x2c
+
+	lnsSetFile      = 0x04
+	lneDefineFile   = 0x03
+	attrStrOffsBase = 0x72
+)
+
+// lineHeader is the part of the header of a line table that is checked.
+type lineHeader struct {
+	version    int
+	addrSize   int
+	segSelSize int
+	offSize    int
+	dirFormat  [][2]uint64 // content type and form of the fields of a directory entry
+	fileFormat [][2]uint64
+	dirs       []lineHeaderEntry
+	files      []lineHeaderEntry
+	program    []byte // the line program following the header
+	opcodeBase int
+	opLengths  []uint8 // operands of the standard opcodes
+}
+
+// lineHeaderEntry is a directory or a file of a line table header.
+type lineHeaderEntry struct {
+	path string
+	dir  uint64
+}
+
+// cuVersion is the DWARF version of a compile unit and of its line table.
+type cuVersion struct {
+	name    string
+	version int
+	line    int // version of the line table, 0 if it has none
+}
+
+// checkLineHeader checks the header of the line table of package pkgpath
+// against the version of its compile unit and, for DWARF 5 line tables,
+// the formats of the directory and file entries, that only string forms
+// are used for paths and no address forms at all, that file entries
+// refer to existing directories, that directory 0 is the compilation
+// directory and that the line program only uses existing files, file 0
+// included.
+func checkLineHeader(dw *dwarf.Data, file Dwarfable, pkgpath string) []Finding {
+	cu := compileUnit(dw, pkgpath)
+	if cu == nil {
+		return nil
+	}
+	off, ok := cu.Val(dwarf.AttrStmtList).(int64)
+	if !ok {
+		return nil
+	}
+
+	var r []Finding
+	finding := func(rule, format string, args ...interface{}) {
+		r = append(r, Finding{
+			Check:   "line-header",
+			Rule:    rule,
+			Func:    pkgpath,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	order := dw.Reader().ByteOrder()
+	h, err := readLineHeader(debugSection(file, "line"), [2][]byte{debugSection(file, "line_str"), debugSection(file, "str")}, off, order)
+	if err != nil {
+		finding("LINE_HEADER_INVALID", "line table at %#x can't be read: %v", off, err)
+		return r
+	}
+	// DWARF 4 and earlier compile units have line tables of older
+	// versions, Go uses version 2
+	if v := unitVersion(debugSection(file, "info"), cu.Offset, order); v != 0 && v != h.version && (v == 5 || h.version == 5) {
+		finding("LINE_HEADER_VERSION", "line table version %d, compile unit version %d", h.version, v)
+	}
+	for _, idx := range h.fileIndexes() {
+		switch {
+		case idx >= uint64(len(h.files)):
+			finding("LINE_HEADER_FILE_INDEX", "line program uses file index %d, the file table has %d entries", idx, len(h.files))
+		case idx == 0 && h.version < 5:
+			finding("LINE_HEADER_FILE_INDEX", "line program uses file index 0, which isn't valid before DWARF 5")
+		case idx == 0 && (h.files[0].path == "" || h.files[0].path == "?"):
+			finding("LINE_HEADER_FILE_INDEX", "line program uses file index 0, which is the placeholder %q", h.files[0].path)
+		}
+	}
+	if h.version < 5 {
+		return r
+	}
+
+	if size := dw.Reader().AddressSize(); h.addrSize != size {
+		finding("LINE_HEADER_INVALID", "line table address_size %d, compile unit address size %d", h.addrSize, size)
+	}
+	if h.segSelSize != 0 {
+		finding("LINE_HEADER_INVALID", "line table segment_selector_size %d", h.segSelSize)
+	}
+	_, hasStrOffsets := cu.Val(attrStrOffsBase).(int64)
+	for _, table := range []struct {
+		name   string
+		format [][2]uint64
+	}{{"directory", h.dirFormat}, {"file", h.fileFormat}} {
+		paths := 0
+		for _, f := range table.format {
+			if f[0] == lnctPath {
+				paths++
+			}
+			if !validLineHeaderForm(f[0], f[1]) {
+				finding("LINE_HEADER_FORM", "form %#x can't be used for content type %#x of %s entries", f[1], f[0], table.name)
+			}
+			if isStrxForm(f[1]) && !hasStrOffsets {
+				finding("LINE_HEADER_FORM", "form %#x of %s entries needs DW_AT_str_offsets_base, the compile unit doesn't have it", f[1], table.name)
+			}
+		}
+		if paths != 1 {
+			finding("LINE_HEADER_FORM", "%s entries have %d DW_LNCT_path fields", table.name, paths)
+		}
+	}
+
+	if len(h.dirs) == 0 {
+		finding("LINE_HEADER_DIRECTORY", "no directory entries, directory 0 must be the compilation directory")
+	} else if compDir, ok := cu.Val(dwarf.AttrCompDir).(string); ok && h.dirs[0].path != compDir {
+		finding("LINE_HEADER_DIRECTORY", "directory 0 is %q, the compilation directory is %q", h.dirs[0].path, compDir)
+	}
+	for i, f := range h.files {
+		if f.dir >= uint64(len(h.dirs)) {
+			finding("LINE_HEADER_DIRECTORY", "file %d %q has directory index %d, the directory table has %d entries", i, f.path, f.dir, len(h.dirs))
+		}
+	}
+	if h.definesFiles() {
+		finding("LINE_HEADER_INVALID", "line program uses DW_LNE_define_file, which is reserved in DWARF 5")
+	}
+	return r
+}
+
+// readLineHeader reads the header of the line table at offset off of data,
+// the contents of .debug_line. Paths using DW_FORM_line_strp and
+// DW_FORM_strp are read from strs, the contents of .debug_line_str and
+// .debug_str, paths using DW_FORM_strx are left empty.
+func readLineHeader(data []byte, strs [2][]byte, off int64, order binary.ByteOrder) (*lineHeader, error) {
+	if off < 0 || off >= int64(len(data)) {
+		return nil, fmt.Errorf("offset out of .debug_line")
+	}
+	b := &dbuf{data: data, off: int(off), order: order}
+	h := &lineHeader{offSize: 4}
+	length := uint64(b.u32())
+	if length == 0xffffffff {
+		h.offSize = 8
+		length = b.addr(8)
+	}
+	end := b.off + int(length)
+	if length > uint64(len(data)) || end > len(data) {
+		return nil, errTruncated
+	}
+	h.version = int(b.u16())
+	if h.version < 2 || h.version > 5 {
+		return nil, fmt.Errorf("unknown line table format %d", h.version)
+	}
+	if h.version >= 5 {
+		h.addrSize = int(b.u8())
+		h.segSelSize = int(b.u8())
+	}
+	headerLength := b.addr(h.offSize)
+	programOff := b.off + int(headerLength)
+	b.u8() // minimum_instruction_length
+	if h.version >= 4 {
+		b.u8() // maximum_operations_per_instruction
+	}
+	b.bytes(3) // default_is_stmt, line_base, line_range
+	h.opcodeBase = int(b.u8())
+	if h.opcodeBase > 0 {
+		h.opLengths = b.bytes(h.opcodeBase - 1)
+	}
+
+	if h.version >= 5 {
+		h.dirFormat, h.dirs = h.readEntries(b, strs)
+		h.fileFormat, h.files = h.readEntries(b, strs)
+	} else {
+		for b.err == nil {
+			dir := b.cstring()
+			if dir == "" {
+				break
+			}
+			h.dirs = append(h.dirs, lineHeaderEntry{path: dir})
+		}
+		// file 0 doesn't exist before DWARF 5
+		h.files = append(h.files, lineHeaderEntry{})
+		for b.err == nil {
+			name := b.cstring()
+			if name == "" {
+				break
+			}
+			h.files = append(h.files, lineHeaderEntry{path: name, dir: b.uleb()})
+			b.uleb() // modification time
+			b.uleb() // size
+		}
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	if programOff > end || programOff < b.off {
+		return nil, fmt.Errorf("header_length %d doesn't match the size of the header", headerLength)
+	}
+	h.program = data[programOff:end]
+	return h, nil
+}
+
+// readEntries reads the format and the entries of a DWARF 5 directory or
+// file name table.
+func (h *lineHeader) readEntries(b *dbuf, strs [2][]byte) ([][2]uint64, []lineHeaderEntry) {
+	var format [][2]uint64
+	for n := b.u8(); n > 0 && b.err == nil; n-- {
+		format = append(format, [2]uint64{b.uleb(), b.uleb()})
+	}
+	var r []lineHeaderEntry
+	for n := b.uleb(); n > 0 && b.err == nil; n-- {
+		var e lineHeaderEntry
+		for _, f := range format {
+			v, s := h.readForm(b, f[1])
+			switch f[1] {
+			case formLineStrp, formStrp:
+				sec, name := strs[0], ".debug_line_str"
+				if f[1] == formStrp {
+					sec, name = strs[1], ".debug_str"
+				}
+				if v >= uint64(len(sec)) {
+					b.err = fmt.Errorf("offset %#x out of %s", v, name)
+					break
+				}
+				s = (&dbuf{data: sec, off: int(v)}).cstring()
+			}
+			switch f[0] {
+			case lnctPath:
+				e.path = s
+			case lnctDirectoryIndex:
+				e.dir = v
+			}
+		}
+		r = append(r, e)
+	}
+	return format, r
+}
+
+// readForm reads a value of form, returning it as a number or, for inline
+// strings, as a string.
+func (h *lineHeader) readForm(b *dbuf, form uint64) (uint64, string) {
+	switch form {
+	case formString:
+		return 0, b.cstring()
+	case formData1, formStrx1, formAddrx1:
+		return uint64(b.u8()), ""
+	case formData2, formStrx1 + 1, formAddrx1 + 1:
+		return uint64(b.u16()), ""
+	case formStrx1 + 2, formAddrx1 + 2:
+		x := b.bytes(3)
+		if x == nil {
+			return 0, ""
+		}
+		if b.order == binary.BigEndian {
+			return uint64(x[0])<<16 | uint64(x[1])<<8 | uint64(x[2]), ""
+		}
+		return uint64(x[2])<<16 | uint64(x[1])<<8 | uint64(x[0]), ""
+	case formData4, formStrx4, formAddrx4:
+		return uint64(b.u32()), ""
+	case formData8:
+		return b.addr(8), ""
+	case formData16:
+		b.bytes(16)
+	case formBlock:
+		b.bytes(int(b.uleb()))
+	case formUdata, formStrx, formAddrx:
+		return b.uleb(), ""
+	case formStrp, formLineStrp:
+		return b.addr(h.offSize), ""
+	case formAddr:
+		return b.addr(h.addrSize), ""
+	default:
+		b.err = fmt.Errorf("unsupported form %#x in line table header", form)
+	}
+	return 0, ""
+}
+
+// validLineHeaderForm returns true if form can be used for the content
+// type lnct in a DWARF 5 line table header. Address forms can't be used
+// for any of them.
+func validLineHeaderForm(lnct, form uint64) bool {
+	switch lnct {
+	case lnctPath:
+		return form == formString || form == formLineStrp || form == formStrp || isStrxForm(form)
+	case lnctDirectoryIndex:
+		return form == formData1 || form == formData2 || form == formUdata
+	case lnctTimestamp:
+		return form == formUdata || form == formData4 || form == formData8 || form == formBlock
+	case lnctSize:
+		return form == formUdata || form == formData1 || form == formData2 || form == formData4 || form == formData8
+	case lnctMD5:
+		return form == formData16
+	}
+	if lnct >= lnctLoUser && lnct <= lnctHiUser {
+		return form != formAddr && form != formAddrx && (form < formAddrx1 || form > formAddrx4)
+	}
+	return false
+}
+
+// cstring reads a NUL terminated string.
+func (b *dbuf) cstring() string {
+	start := b.off
+	for b.err == nil && b.u8() != 0 {
+	}
+	if b.err != nil {
+		return ""
+	}
+	return string(b.data[start : b.off-1])
+}
+
+func isStrxForm(form uint64) bool {
+	return form == formStrx || (form >= formStrx1 && form <= formStrx4)
+}
+
+// fileIndexes returns the operands of the DW_LNS_set_file opcodes of the
+// line program, without duplicates.
+func (h *lineHeader) fileIndexes() []uint64 {
+	var r []uint64
+	seen := make(map[uint64]bool)
+	h.walkProgram(func(op uint8, ext bool, arg uint64) {
+		if !ext && op == lnsSetFile && !seen[arg] {
+			seen[arg] = true
+			r = append(r, arg)
+		}
+	})
+	return r
+}
+
+// definesFiles returns true if the line program uses DW_LNE_define_file.
+func (h *lineHeader) definesFiles() bool {
+	found := false
+	h.walkProgram(func(op uint8, ext bool, arg uint64) {
+		found = found || (ext && op == lneDefineFile)
+	})
+	return found
+}
+
+// walkProgram calls f for each opcode of the line program, with ext true
+// for extended opcodes and arg the first operand of standard opcodes.
+// Special opcodes are skipped.
+func (h *lineHeader) walkProgram(f func(op uint8, ext bool, arg uint64)) {
+	b := &dbuf{data: h.program, order: binary.LittleEndian}
+	for b.off < len(b.data) && b.err == nil {
+		op := b.u8()
+		switch {
+		case int(op) >= h.opcodeBase:
+			// special opcode
+		case op == 0:
+			n := int(b.uleb())
+			if n == 0 {
+				continue
+			}
+			f(b.u8(), true, 0)
+			b.bytes(n - 1)
+		case op == 9:
+			// DW_LNS_fixed_advance_pc has an uhalf operand
+			b.bytes(2)
+			f(op, false, 0)
+		default:
+			var arg uint64
+			for i := 0; i < int(h.opLengths[op-1]); i++ {
+				x := b.uleb()
+				if i == 0 {
+					arg = x
+				}
+			}
+			f(op, false, arg)
+		}
+	}
+}
+
+// unitVersion returns the version of the unit containing the entry at
+// offset off of data, the contents of .debug_info, 0 if it can't be read.
+func unitVersion(data []byte, off dwarf.Offset, order binary.ByteOrder) int {
+	for _, u := range readUnitHeaders(data, order) {
+		if off >= u.start && off < u.end {
+			return u.version
+		}
+	}
+	return 0
+}
+
+// unitHeader is the extent and version of a unit of .debug_info.
+type unitHeader struct {
+	start, end dwarf.Offset
+	version    int
+}
+
+func readUnitHeaders(data []byte, order binary.ByteOrder) []unitHeader {
+	var r []unitHeader
+	b := &dbuf{data: data, order: order}
+	for b.off < len(data) && b.err == nil {
+		start := b.off
+		length := uint64(b.u32())
+		if length == 0xffffffff {
+			length = b.addr(8)
+		}
+		if length > uint64(len(data)) {
+			break
+		}
+		hdr := b.off
+		version := int(b.u16())
+		if b.err != nil {
+			break
+		}
+		b.off = hdr + int(length)
+		r = append(r, unitHeader{dwarf.Offset(start), dwarf.Offset(b.off), version})
+	}
+	return r
+}
+
+// dwarfVersions returns the versions of the compile units of dw and of
+// their line tables.
+func dwarfVersions(dw *dwarf.Data, file Dwarfable) []cuVersion {
+	order := dw.Reader().ByteOrder()
+	units := readUnitHeaders(debugSection(file, "info"), order)
+	line := debugSection(file, "line")
+	var r []cuVersion
+	rdr := dw.Reader()
+	for {
+		e, err := rdr.Next()
+		if err != nil || e == nil {
+			break
+		}
+		rdr.SkipChildren()
+		if e.Tag != dwarf.TagCompileUnit {
+			continue
+		}
+		v := cuVersion{name: compileUnitName(e)}
+		for _, u := range units {
+			if e.Offset >= u.start && e.Offset < u.end {
+				v.version = u.version
+			}
+		}
+		if off, ok := e.Val(dwarf.AttrStmtList).(int64); ok && off >= 0 && off+6 <= int64(len(line)) {
+			b := &dbuf{data: line, off: int(off), order: order}
+			if b.u32() == 0xffffffff {
+				b.bytes(8)
+			}
+			v.line = int(b.u16())
+		}
+		r = append(r, v)
+	}
+	return r
+}
+
+// reportVersions prints how many compile units have each combination of
+// DWARF version and line table version, listing the compile units of the
+// combinations other than the most common one.
+func (out *output) reportVersions(versions []cuVersion) {
+	if jsonOutput || sarifOutput || len(versions) == 0 {
+		return
+	}
+	type key struct{ version, line int }
+	byKey := make(map[key][]string)
+	var keys []key
+	for _, v := range versions {
+		k := key{v.version, v.line}
+		if byKey[k] == nil {
+			keys = append(keys, k)
+		}
+		byKey[k] = append(byKey[k], v.name)
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(byKey[keys[i]]) > len(byKey[keys[j]]) })
+
+	w := tabwriter.NewWriter(out, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(w, "DWARF version\tline table version\tcompile units\n")
+	for i, k := range keys {
+		names := byKey[k]
+		line := "-"
+		if k.line != 0 {
+			line = fmt.Sprint(k.line)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d", k.version, line, len(names))
+		if i > 0 {
+			sort.Strings(names)
+			fmt.Fprintf(w, " (%s)", strings.Join(names, ", "))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	w.Flush()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"sort"
+)
+
+// lineSpread is the fraction of the size of a function above which the
+// addresses of one of its lines are reported as too far apart, set with
+// -line-spread. Zero disables the report.
+var lineSpread float64
+
+// lineRow is a row of the line table and the addresses it covers.
+type lineRow struct {
+	start, end uint64
+	file       string
+	line       int
+	isStmt     bool
+}
+
+// checkLinePCs checks that mapping each line of a function to the address
+// a debugger would set a breakpoint on, the lowest is_stmt entry for the
+// line, and back to a line with the line table gives the same line: the
+// entry can't be overridden by the entry for another line at the same
+// address. With -line-spread it also reports the lines whose addresses
+// span too much of their function.
+func checkLinePCs(dw *dwarf.Data, funcRanges []FuncRange) []Finding {
+	idx := newFuncIndex(funcRanges)
+	rows := make(map[*FuncRange][]lineRow)
+	var prev *lineRow
+	forEachFuncLineEntry(dw, funcRanges, func(lne *dwarf.LineEntry) {
+		if prev != nil && prev.end == 0 {
+			prev.end = lne.Address
+		}
+		prev = nil
+		if lne.EndSequence {
+			return
+		}
+		fr := getFunc(lne.Address, idx)
+		if fr == nil || fr.inlinedAt(lne.Address) != nil {
+			return
+		}
+		rows[fr] = append(rows[fr], lineRow{start: lne.Address, file: lne.File.Name, line: lne.Line, isStmt: lne.IsStmt})
+		prev = &rows[fr][len(rows[fr])-1]
+	})
+
+	var r []Finding
+	for i := range funcRanges {
+		fr := &funcRanges[i]
+		if len(rows[fr]) > 0 {
+			r = append(r, checkFuncLinePCs(fr, rows[fr])...)
+		}
+	}
+	return r
+}
+
+func checkFuncLinePCs(fr *FuncRange, rows []lineRow) []Finding {
+	var r []Finding
+	finding := func(rule string, line int, pc uint64, format string, args ...interface{}) {
+		r = append(r, Finding{
+			Check:     "line-pc",
+			Rule:      rule,
+			File:      fr.Fn.file,
+			Line:      line,
+			PC:        pc,
+			Func:      fr.Fn.Name,
+			Instance:  instanceName(fr.Name, fr.Fn),
+			StartLine: fr.Fn.startLine,
+			EndLine:   fr.Fn.endLine,
+			Message:   fmt.Sprintf(format, args...),
+		})
+	}
+
+	// the row in effect at an address is the last one with that address
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].start < rows[j].start })
+	atPC := make(map[uint64]*lineRow)
+	for i := range rows {
+		atPC[rows[i].start] = &rows[i]
+	}
+
+	type fileLine struct {
+		file string
+		line int
+	}
+	bps := make(map[fileLine]uint64)
+	var lines []fileLine
+	for _, row := range rows {
+		k := fileLine{row.file, row.line}
+		if _, ok := bps[k]; !ok && row.isStmt {
+			bps[k] = row.start
+			lines = append(lines, k)
+		}
+	}
+
+	for _, k := range lines {
+		if !sameFile(k.file, fr.Fn.file) {
+			continue
+		}
+		pc := bps[k]
+		if row := atPC[pc]; row.file != k.file || row.line != k.line {
+			finding("LINE_PC_NOT_INVERTIBLE", k.line, pc, "breakpoint address of the line maps back to %s:%d, whose entry is at the same address", baseName(row.file), row.line)
+		}
+	}
+
+	if lineSpread <= 0 || fr.Fn.asm {
+		// each line of assembly is a single instruction
+		return r
+	}
+	size := float64(fr.Rngs[len(fr.Rngs)-1][1] - fr.lowpc())
+	lo, hi := make(map[fileLine]uint64), make(map[fileLine]uint64)
+	for i := range rows {
+		row := &rows[i]
+		k := fileLine{row.file, row.line}
+		if row.end <= row.start || atPC[row.start] != row {
+			// empty row
+			continue
+		}
+		if _, ok := lo[k]; !ok {
+			lo[k] = row.start
+		}
+		hi[k] = row.end
+	}
+	for _, k := range lines {
+		if !sameFile(k.file, fr.Fn.file) || k.line == fr.Fn.startLine {
+			// the call to morestack at the end of the function is
+			// attributed to the first line
+			continue
+		}
+		if _, ok := lo[k]; !ok {
+			continue
+		}
+		if spread := float64(hi[k]-lo[k]) / size; spread > lineSpread {
+			finding("LINE_PC_SPREAD", k.line, lo[k], "addresses of the line span %#x-%#x, %.0f%% of the function", lo[k], hi[k], 100*spread)
+		}
+	}
+	return r
+}
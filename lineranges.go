@@ -0,0 +1,799 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type Func struct {
+	Name               string
+	file               string
+	startLine, endLine int
+	openLine           int           // line of the opening brace
+	firstLine          int           // line of the first statement of the body
+	returnLines        map[int]bool  // lines of the return statements
+	stmtLines          map[int]bool  // lines of the statements that generate code
+	stmtStarts         map[int][]int // columns where statements start, by line
+	src                *sourceFile   // only with -columns
+	sigLine            int           // last line of the signature
+	params             []string      // names of the named parameters and results, including the receiver
+	generic            bool          // has type parameters, directly or through its receiver
+	asm                bool          // written in assembly, its statement lines are the lines with instructions
+	goDefers           []goDeferStmt
+	rangeBodies        []rangeBody           // bodies of the range-over-func loops, moved into closures
+	varTypes           map[string]types.Type // types of the variables of the file by varKey, only for packages with generic functions
+
+	// line ranges by file, only for functions containing //line directives
+	ranges map[string][2]int
+	// some positions of the function come from //line directives
+	adjusted bool
+}
+
+// pkgSyntax is what is known about the package of the functions, without
+// type checking it unless needed.
+type pkgSyntax struct {
+	rangeFuncs map[*ast.RangeStmt]bool // range statements over functions
+	zeroSize   map[string]bool         // types declared by the package whose values have size zero
+}
+
+// newFunc returns the Func for the function n with body body, n can also
+// be a range-over-func loop whose body is compiled as a closure.
+func newFunc(fset *token.FileSet, name string, n ast.Node, body *ast.BlockStmt, pkg *pkgSyntax) *Func {
+	s := fset.Position(n.Pos())
+	e := fset.Position(n.End())
+	fn := &Func{Name: name, file: s.Filename, startLine: s.Line, endLine: e.Line, returnLines: map[int]bool{}, stmtLines: map[int]bool{}, stmtStarts: map[int][]int{}}
+	logger.Debug("source function", "name", name, "file", s.Filename, "start", s.Line, "end", e.Line)
+	fn.ranges = lineDirectiveRanges(fset, n)
+	raw := fset.PositionFor(n.Pos(), false)
+	fn.adjusted = fn.ranges != nil || raw.Filename != s.Filename || raw.Line != s.Line
+	var typ *ast.FuncType
+	switch n := n.(type) {
+	case *ast.FuncDecl:
+		typ = n.Type
+		fn.generic = typ.TypeParams != nil
+		if n.Recv != nil && len(n.Recv.List) > 0 {
+			fn.params = fieldNames(n.Recv)
+			switch ast.Unparen(derefType(n.Recv.List[0].Type)).(type) {
+			case *ast.IndexExpr, *ast.IndexListExpr:
+				fn.generic = true
+			}
+		}
+	case *ast.FuncLit:
+		typ = n.Type
+	case *ast.RangeStmt:
+		// the iteration variables are the parameters of the closure
+		fn.sigLine = s.Line
+		if n.Tok == token.DEFINE {
+			for _, x := range []ast.Expr{n.Key, n.Value} {
+				if id, ok := x.(*ast.Ident); ok && id.Name != "_" {
+					fn.params = append(fn.params, id.Name)
+				}
+			}
+		}
+	}
+	if typ != nil {
+		fn.sigLine = fset.Position(typ.End()).Line
+		fn.params = append(fn.params, fieldNames(typ.Params)...)
+		fn.params = append(fn.params, fieldNames(typ.Results)...)
+	}
+	if body == nil {
+		return fn
+	}
+	fn.openLine = fset.Position(body.Lbrace).Line
+	fn.firstLine = fset.Position(body.Rbrace).Line
+	if len(body.List) > 0 {
+		fn.firstLine = fset.Position(body.List[0].Pos()).Line
+	}
+	addStart := func(pos token.Pos) {
+		p := fset.Position(pos)
+		fn.stmtStarts[p.Line] = append(fn.stmtStarts[p.Line], p.Column)
+	}
+	// in functions with defer statements the returns without results jump
+	// to the exit of the function, attributed to the closing brace
+	deferExit := containsDefer(body)
+	ast.Inspect(body, func(n ast.Node) bool {
+		if _, ok := n.(*ast.BlockStmt); !ok && n != nil {
+			if _, ok := n.(ast.Stmt); ok {
+				addStart(n.Pos())
+			}
+		}
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ForStmt:
+			// evaluated at every iteration
+			if n.Cond != nil {
+				addStart(n.Cond.Pos())
+			}
+		case *ast.RangeStmt:
+			if pkg.rangeFuncs[n] {
+				// the body belongs to the closure
+				fn.stmtLines[fset.Position(n.Pos()).Line] = true
+				fn.rangeBodies = append(fn.rangeBodies, rangeBody{fset.Position(n.Body.Lbrace).Line, fset.Position(n.Body.Rbrace).Line})
+				return false
+			}
+		case *ast.ReturnStmt:
+			fn.returnLines[fset.Position(n.Pos()).Line] = true
+			if deferExit && len(n.Results) == 0 {
+				return true
+			}
+		case *ast.GoStmt:
+			fn.goDefers = append(fn.goDefers, newGoDeferStmt(fset, "go", n, n.Call))
+		case *ast.DeferStmt:
+			fn.goDefers = append(fn.goDefers, newGoDeferStmt(fset, "defer", n, n.Call))
+		}
+		for _, pos := range codePositions(n, pkg.zeroSize) {
+			fn.stmtLines[fset.Position(pos).Line] = true
+		}
+		return true
+	})
+	return fn
+}
+
+// rangeBody is the body of a range-over-func loop, from the line of its
+// opening brace to the one of its closing brace.
+type rangeBody struct {
+	start, end int
+}
+
+// goDeferStmt is a go or defer statement of a function.
+type goDeferStmt struct {
+	kind       string // "go" or "defer"
+	start, end int
+	wrapped    bool // the compiler probably generates a wrapper for the call
+}
+
+func newGoDeferStmt(fset *token.FileSet, kind string, n ast.Node, call *ast.CallExpr) goDeferStmt {
+	return goDeferStmt{kind, fset.Position(n.Pos()).Line, fset.Position(n.End()).Line, needsWrapper(call)}
+}
+
+// needsWrapper returns true if the compiler wraps call in a function
+// without arguments and results when it is the call of a go or defer
+// statement. Without type information this is a guess for calls of
+// functions of other packages and of function values.
+func needsWrapper(call *ast.CallExpr) bool {
+	if len(call.Args) > 0 {
+		return true
+	}
+	switch fun := ast.Unparen(call.Fun).(type) {
+	case *ast.FuncLit:
+		return fun.Type.Results != nil
+	case *ast.Ident:
+		if fun.Obj == nil {
+			// builtin or function declared in another file
+			return fun.Name == "recover" || fun.Name == "print" || fun.Name == "println"
+		}
+		if decl, ok := fun.Obj.Decl.(*ast.FuncDecl); ok {
+			return decl.Type.Results != nil
+		}
+		return false
+	}
+	// method calls and calls of functions of other packages
+	return true
+}
+
+// fieldNames returns the names in fl, except blank ones.
+func fieldNames(fl *ast.FieldList) []string {
+	if fl == nil {
+		return nil
+	}
+	var r []string
+	for _, f := range fl.List {
+		for _, name := range f.Names {
+			if name.Name != "_" {
+				r = append(r, name.Name)
+			}
+		}
+	}
+	return r
+}
+
+// derefType removes the pointer from a pointer type.
+func derefType(x ast.Expr) ast.Expr {
+	if star, ok := ast.Unparen(x).(*ast.StarExpr); ok {
+		return star.X
+	}
+	return x
+}
+
+// lineDirectiveRanges returns the line ranges, by file, covered by n if
+// //line directives inside it change the file or make the lines
+// discontinuous, nil otherwise.
+func lineDirectiveRanges(fset *token.FileSet, n ast.Node) map[string][2]int {
+	tf := fset.File(n.Pos())
+	start, end := tf.PositionFor(n.Pos(), false).Line, tf.PositionFor(n.End(), false).Line
+	s := fset.Position(n.Pos())
+	ranges := make(map[string][2]int)
+	directives := false
+	for line := start; line <= end; line++ {
+		p := fset.Position(tf.LineStart(line))
+		if p.Filename != s.Filename || p.Line-line != s.Line-start {
+			directives = true
+		}
+		rng, ok := ranges[p.Filename]
+		if !ok {
+			rng = [2]int{p.Line, p.Line}
+		}
+		rng[0] = min(rng[0], p.Line)
+		rng[1] = max(rng[1], p.Line)
+		ranges[p.Filename] = rng
+	}
+	if !directives {
+		return nil
+	}
+	return ranges
+}
+
+// contains returns true if line of file belongs to fn, file is only used
+// for functions containing //line directives and can be empty to mean any
+// file.
+func (fn *Func) contains(file string, line int) bool {
+	if fn.ranges == nil {
+		return line >= fn.startLine && line <= fn.endLine
+	}
+	for f, rng := range fn.ranges {
+		if (file == "" || sameFile(f, file)) && line >= rng[0] && line <= rng[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// getLineRanges records the line ranges of the functions declared in the
+// files of package pkgpath. It fails if the files can't be read or parsed.
+func getLineRanges(paths []string, pkgpath string, funcs map[string]*Func) error {
+	fset := token.NewFileSet()
+	ninit, nglob := 0, 0
+	paths = append([]string(nil), paths...)
+	var files []*ast.File
+	for i, path := range paths {
+		// with -binary path is the name recorded in the debug info and
+		// must be kept as is
+		var src interface{}
+		switch {
+		case srcDir != "":
+			buf, err := os.ReadFile(filepath.Join(srcDir, baseName(path)))
+			if err != nil {
+				return err
+			}
+			src = buf
+		case binaryPath == "":
+			var err error
+			path, err = filepath.Abs(path)
+			if err != nil {
+				return err
+			}
+		}
+		file, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+		paths[i] = path
+	}
+
+	// type checking is slow, most packages don't need it
+	var info *types.Info
+	typeInfo := func() *types.Info {
+		if info == nil {
+			info = typeCheck(fset, files)
+		}
+		return info
+	}
+
+	pkg := &pkgSyntax{rangeFuncs: rangeOverFuncs(files, typeInfo), zeroSize: zeroSizeTypes(files)}
+
+	// methods declared on an alias belong to the aliased type, which is
+	// resolved with go/types, aliases to other names are also resolved
+	// syntactically for methods that don't type check
+	aliases := make(map[string]string)
+	hasAliases := false
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if !ts.Assign.IsValid() {
+					continue
+				}
+				hasAliases = true
+				if id, ok := ast.Unparen(ts.Type).(*ast.Ident); ok {
+					aliases[ts.Name.Name] = id.Name
+				}
+			}
+		}
+	}
+	methodRecv := func(decl *ast.FuncDecl) string {
+		if hasAliases {
+			if name, ok := recvTypeName(typeInfo(), decl); ok {
+				return name
+			}
+		}
+		return recvName(decl.Recv.List[0].Type, aliases)
+	}
+
+	for i, file := range files {
+		path := paths[i]
+		ast.Inspect(file, func(n ast.Node) bool {
+			if n == nil {
+				return false
+			}
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				name := n.Name.Name
+				if n.Recv != nil {
+					name = methodRecv(n) + "." + name
+				} else if name == "init" {
+					name = fmt.Sprintf("init.%d", ninit)
+					ninit++
+				}
+				name = pkgpath + "." + name
+				funcs[name] = newFunc(fset, name, n, n.Body, pkg)
+				if n.Body != nil {
+					getClosureRanges(fset, name, ".func", n.Body, pkg, funcs)
+				}
+				return false
+			case *ast.FuncLit:
+				// closures in package level variable initializers
+				nglob++
+				addClosure(fset, fmt.Sprintf("%s.init.func%d", pkgpath, nglob), n, pkg, funcs)
+				return false
+			default:
+				return true
+			}
+		})
+		if columns || blankLines {
+			src := newSourceFile(fset, file)
+			for _, fn := range funcs {
+				if fn.file == path {
+					fn.src = src
+				}
+			}
+		}
+	}
+
+	generic := false
+	for _, fn := range funcs {
+		generic = generic || fn.generic
+	}
+	if generic {
+		vars := varTypes(fset, typeInfo())
+		for _, fn := range funcs {
+			fn.varTypes = vars[fn.file]
+		}
+	}
+	return nil
+}
+
+// packagePath returns the path used to qualify the names of the symbols
+// of package name with import path importPath.
+func packagePath(name, importPath string) string {
+	if name == "main" {
+		return "main"
+	}
+	return importPath
+}
+
+// getClosureRanges records the line ranges of the function literals and
+// of the bodies of the range-over-func loops contained in body, which
+// belongs to the function called name. The compiler names the function
+// literals name+sep+"1", name+sep+"2", etc. and the loop bodies
+// name-range1, name-range2, etc. in order of appearance, the function
+// literals inside a loop body are numbered as closures of the loop body.
+func getClosureRanges(fset *token.FileSet, name, sep string, body ast.Node, pkg *pkgSyntax, funcs map[string]*Func) {
+	nlit, nrange := 0, 0
+	var inspect func(n ast.Node) bool
+	inspect = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			nlit++
+			addClosure(fset, name+sep+strconv.Itoa(nlit), n, pkg, funcs)
+			return false
+		case *ast.RangeStmt:
+			if !pkg.rangeFuncs[n] {
+				return true
+			}
+			// the range expression is evaluated by the enclosing function
+			ast.Inspect(n.X, inspect)
+			nrange++
+			rname := name + "-range" + strconv.Itoa(nrange)
+			funcs[rname] = newFunc(fset, rname, n, n.Body, pkg)
+			getClosureRanges(fset, rname, ".", n.Body, pkg, funcs)
+			return false
+		}
+		return true
+	}
+	ast.Inspect(body, inspect)
+}
+
+// addClosure records the line range of lit and of the closures nested
+// inside it, which are named name.1, name.2, etc.
+func addClosure(fset *token.FileSet, name string, lit *ast.FuncLit, pkg *pkgSyntax, funcs map[string]*Func) {
+	funcs[name] = newFunc(fset, name, lit, lit.Body, pkg)
+	getClosureRanges(fset, name, ".", lit.Body, pkg, funcs)
+}
+
+// codePositions returns the positions of n that the compiler translates
+// into instructions of their own: the position of n if it's a statement
+// generating code and, for var declarations, the position of each
+// variable spec generating code. Types in zeroSize have size zero.
+func codePositions(n ast.Node, zeroSize map[string]bool) []token.Pos {
+	switch n := n.(type) {
+	case *ast.BlockStmt, *ast.EmptyStmt, *ast.LabeledStmt, *ast.BranchStmt, *ast.CaseClause, *ast.CommClause, *ast.SelectStmt:
+		return nil
+	case *ast.SwitchStmt:
+		// the code of a tagless switch is in its case clauses
+		if n.Init == nil && n.Tag == nil {
+			return nil
+		}
+	case *ast.ForStmt:
+		// the code of an infinite loop is in its body
+		if n.Init == nil && n.Cond == nil && n.Post == nil {
+			return nil
+		}
+	case *ast.AssignStmt:
+		if blankAssign(n) {
+			return nil
+		}
+	case *ast.DeclStmt:
+		gd := n.Decl.(*ast.GenDecl)
+		if gd.Tok != token.VAR {
+			return nil
+		}
+		// the specs of a group are compiled one at a time, variables
+		// without a value are zeroed unless they have size zero
+		var r []token.Pos
+		for _, spec := range gd.Specs {
+			vs := spec.(*ast.ValueSpec)
+			if len(vs.Values) > 0 || vs.Type == nil || !zeroSizeType(vs.Type, zeroSize) {
+				r = append(r, vs.Pos())
+			}
+		}
+		return r
+	case ast.Stmt:
+	default:
+		return nil
+	}
+	return []token.Pos{n.Pos()}
+}
+
+// containsDefer returns true if body contains a defer statement outside
+// of function literals.
+func containsDefer(body *ast.BlockStmt) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.DeferStmt:
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// blankAssign returns true if n assigns to the blank identifier only
+// expressions without side effects, which don't generate code.
+func blankAssign(n *ast.AssignStmt) bool {
+	if n.Tok != token.ASSIGN {
+		return false
+	}
+	for _, x := range n.Lhs {
+		if id, ok := x.(*ast.Ident); !ok || id.Name != "_" {
+			return false
+		}
+	}
+	for _, x := range n.Rhs {
+		switch ast.Unparen(x).(type) {
+		case *ast.Ident, *ast.BasicLit:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// zeroSizeTypes returns the names of the types declared at the top level
+// of files whose values have size zero, as far as it can be determined
+// without type checking.
+func zeroSizeTypes(files []*ast.File) map[string]bool {
+	specs := make(map[string]ast.Expr)
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if ts.TypeParams == nil {
+					specs[ts.Name.Name] = ts.Type
+				}
+			}
+		}
+	}
+	// types can be defined in terms of each other, repeat until nothing
+	// changes
+	r := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for name, t := range specs {
+			if !r[name] && zeroSizeType(t, r) {
+				r[name] = true
+				changed = true
+			}
+		}
+	}
+	return r
+}
+
+// zeroSizeType returns true if values of the type t have size zero,
+// zeroSize are the names of the types known to have size zero.
+func zeroSizeType(t ast.Expr, zeroSize map[string]bool) bool {
+	switch t := ast.Unparen(t).(type) {
+	case *ast.Ident:
+		return zeroSize[t.Name]
+	case *ast.StructType:
+		for _, f := range t.Fields.List {
+			if !zeroSizeType(f.Type, zeroSize) {
+				return false
+			}
+		}
+		return true
+	case *ast.ArrayType:
+		if lit, ok := t.Len.(*ast.BasicLit); ok && lit.Value == "0" {
+			return true
+		}
+		return t.Len != nil && zeroSizeType(t.Elt, zeroSize)
+	}
+	return false
+}
+
+// recvName returns the receiver type t of a method the way the compiler
+// writes it in symbol names, without type parameters: T for value
+// receivers and (*T) for pointer receivers.
+func recvName(t ast.Expr, aliases map[string]string) string {
+	ptr := false
+	for {
+		switch x := t.(type) {
+		case *ast.ParenExpr:
+			t = x.X
+			continue
+		case *ast.StarExpr:
+			ptr = true
+			t = x.X
+			continue
+		case *ast.IndexExpr:
+			t = x.X
+			continue
+		case *ast.IndexListExpr:
+			t = x.X
+			continue
+		}
+		break
+	}
+	name := exprToString(t)
+	for seen := 0; seen < len(aliases); seen++ {
+		target, ok := aliases[name]
+		if !ok {
+			break
+		}
+		name = target
+	}
+	if ptr {
+		return "(*" + name + ")"
+	}
+	return name
+}
+
+// recvTypeName returns the receiver type of method decl like recvName,
+// using the types in info to resolve aliases. It returns false if the
+// receiver couldn't be type checked.
+func recvTypeName(info *types.Info, decl *ast.FuncDecl) (string, bool) {
+	obj, _ := info.Defs[decl.Name].(*types.Func)
+	if obj == nil {
+		return "", false
+	}
+	recv := obj.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return "", false
+	}
+	t := types.Unalias(recv.Type())
+	ptr := false
+	if p, ok := t.(*types.Pointer); ok {
+		ptr, t = true, types.Unalias(p.Elem())
+	}
+	named, ok := t.(*types.Named)
+	if !ok {
+		return "", false
+	}
+	if ptr {
+		return "(*" + named.Obj().Name() + ")", true
+	}
+	return named.Obj().Name(), true
+}
+
+func exprToString(t ast.Expr) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, token.NewFileSet(), t)
+	return buf.String()
+}
+
+// withoutTypeParams returns the name in of a function in the debug info
+// or in the symbol table without the type arguments of the instantiation
+// and of its receiver. Type arguments are shapes, which can contain
+// brackets, like go.shape.map[string][]int, and quoted struct tags.
+func withoutTypeParams(in string) string {
+	if !strings.Contains(in, "[") {
+		return in
+	}
+	var b strings.Builder
+	depth := 0
+	for i := 0; i < len(in); i++ {
+		switch c := in[i]; {
+		case c == '[':
+			depth++
+		case c == ']' && depth > 0:
+			depth--
+		case c == '"' && depth > 0:
+			for i++; i < len(in) && in[i] != '"'; i++ {
+				if in[i] == '\\' {
+					i++
+				}
+			}
+		case depth == 0:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// rangeOverFuncs returns the range statements of files that range over a
+// function. The package is only type checked if the type of some range
+// expression can't be told from the syntax. Packages that don't type check
+// are handled as well as possible, the types that can't be determined
+// aren't functions.
+func rangeOverFuncs(files []*ast.File, typeInfo func() *types.Info) map[*ast.RangeStmt]bool {
+	// the objects declared at the top level of the other files of the
+	// package aren't resolved by the parser
+	pkgObjs := make(map[string]*ast.Object)
+	for _, file := range files {
+		for name, obj := range file.Scope.Objects {
+			pkgObjs[name] = obj
+		}
+	}
+	var stmts []*ast.RangeStmt
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			if rs, ok := n.(*ast.RangeStmt); ok && !notFunc(rs.X, pkgObjs) {
+				stmts = append(stmts, rs)
+			}
+			return true
+		})
+	}
+	if len(stmts) == 0 {
+		return nil
+	}
+	info := typeInfo()
+	r := make(map[*ast.RangeStmt]bool)
+	for _, rs := range stmts {
+		if tv, ok := info.Types[rs.X]; ok && tv.Type != nil {
+			if _, ok := tv.Type.Underlying().(*types.Signature); ok {
+				r[rs] = true
+			}
+		}
+	}
+	return r
+}
+
+// notFunc returns true if expression x is known not to be a function
+// from the syntax alone: a literal, an operation, a slice expression, a
+// conversion, a call of make or new, or a variable declared with one of
+// them or with an array, slice, map, channel or basic type.
+func notFunc(x ast.Expr, pkgObjs map[string]*ast.Object) bool {
+	switch x := ast.Unparen(x).(type) {
+	case *ast.BasicLit, *ast.CompositeLit, *ast.BinaryExpr, *ast.SliceExpr:
+		return true
+	case *ast.CallExpr:
+		if id, ok := x.Fun.(*ast.Ident); ok && id.Obj == nil && pkgObjs[id.Name] == nil && (id.Name == "make" || id.Name == "new") {
+			return true
+		}
+		return notFuncType(x.Fun, pkgObjs)
+	case *ast.Ident:
+		obj := x.Obj
+		if obj == nil {
+			obj = pkgObjs[x.Name]
+		}
+		if obj == nil || obj.Kind != ast.Var {
+			return false
+		}
+		switch d := obj.Decl.(type) {
+		case *ast.Field:
+			return notFuncType(d.Type, pkgObjs)
+		case *ast.ValueSpec:
+			if d.Type != nil {
+				return notFuncType(d.Type, pkgObjs)
+			}
+			for i, id := range d.Names {
+				if id.Obj == obj && len(d.Values) == len(d.Names) {
+					return notFunc(d.Values[i], pkgObjs)
+				}
+			}
+		case *ast.AssignStmt:
+			for i, lhs := range d.Lhs {
+				if id, ok := lhs.(*ast.Ident); ok && id.Obj == obj && len(d.Rhs) == len(d.Lhs) {
+					return notFunc(d.Rhs[i], pkgObjs)
+				}
+			}
+		}
+	}
+	return false
+}
+
+// notFuncType returns true if the type expression t is an array, a slice,
+// a map, a channel, a pointer to an array or a basic type that can be
+// ranged over.
+func notFuncType(t ast.Expr, pkgObjs map[string]*ast.Object) bool {
+	switch t := ast.Unparen(t).(type) {
+	case *ast.ArrayType, *ast.MapType, *ast.ChanType, *ast.Ellipsis:
+		return true
+	case *ast.StarExpr:
+		_, ok := t.X.(*ast.ArrayType)
+		return ok
+	case *ast.Ident:
+		if t.Obj != nil || pkgObjs[t.Name] != nil {
+			return false
+		}
+		switch t.Name {
+		case "string", "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte", "rune":
+			return true
+		}
+	}
+	return false
+}
+
+// typeCheck type checks files, ignoring errors: the types of the
+// expressions that could be checked are returned.
+func typeCheck(fset *token.FileSet, files []*ast.File) *types.Info {
+	info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue), Defs: make(map[*ast.Ident]types.Object)}
+	conf := types.Config{Importer: importer.Default(), FakeImportC: true, Error: func(error) {}}
+	conf.Check(files[0].Name.Name, fset, files, info)
+	return info
+}
+
+// varTypes returns the types of the variables and parameters declared in
+// info, by file and by varKey.
+func varTypes(fset *token.FileSet, info *types.Info) map[string]map[string]types.Type {
+	r := make(map[string]map[string]types.Type)
+	for id, obj := range info.Defs {
+		v, ok := obj.(*types.Var)
+		if !ok || v.IsField() {
+			continue
+		}
+		pos := fset.Position(id.Pos())
+		if r[pos.Filename] == nil {
+			r[pos.Filename] = make(map[string]types.Type)
+		}
+		r[pos.Filename][varKey(id.Name, pos.Line)] = v.Type()
+	}
+	return r
+}
+
+// varKey identifies the variable name declared on line.
+func varKey(name string, line int) string {
+	return fmt.Sprintf("%s:%d", name, line)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestRecvName(t *testing.T) {
+	tests := []struct {
+		recv    string
+		aliases map[string]string
+		want    string
+	}{
+		{"T", nil, "T"},
+		{"*T", nil, "(*T)"},
+		{"T[K, V]", nil, "T"},
+		{"*T[map[K]V]", nil, "(*T)"},
+		{"T[[2]int]", nil, "T"},
+		{"(*T[K, V])", nil, "(*T)"},
+		{"*T[map[K][]V]", nil, "(*T)"},
+		{"T[S[[2]K]]", nil, "T"},
+		{"A", map[string]string{"A": "T"}, "T"},
+		{"*A[K]", map[string]string{"A": "B", "B": "T"}, "(*T)"},
+		{"A", map[string]string{"A": "B", "B": "A"}, "A"},
+	}
+	for _, tt := range tests {
+		x, err := parser.ParseExpr(tt.recv)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.recv, err)
+		}
+		if got := recvName(x, tt.aliases); got != tt.want {
+			t.Errorf("recvName(%s, %v) = %q, want %q", tt.recv, tt.aliases, got, tt.want)
+		}
+	}
+}
+
+func TestRecvTypeName(t *testing.T) {
+	const src = `package p
+
+type T[K comparable, V any] struct{}
+type U struct{}
+type A = U
+type B = A
+
+func (T[K, V]) Value()    {}
+func (*T[K, V]) Pointer() {}
+func (A) Alias()          {}
+func (*B) AliasOfAlias()  {}
+func F()                  {}
+`
+	tests := []struct {
+		fn     string
+		want   string
+		wantOk bool
+	}{
+		{"Value", "T", true},
+		{"Pointer", "(*T)", true},
+		{"Alias", "U", true},
+		{"AliasOfAlias", "(*U)", true},
+		{"F", "", false},
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := typeCheck(fset, []*ast.File{file})
+	decls := make(map[string]*ast.FuncDecl)
+	for _, decl := range file.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok {
+			decls[fd.Name.Name] = fd
+		}
+	}
+	for _, tt := range tests {
+		got, ok := recvTypeName(info, decls[tt.fn])
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("recvTypeName(%s) = %q, %v, want %q, %v", tt.fn, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestWithoutTypeParams(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"main.main", "main.main"},
+		{"main.T[go.shape.int,go.shape.string].Method", "main.T.Method"},
+		{"main.(*T[go.shape.int,go.shape.string]).Method", "main.(*T).Method"},
+		{"main.(*T[map[go.shape.int]go.shape.string]).Method", "main.(*T).Method"},
+		{"main.F[[2]int]", "main.F"},
+		{"main.F[map[string][]int].func1", "main.F.func1"},
+		{"main.G[main.T[main.U[[2]int]]].func1.2", "main.G.func1.2"},
+		{`main.F[struct { X int "json:\"a]\"" }]`, "main.F"},
+	}
+	for _, tt := range tests {
+		if got := withoutTypeParams(tt.in); got != tt.want {
+			t.Errorf("withoutTypeParams(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
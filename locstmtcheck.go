@@ -0,0 +1,140 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+)
+
+// stmtPC is the address of an is_stmt line entry of a function.
+type stmtPC struct {
+	pc   uint64
+	line int
+}
+
+// checkStmtLocations checks that, at the address of every is_stmt line
+// entry of each function, all the variables declared on a previous line
+// of a scope containing the address have a location. A breakpoint on a
+// statement followed by printing the variables is the most common way of
+// using a debugger. Only done for unoptimized builds, optimizations can
+// legitimately make variables unavailable.
+func checkStmtLocations(dw *dwarf.Data, file Dwarfable, funcRanges []FuncRange) []Finding {
+	if inline || optimized {
+		return nil
+	}
+	rdr := dw.Reader()
+	locs := &locReader{
+		loc:      debugSection(file, "loc"),
+		loclists: debugSection(file, "loclists"),
+		addr:     debugSection(file, "addr"),
+		order:    rdr.ByteOrder(),
+		addrSize: rdr.AddressSize(),
+	}
+
+	idx := newFuncIndex(funcRanges)
+	stmts := make(map[*FuncRange][]stmtPC)
+	forEachFuncLineEntry(dw, funcRanges, func(lne *dwarf.LineEntry) {
+		if !lne.IsStmt || lne.EndSequence {
+			return
+		}
+		fr := getFunc(lne.Address, idx)
+		if fr == nil || fr.inlinedAt(lne.Address) != nil || !sameFile(lne.File.Name, fr.Fn.file) {
+			return
+		}
+		stmts[fr] = append(stmts[fr], stmtPC{lne.Address, lne.Line})
+	})
+
+	var r []Finding
+	for i := range funcRanges {
+		fr := &funcRanges[i]
+		if len(stmts[fr]) > 0 {
+			r = append(r, checkFuncStmtLocations(dw, locs, fr, stmts[fr])...)
+		}
+	}
+	return r
+}
+
+func checkFuncStmtLocations(dw *dwarf.Data, locs *locReader, fr *FuncRange, stmts []stmtPC) []Finding {
+	var r []Finding
+	err := walkScopes(dw, fr, func(e *dwarf.Entry, parent scope) {
+		if e.Tag != dwarf.TagVariable && e.Tag != dwarf.TagFormalParameter {
+			return
+		}
+		name, _ := entryName(dw, e)
+		line, _ := entryVal(dw, e, dwarf.AttrDeclLine).(int64)
+		if name == "" || name[0] == '.' || name == "_" {
+			// compiler generated, like the dictionary
+			return
+		}
+
+		var entries []locEntry
+		field := e.AttrField(dwarf.AttrLocation)
+		switch {
+		case field == nil:
+			// reported at the first statement in scope
+		case field.Class == dwarf.ClassExprLoc:
+			// valid everywhere in scope
+			return
+		case field.Class == dwarf.ClassLocListPtr || field.Class == dwarf.ClassLocList:
+			off := field.Val.(int64)
+			var err error
+			if field.Class == dwarf.ClassLocList {
+				off, err = locs.loclistx(fr.CU, off)
+			}
+			if err == nil {
+				entries, err = locs.list(fr.CU, off)
+			}
+			if err != nil {
+				// reported by the loc-list check
+				return
+			}
+		default:
+			return
+		}
+
+		for _, s := range stmts {
+			if s.line <= int(line) || !inRanges(s.pc, parent.rngs) {
+				// not declared yet or out of scope
+				continue
+			}
+			covered := false
+			for _, ent := range entries {
+				covered = covered || (s.pc >= ent.rng[0] && s.pc < ent.rng[1])
+			}
+			if covered {
+				continue
+			}
+			what := "no location list entry covers it"
+			if field == nil {
+				what = "it has no location"
+			}
+			r = append(r, Finding{
+				Check:     "loc-stmt",
+				Rule:      "LOC_MISSING_AT_STMT",
+				File:      fr.Fn.file,
+				Line:      s.line,
+				PC:        s.pc,
+				Func:      fr.Fn.Name,
+				Instance:  instanceName(fr.Name, fr.Fn),
+				StartLine: fr.Fn.startLine,
+				EndLine:   fr.Fn.endLine,
+				Message:   fmt.Sprintf("variable %s, declared on line %d, can't be printed at this statement: %s", name, line, what),
+			})
+			// the first statement is enough
+			break
+		}
+	})
+	if err != nil {
+		return append(r, funcMalformedFinding(fr, err, "reading the entries of the subprogram"))
+	}
+	return r
+}
+
+// inRanges returns true if pc is in one of rngs.
+func inRanges(pc uint64, rngs [][2]uint64) bool {
+	for _, rng := range rngs {
+		if pc >= rng[0] && pc < rng[1] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+)
+
+// levelTrace is the level of the messages about every line entry
+// examined, only printed with -vv.
+const levelTrace = slog.LevelDebug - 4
+
+// logLevel is the level of the messages printed by logger: warnings and
+// errors with -q, the progress of each input by default, compile units and
+// functions with -v and line entries with -vv.
+var logLevel = new(slog.LevelVar)
+
+// logger prints what is being checked to stderr, findings and errors
+// preventing an input from being checked are reported separately.
+var logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+	Level: logLevel,
+	ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+		switch a.Key {
+		case slog.TimeKey:
+			return slog.Attr{}
+		case slog.LevelKey:
+			if a.Value.Any().(slog.Level) == levelTrace {
+				a.Value = slog.StringValue("TRACE")
+			}
+		}
+		return a
+	},
+}))
+
+// setLogLevel sets the level of logger from the -q, -v and -vv flags.
+func setLogLevel(quiet, verbose, veryVerbose bool) {
+	switch {
+	case veryVerbose:
+		logLevel.Set(levelTrace)
+	case verbose:
+		logLevel.Set(slog.LevelDebug)
+	case quiet:
+		logLevel.Set(slog.LevelWarn)
+	}
+}
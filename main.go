@@ -1,26 +1,180 @@
 package main
 
 import (
-	"bytes"
-	"debug/dwarf"
-	"debug/elf"
-	"debug/macho"
-	"debug/pe"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"go/ast"
 	"go/parser"
-	"go/printer"
 	"go/token"
-	"io"
+	"io/fs"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
-	"sort"
+	"regexp"
+	"runtime"
 	"strings"
+	"time"
 )
 
 // if onlyStmt only check is_stmt instructions
-const onlyStmt = false
+var onlyStmt bool
+
+// if columns check the column numbers of line entries
+var columns bool
+
+// if blankLines line entries pointing at lines without code or with only
+// closing braces are reported
+var blankLines bool
+
+// if stmtCoverage statements without any line table entry are reported
+var stmtCoverage bool
+
+// if stmtBoundaries is_stmt line entries not at the start of a statement
+// and statements without is_stmt line entries are reported
+var stmtBoundaries bool
+
+// if orphanLines line entries with addresses not covered by any subprogram
+// are reported
+var orphanLines bool
+
+// if deferLines the functions with defer statements are disassembled to
+// check the lines of the calls generated for them
+var deferLines bool
+
+// if lineDirectives the files and lines referenced by //line directives
+// are checked to exist
+var lineDirectives bool
+
+// if allEntries check all instructions and compare the results with what
+// would be found checking only is_stmt instructions
+var allEntries bool
+
+// if compare is set it contains the paths of two go commands, each input
+// is built with both and only the differences are reported
+var compare string
+
+// goCommand is the go command used to build the inputs and to inspect
+// the executables, it is set by -go, -goroot and -gotip
+var goCommand = "go"
+
+// if targets is set each input is cross-compiled for every GOOS/GOARCH
+// pair in it and checked separately
+var targets []string
+
+// if inline inputs are built with inlining enabled
+var inline bool
+
+// flags passed to go build, gcflags replaces the default "-N -l"
+var gcflags, ldflags, tags, buildmode string
+
+// if optimized inputs are built with optimizations enabled
+var optimized bool
+
+// if testBinary inputs are built with go test -c and their test files are
+// checked too
+var testBinary bool
+
+// if cuFilter only the compile units of the checked packages are read
+var cuFilter bool
+
+// if fatalBuildErrors the first input that fails to build stops the run
+var fatalBuildErrors bool
+
+// buildRetries is the number of times a build that failed for a transient
+// reason, like a network error downloading modules, is retried
+var buildRetries int
+
+// if stats statistics about the line entries of each function are printed
+var stats bool
+
+// if listInstantiations the subprograms of the instantiations of generic
+// functions are printed instead of checking them
+var listInstantiations bool
+
+// if disasm the instructions around the PC of each finding are printed
+var disasm bool
+
+// if useDelve statement lines are also checked by setting breakpoints on
+// them with Delve
+var useDelve bool
+
+// if useGDB or useLLDB the line table is compared with the answers of gdb
+// or lldb
+var useGDB, useLLDB bool
+
+// if set only the functions whose name matches funcFilter and doesn't
+// match excludeFunc are checked
+var funcFilter, excludeFunc *regexp.Regexp
+
+// lines of source printed before and after the line of each finding
+var contextLines int
+
+// if dbPath is set the findings are appended to the SQLite database at
+// dbPath
+var dbPath string
+
+// serveAddr is the address the HTTP API is served on, set with -serve
+var serveAddr string
+
+// if watch the inputs are checked again every time their source files or
+// the toolchain change
+var watch bool
+
+// if noGroup consecutive findings differing only by their address are
+// reported separately
+var noGroup bool
+
+// if keep executables built for checking aren't deleted
+var keep bool
+
+// if timeout is set building and checking an input is stopped after it
+var timeout time.Duration
+
+// number of inputs checked in parallel
+var parallel int
+
+// if jsonOutput findings are collected and printed as JSON at the end
+var jsonOutput bool
+
+// if sarifOutput findings are collected and printed as a SARIF log at the end
+var sarifOutput bool
+
+// if ndjsonOutput findings are also collected but each one is printed as a
+// line of JSON as soon as the check finding it returns
+var ndjsonOutput bool
+
+// if baselineFile is set findings recorded in it aren't reported
+var baselineFile string
+
+// if updateBaseline findings are written to baselineFile instead
+var updateBaseline bool
+
+// if strictBaseline findings of the baseline that no longer happen are
+// reported as errors
+var strictBaseline bool
+
+var base *baseline
+
+// if binaryPath is set the executable at binaryPath is checked instead of
+// building the inputs
+var binaryPath string
+
+// if srcDir is set the sources of the -binary executable are read from it
+// instead of the paths recorded in its debug info
+var srcDir string
+
+// findings beyond this number make the exit status exitFindings
+var maxFindings int
+
+// exit statuses
+const (
+	exitClean    = 0
+	exitFindings = 1
+	exitError    = 2
+)
 
 func must(err error) {
 	if err != nil {
@@ -28,190 +182,720 @@ func must(err error) {
 	}
 }
 
-type Func struct {
-	Name               string
-	startLine, endLine int
-}
+func main() {
+	flag.BoolVar(&onlyStmt, "only-stmt", false, "only check is_stmt line entries")
+	flag.BoolVar(&allEntries, "all-entries", false, "check all line entries and compare with the is_stmt only results")
+	flag.BoolVar(&columns, "columns", false, "check the column numbers of line entries")
+	flag.BoolVar(&stmtCoverage, "stmt-coverage", false, "check that every statement has a line table entry")
+	flag.BoolVar(&stmtBoundaries, "stmt-boundaries", false, "check that is_stmt line entries are at the start of statements and that every statement has one")
+	flag.BoolVar(&blankLines, "blank-lines", false, "check that line entries don't point at blank lines, comments or closing braces of inner blocks")
+	flag.Float64Var(&lineSpread, "line-spread", 0, "report lines whose addresses span more than this fraction of their function, 0 to disable")
+	flag.Float64Var(&densityRatio, "density-ratio", 0, "report instantiations of a generic function with more than this many times the line entries of another instantiation, 0 to disable")
+	flag.BoolVar(&orphanLines, "orphan-lines", false, "check that the address of every line entry belongs to a subprogram")
+	flag.BoolVar(&deferLines, "defer-lines", false, "check that the calls generated for defer statements are attributed to the statement or to an exit of the function")
+	flag.BoolVar(&lineDirectives, "line-directives", false, "check that the lines referenced by //line directives exist")
+	flag.BoolVar(&inline, "inline", false, "build with inlining enabled and check inlined calls")
+	flag.StringVar(&gcflags, "gcflags", "", "flags passed to the compiler instead of -N -l")
+	flag.StringVar(&ldflags, "ldflags", "", "flags passed to the linker")
+	flag.StringVar(&tags, "tags", "", "comma separated build tags")
+	flag.StringVar(&buildmode, "buildmode", "", "build mode, for example pie")
+	flag.BoolVar(&testBinary, "test", false, "check the test executable of each input, built with go test -c")
+	flag.BoolVar(&cuFilter, "cu-filter", false, "only read the compile units of the checked packages, instantiations of generic functions emitted in other packages are skipped")
+	flag.IntVar(&buildRetries, "build-retries", 2, "number of times a build failing for a transient reason, like a network error, is retried")
+	flag.BoolVar(&fatalBuildErrors, "fatal-build-errors", false, "stop at the first input that fails to build instead of checking the others")
+	flag.BoolVar(&disasm, "disasm", false, "print the instructions around each finding with their line entries")
+	flag.BoolVar(&stats, "stats", false, "print line table statistics for each function and file")
+	flag.BoolVar(&heatmap, "heatmap", false, "print a bar for each function shading each source line by its number of line entries")
+	flag.StringVar(&heatmapHTML, "heatmap-html", "", "write the heatmaps of the functions of all inputs to this HTML file")
+	flag.BoolVar(&listInstantiations, "list-instantiations", false, "print the subprograms of the instantiations of generic functions with their shapes, PC range and number of line entries, without checking anything")
+	flag.BoolVar(&useDelve, "delve", false, "check that breakpoints set with dlv on each statement line resolve inside the function")
+	flag.BoolVar(&useGDB, "gdb", false, "compare the line table with the lines and addresses found by gdb")
+	flag.BoolVar(&useLLDB, "lldb", false, "compare the line table with the lines and addresses found by lldb")
+	flag.IntVar(&contextLines, "context", 0, "print this many source lines around the line of each finding")
+	flag.BoolVar(&noGroup, "no-group", false, "report each line entry separately instead of grouping consecutive findings for the same line")
+	flag.BoolVar(&tui, "tui", false, "browse the findings interactively, showing their source and disassembly and adding the triaged ones to the -baseline file")
+	flag.BoolVar(&watch, "watch", false, "check the inputs again every time they change, printing the new and fixed findings")
+	flag.BoolVar(&minimizeFindings, "minimize", false, "print the smallest program, obtained removing declarations and statements from the input .go file, that still has each finding")
+	flag.StringVar(&serveAddr, "serve", "", "serve an HTTP API checking the programs posted to /check on this address, unix:path for a Unix socket")
+	flag.StringVar(&cpuProfile, "cpuprofile", "", "write a CPU profile to this file")
+	flag.StringVar(&memProfile, "memprofile", "", "write a memory profile to this file before exiting")
+	flag.BoolVar(&keep, "keep", false, "keep the executables built for checking")
+	flag.StringVar(&cacheDir, "cache", "", "directory where the findings of each input are cached and reused until its sources, the toolchain or the flags change")
+	flag.DurationVar(&timeout, "timeout", 0, "time limit for building and checking each input, 0 for no limit")
+	flag.IntVar(&parallel, "p", runtime.NumCPU(), "number of inputs checked in parallel")
+	flag.BoolVar(&jsonOutput, "json", false, "print findings as JSON")
+	flag.BoolVar(&sarifOutput, "sarif", false, "print findings as a SARIF log")
+	flag.StringVar(&outputFormat, "format", "text", "output format: text, json, ndjson to print each finding as a line of JSON as soon as it is found, sarif, or tap and junit to report each input as a test failing with its findings")
+	flag.StringVar(&dbPath, "db", "", "append the run and its findings to this SQLite database, needs sqlite3")
+	flag.StringVar(&baselineFile, "baseline", "", "JSON file with known findings that should not be reported")
+	flag.BoolVar(&updateBaseline, "update-baseline", false, "write all findings to the -baseline file")
+	flag.BoolVar(&strictBaseline, "strict-baseline", false, "fail if findings in the -baseline file no longer happen")
+	flag.IntVar(&maxFindings, "max-findings", 0, "number of findings tolerated before exiting with status 1")
+	targetsFlag := flag.String("targets", "", "comma separated GOOS/GOARCH pairs to cross-compile each input for")
+	flag.StringVar(&snippet, "e", "", "check this snippet, wrapped in a main package if needed; - as an input reads a program from stdin")
+	flag.StringVar(&binaryPath, "binary", "", "check an existing executable instead of building the inputs")
+	flag.StringVar(&srcDir, "src", "", "directory containing the sources of the -binary executable")
+	funcFlag := flag.String("func", "", "only check the functions whose name matches this regular expression")
+	excludeFuncFlag := flag.String("exclude-func", "", "don't check the functions whose name matches this regular expression")
+	quiet := flag.Bool("q", false, "only print findings and errors")
+	verbose := flag.Bool("v", false, "also print the compile units, functions and checks examined")
+	veryVerbose := flag.Bool("vv", false, "like -v, also print every line entry examined")
+	severityFlag := flag.String("severity", "note", "only report findings of this severity or worse: note, warning or error")
+	checksFlag := flag.String("checks", "", "comma separated list of the checks to run, all by default")
+	flag.Func("env", "KEY=VALUE environment variable set for the go command, can be repeated", func(s string) error {
+		if k, _, ok := strings.Cut(s, "="); !ok || k == "" {
+			return fmt.Errorf("%q is not KEY=VALUE", s)
+		}
+		goEnv = append(goEnv, s)
+		return nil
+	})
+	flag.StringVar(&goCommand, "go", "go", "path of the go command used to build the inputs")
+	gorootFlag := flag.String("goroot", "", "use the go command of the toolchain installed in this directory")
+	gotipFlag := flag.Bool("gotip", false, "use gotip, installing it with golang.org/dl and downloading it if needed")
+	updateGotip := flag.Bool("update-gotip", false, "download the latest gotip before using it, implies -gotip")
+	modesFlag := flag.String("modes", "", "comma separated optimization levels to check each input with, reporting the levels each finding happens with: noopt, inl, opt and opt-inl")
+	flag.StringVar(&compare, "compare", "", "comma separated paths of two go commands, report findings that only happen with one of them")
+	configFlag := flag.String("config", "", "configuration file setting default flags and settings by directory, by default "+configName+" in the directory of the first input or one of its parents, none to not use one")
+	flag.Parse()
 
-type FuncRange struct {
-	Rng [2]uint64
-	Fn  *Func
-}
+	if *configFlag != "none" {
+		path := *configFlag
+		if path == "" {
+			path = findConfig(flag.Args())
+		}
+		if path != "" {
+			var err error
+			conf, err = loadConfig(path)
+			if err == nil {
+				err = conf.setFlags()
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(exitError)
+			}
+		}
+	}
 
-type Dwarfable interface {
-	DWARF() (*dwarf.Data, error)
-	Close() error
-}
+	if *checksFlag != "" {
+		var err error
+		enabledChecks, err = parseChecks(*checksFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+	}
 
-func main() {
-	for _, arg := range os.Args[1:] {
-		//fmt.Printf("%s\n", arg)
+	setLogLevel(*quiet, *verbose, *veryVerbose)
 
-		funcs := make(map[string]*Func)
+	var err error
+	minSeverity, err = parseSeverity(*severityFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitError)
+	}
 
-		getLineRanges(arg, funcs)
+	switch outputFormat {
+	case "text":
+	case "json", "ndjson", "sarif", "tap", "junit":
+		if jsonOutput || sarifOutput {
+			fmt.Fprintf(os.Stderr, "-json and -sarif can not be used with -format\n")
+			os.Exit(exitError)
+		}
+		// findings of tap and junit are only collected, like with -json
+		jsonOutput = outputFormat != "sarif"
+		sarifOutput = outputFormat == "sarif"
+		ndjsonOutput = outputFormat == "ndjson"
+	default:
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", outputFormat)
+		os.Exit(exitError)
+	}
 
-		file := build(arg)
-		if file == nil {
-			// couldn't build?
+	for _, re := range []struct {
+		flag string
+		p    **regexp.Regexp
+	}{{*funcFlag, &funcFilter}, {*excludeFuncFlag, &excludeFunc}} {
+		if re.flag == "" {
 			continue
 		}
+		var err error
+		*re.p, err = regexp.Compile(re.flag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+	}
 
-		dw, err := file.DWARF()
-		must(err)
+	if err := startProfiles(); err != nil {
+		fmt.Fprintf(os.Stderr, "could not start CPU profile: %v\n", err)
+		os.Exit(exitError)
+	}
 
-		funcRanges := getPCRanges(dw, funcs)
-		checkLines(dw, funcs, funcRanges)
+	if flag.Arg(0) == "diff" {
+		exit(diffMain(flag.Args()[1:]))
+	}
 
-		file.Close()
+	if parallel < 1 {
+		parallel = 1
 	}
-}
 
-func getLineRanges(path string, funcs map[string]*Func) {
-	var fset token.FileSet
-	file, err := parser.ParseFile(&fset, path, nil, 0)
-	must(err)
-	ast.Inspect(file, func(n ast.Node) bool {
-		if n == nil {
-			return false
-		}
-		switch n := n.(type) {
-		case *ast.FuncDecl:
-			s := fset.Position(n.Pos())
-			e := fset.Position(n.End())
-			name := n.Name.Name
-			if n.Recv != nil {
-				name = "(" + withoutTypeParams(exprToString(n.Recv.List[0].Type)) + ")." + name
-			}
-			funcs["main."+name] = &Func{Name: "main." + name, startLine: s.Line, endLine: e.Line}
-			return false
-		default:
-			return true
-			// TODO: function literals
-		}
-	})
-}
+	if gcflags != "" {
+		// checks that don't make sense with inlining depend on this
+		inline = !hasCompilerFlag(gcflags, "-l")
+		optimized = !hasCompilerFlag(gcflags, "-N")
+	}
 
-func exprToString(t ast.Expr) string {
-	var buf bytes.Buffer
-	printer.Fprint(&buf, token.NewFileSet(), t)
-	return buf.String()
-}
+	// the first interrupt cancels the inputs being checked and prints the
+	// results collected so far, the second one kills the program
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
-func withoutTypeParams(in string) string {
-	i := strings.Index(in, "[")
-	j := strings.LastIndex(in, "]")
-	if i >= 0 && j >= 0 && j > i {
-		return in[:i] + in[j+1:]
+	if flag.Arg(0) == "corpus" {
+		exit(corpusMain(ctx, flag.Args()[1:]))
 	}
-	return in
-}
 
-func getPCRanges(dw *dwarf.Data, funcs map[string]*Func) []FuncRange {
-	r := []FuncRange{}
+	goSet := false
+	flag.Visit(func(f *flag.Flag) { goSet = goSet || f.Name == "go" })
+	*gotipFlag = *gotipFlag || *updateGotip
+	nset := 0
+	for _, set := range []bool{goSet, *gorootFlag != "", *gotipFlag, compare != ""} {
+		if set {
+			nset++
+		}
+	}
+	if nset > 1 {
+		fmt.Fprintf(os.Stderr, "only one of -go, -goroot, -gotip and -compare can be used\n")
+		exit(exitError)
+	}
+	switch {
+	case *gorootFlag != "":
+		goCommand = filepath.Join(*gorootFlag, "bin", "go"+exeSuffix())
+	case *gotipFlag:
+		var err error
+		goCommand, err = setupGotip(*updateGotip)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "setting up gotip: %v\n", err)
+			exit(exitError)
+		}
+	}
+	if _, err := exec.LookPath(goCommand); err != nil {
+		fmt.Fprintf(os.Stderr, "go command: %v\n", err)
+		exit(exitError)
+	}
 
-	rdr := dw.Reader()
+	var gocmds [2]string
+	if compare != "" {
+		v := strings.Split(compare, ",")
+		if len(v) != 2 {
+			fmt.Fprintf(os.Stderr, "-compare needs two go commands separated by a comma\n")
+			exit(exitError)
+		}
+		copy(gocmds[:], v)
+	}
 
-	for {
-		e, err := rdr.Next()
-		if err != nil {
-			must(err)
-			break
+	if *targetsFlag != "" {
+		for _, target := range strings.Split(*targetsFlag, ",") {
+			if goos, goarch, ok := strings.Cut(target, "/"); !ok || goos == "" || goarch == "" {
+				fmt.Fprintf(os.Stderr, "bad target %q, should be GOOS/GOARCH\n", target)
+				exit(exitError)
+			}
+			targets = append(targets, target)
 		}
-		if e == nil {
-			break
+		if compare != "" || binaryPath != "" {
+			fmt.Fprintf(os.Stderr, "-targets can not be used with -compare or -binary\n")
+			exit(exitError)
 		}
-		if e.Tag != dwarf.TagSubprogram {
+	}
+
+	for _, dbg := range []struct {
+		name    string
+		enabled bool
+	}{{"dlv", useDelve}, {"gdb", useGDB}, {"lldb", useLLDB}} {
+		if !dbg.enabled {
 			continue
 		}
+		if _, err := exec.LookPath(dbg.name); err != nil {
+			fmt.Fprintf(os.Stderr, "checking with %s: %v\n", dbg.name, err)
+			exit(exitError)
+		}
+		if len(targets) > 0 {
+			fmt.Fprintf(os.Stderr, "checking with %s can not be done with -targets\n", dbg.name)
+			exit(exitError)
+		}
+	}
 
-		name, okname := e.Val(dwarf.AttrName).(string)
-		low, oklow := e.Val(dwarf.AttrLowpc).(uint64)
-		high, okhigh := e.Val(dwarf.AttrHighpc).(uint64)
-		if !okname || !oklow || !okhigh {
-			continue
+	args, err := snippetArgs(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exit(exitError)
+	}
+
+	if *modesFlag != "" {
+		modes, err = parseModes(*modesFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(exitError)
 		}
-		name = withoutTypeParams(name)
-		fn := funcs[name]
-		if fn == nil {
-			continue
+		if gcflags != "" || inline || compare != "" || len(targets) > 0 || binaryPath != "" || watch || serveAddr != "" || minimizeFindings || sarifOutput || (outputFormat != "text" && outputFormat != "json") || updateBaseline || dbPath != "" {
+			fmt.Fprintf(os.Stderr, "-modes can not be used with -gcflags, -inline, -compare, -targets, -binary, -watch, -serve, -minimize, -sarif, -format, -update-baseline or -db\n")
+			exit(exitError)
 		}
-		r = append(r, FuncRange{[2]uint64{low, high}, fn})
 	}
-	sort.Slice(r, func(i, j int) bool { return r[i].Rng[0] < r[j].Rng[0] })
-	return r
 
-}
+	if binaryPath != "" && (len(args) > 0 || compare != "") {
+		fmt.Fprintf(os.Stderr, "-binary can not be used with inputs or -compare\n")
+		exit(exitError)
+	}
+	if srcDir != "" && binaryPath == "" {
+		fmt.Fprintf(os.Stderr, "-src needs -binary\n")
+		exit(exitError)
+	}
 
-func build(path string) Dwarfable {
-	const tgt = "/tmp/badlngenerics-test"
-	out, err := exec.Command("go", "build", "-o", tgt, "-gcflags=-N -l", path).CombinedOutput()
-	if err != nil {
-		fmt.Printf("error compiling %s: %s", path, string(out))
-		return nil
+	if watch && snippetDir != "" {
+		fmt.Fprintf(os.Stderr, "-watch can not be used with - or -e\n")
+		exit(exitError)
+	}
+	if watch && (binaryPath != "" || jsonOutput || sarifOutput || updateBaseline || dbPath != "") {
+		fmt.Fprintf(os.Stderr, "-watch can not be used with -binary, -json, -sarif, -format, -update-baseline or -db\n")
+		exit(exitError)
+	}
+
+	if serveAddr != "" && (watch || binaryPath != "" || (outputFormat != "text" && outputFormat != "json") || sarifOutput || updateBaseline || dbPath != "" || len(args) > 0) {
+		fmt.Fprintf(os.Stderr, "-serve can not be used with inputs, -watch, -binary, -sarif, -format, -update-baseline or -db\n")
+		exit(exitError)
+	}
+
+	if minimizeFindings && (len(args) != 1 || !strings.HasSuffix(args[0], ".go") || watch || serveAddr != "" || binaryPath != "" || compare != "" || len(targets) > 0 || jsonOutput || sarifOutput) {
+		fmt.Fprintf(os.Stderr, "-minimize needs a single .go file and can not be used with -watch, -serve, -binary, -compare, -targets, -json, -sarif or -format\n")
+		exit(exitError)
 	}
-	f, _ := elf.Open(tgt)
-	if f != nil {
-		return f
+
+	if updateBaseline && baselineFile == "" {
+		fmt.Fprintf(os.Stderr, "-update-baseline needs -baseline\n")
+		exit(exitError)
+	}
+
+	if baselineFile != "" && !updateBaseline {
+		var err error
+		base, err = loadBaseline(baselineFile)
+		if err != nil && tui && errors.Is(err, fs.ErrNotExist) {
+			// created when the first finding is triaged
+			err = nil
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not read baseline: %v\n", err)
+			exit(exitError)
+		}
+	}
+
+	if flag.Arg(0) == "bisect" {
+		if compare != "" || binaryPath != "" {
+			fmt.Fprintf(os.Stderr, "bisect can not be used with -compare or -binary\n")
+			exit(exitError)
+		}
+		exit(bisectMain(ctx, flag.Args()[1:]))
+	}
+
+	if flag.Arg(0) == "gen" {
+		exit(genMain(ctx, flag.Args()[1:]))
+	}
+
+	if flag.Arg(0) == "bench" {
+		exit(benchMain(ctx, flag.Args()[1:]))
+	}
+
+	if watch {
+		exit(watchMain(ctx, groupFiles(expandArgs(args)), gocmds))
+	}
+
+	if minimizeFindings {
+		exit(minimizeMain(ctx, args[0], gocmds))
+	}
+
+	if serveAddr != "" {
+		exit(serveMain(ctx, serveAddr, gocmds))
+	}
+
+	if tui {
+		if watch || serveAddr != "" || minimizeFindings || len(modes) > 0 || jsonOutput || sarifOutput || updateBaseline {
+			fmt.Fprintf(os.Stderr, "-tui can not be used with -watch, -serve, -minimize, -modes, -json, -sarif, -format or -update-baseline\n")
+			exit(exitError)
+		}
+		// findings are only collected, like with -json, and they are
+		// browsed with their disassembly
+		jsonOutput = true
+		disasm = true
+	}
+
+	if len(modes) > 0 {
+		exit(modesMain(ctx, groupFiles(expandArgs(args)), gocmds))
+	}
+
+	// inputs are checked in parallel but their output is printed in order
+	var outs []chan *output
+	var inputs []input
+	if binaryPath != "" {
+		inputs = []input{{pkg: binaryPath}}
+		outs = append(outs, make(chan *output, 1))
+		outs[0] <- checkBinary(ctx, binaryPath)
 	} else {
-		f, _ := macho.Open(tgt)
-		if f != nil {
-			return f
-		} else {
-			f, _ := pe.Open(tgt)
-			if f != nil {
-				return f
+		inputs = groupFiles(expandArgs(args))
+		outs = checkInputs(ctx, inputs, gocmds)
+	}
+
+	findings := []Finding{}
+	failed := false
+	nfailed := 0
+	var buildErrs []*buildError
+	var results []*output
+	var heatmaps [][]funcHeatmap
+	for i := range outs {
+		out := <-outs[i]
+		results = append(results, out)
+		heatmaps = append(heatmaps, out.heatmaps)
+		// with tap and junit the errors are part of the test results, with
+		// -tui they are browsed, with ndjson every line of the standard
+		// output is a finding
+		switch {
+		case ndjsonOutput:
+			os.Stderr.Write(out.Bytes())
+		case outputFormat != "tap" && outputFormat != "junit" && !tui:
+			os.Stdout.Write(out.Bytes())
+		}
+		findings = append(findings, out.findings...)
+		if out.failed {
+			failed = true
+			nfailed++
+		}
+		if out.buildErr != nil {
+			if fatalBuildErrors {
+				exit(exitError)
 			}
+			buildErrs = append(buildErrs, out.buildErr)
+		}
+	}
+	interrupted := ctx.Err() != nil
+	if interrupted {
+		fmt.Fprintf(os.Stderr, "interrupted, some inputs were not checked\n")
+		failed = true
+	}
+	if len(buildErrs) > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d inputs failed to build:\n", len(buildErrs), len(outs))
+		for _, err := range buildErrs {
+			fmt.Fprintf(os.Stderr, "\t%s\n", err.path)
 		}
 	}
-	return nil
+
+	if tui {
+		exit(browseMain(os.Stdin, os.Stdout, inputNames(inputs), results))
+	}
+
+	switch {
+	case outputFormat == "tap":
+		must(writeTAP(os.Stdout, inputNames(inputs), results))
+	case outputFormat == "junit":
+		must(writeJUnit(os.Stdout, inputNames(inputs), results))
+	case sarifOutput:
+		must(writeSARIF(os.Stdout, findings))
+	case ndjsonOutput:
+		// already printed
+	case jsonOutput:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		must(enc.Encode(findings))
+	}
+
+	if heatmapHTML != "" {
+		if err := writeHeatmapFile(heatmapHTML, inputNames(inputs), heatmaps); err != nil {
+			fmt.Fprintf(os.Stderr, "could not write heatmap: %v\n", err)
+			failed = true
+		}
+	}
+
+	if updateBaseline && !interrupted {
+		must(writeBaseline(baselineFile, findings))
+	}
+
+	if dbPath != "" && !interrupted {
+		if err := writeDB(dbPath, len(outs), nfailed, findings); err != nil {
+			fmt.Fprintf(os.Stderr, "could not write database: %v\n", err)
+			failed = true
+		}
+	}
+
+	var missing []baselineEntry
+	if strictBaseline && base != nil && !interrupted {
+		missing = base.missing()
+		for _, e := range missing {
+			fmt.Fprintf(os.Stderr, "%s:%d %s %s: baselined finding no longer happens\n", e.File, e.Line, e.Func, e.Rule)
+		}
+	}
+
+	switch {
+	case failed:
+		exit(exitError)
+	case len(findings) > maxFindings || len(missing) > 0:
+		exit(exitFindings)
+	}
+	exit(exitClean)
 }
 
-func checkLines(dw *dwarf.Data, funcs map[string]*Func, funcRanges []FuncRange) {
-	rdr := dw.Reader()
+// checkInputs checks ins in parallel, the output of each one is sent to
+// the corresponding channel.
+func checkInputs(ctx context.Context, ins []input, gocmds [2]string) []chan *output {
+	outs := make([]chan *output, len(ins))
+	sem := make(chan struct{}, parallel)
+	for i := range ins {
+		outs[i] = make(chan *output, 1)
+		go func(i int) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			outs[i] <- checkInput(ctx, ins[i], gocmds)
+		}(i)
+	}
+	return outs
+}
+
+// checkInput checks input in. Inputs not yet checked when ctx is canceled
+// are skipped, the error isn't repeated for each one of them.
+func checkInput(ctx context.Context, in input, gocmds [2]string) *output {
+	out := &output{}
+	if ctx.Err() != nil {
+		out.failed = true
+		return out
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("timed out after %v", timeout))
+		defer cancel()
+	}
+
+	arg := in.String()
+	logger.Info("checking", "input", arg)
+	defer func() {
+		logger.Info("checked", "input", arg, "findings", len(out.findings), "failed", out.failed)
+	}()
 
-	for {
-		e, err := rdr.Next()
+	endParse := startPhase("parse")
+	pkgs, err := sourceFiles(in)
+	if err != nil {
+		out.error(err)
+		return out
+	}
+	pkgpath := pkgs[0].path
+
+	if pkgpath != "main" && !testBinary {
+		// go build doesn't produce an executable for other packages,
+		// they are checked in a test executable linking all their
+		// functions
+		in.libTest, err = newLibTest(pkgs[0], pkgs[0].dir)
+		if err == nil {
+			pkgs, err = sourceFiles(in)
+		}
 		if err != nil {
-			must(err)
-			break
+			out.error(err)
+			return out
 		}
-		if e == nil {
-			break
+		pkgpath = pkgs[0].path
+	}
+
+	funcs := make(map[string]*Func)
+
+	for _, pkg := range pkgs {
+		if err := getLineRanges(pkg.files, pkg.path, funcs); err != nil {
+			// syntax errors would also fail the build
+			out.error(&buildError{arg, err.Error()})
+			return out
 		}
-		if e.Tag != dwarf.TagCompileUnit {
-			continue
+		if err := getAsmRanges(pkg.asmFiles, pkg.path, funcs); err != nil {
+			out.error(err)
+			return out
 		}
+	}
+	endParse()
 
-		lnrdr, err := dw.LineReader(e)
-		must(err)
-		var lne dwarf.LineEntry
-		for {
-			err := lnrdr.Next(&lne)
-			if err == io.EOF {
-				break
-			}
-			must(err)
-			if onlyStmt && !lne.IsStmt {
-				continue
-			}
-			fn := getFunc(lne.Address, funcRanges)
-			if fn == nil {
-				continue
-			}
-			if lne.Line < fn.startLine || lne.Line > fn.endLine {
-				fmt.Printf("%s:%d %#x %s\n", filepath.Base(lne.File.Name), lne.Line, lne.Address, fn.Name)
+	key := cacheKey(ctx, in)
+	if key != "" {
+		if fs, ok := readCache(key); ok {
+			logger.Info("using cached findings", "input", arg, "key", key)
+			out.reportAll(fs)
+			return out
+		}
+	}
+
+	if compare != "" {
+		compareToolchains(ctx, out, gocmds, in, pkgpath, funcs)
+		return out
+	}
+
+	if len(targets) > 0 {
+		var fs []Finding
+		for _, target := range targets {
+			tfs, err := check(ctx, out, goCommand, target, in, pkgpath, funcs)
+			if err != nil {
+				out.error(fmt.Errorf("%s: %w", target, err))
 			}
+			fs = append(fs, tfs...)
+		}
+		if key != "" && !out.failed {
+			writeCache(key, arg, fs)
+		}
+		out.reportAll(fs)
+		out.reportTargetsSummary(out.findings)
+		return out
+	}
+
+	fs, err := check(ctx, out, goCommand, "", in, pkgpath, funcs)
+	if err != nil {
+		out.error(err)
+		if fs == nil {
+			return out
+		}
+	} else if key != "" {
+		writeCache(key, arg, fs)
+	}
+	out.reportAll(fs)
+	return out
+}
+
+// check builds input in using the go command gocmd for target, a
+// GOOS/GOARCH pair or the empty string for the host, and returns the
+// problems found with the debug info of the functions in funcs, which
+// belong to package pkgpath. If ctx is canceled while checking, the
+// findings so far are returned along with the error.
+func check(ctx context.Context, out *output, gocmd, target string, in input, pkgpath string, funcs map[string]*Func) ([]Finding, error) {
+	arg := in.String()
+	endBuild := startPhase("build")
+	file, err := build(ctx, gocmd, target, in)
+	endBuild()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	logger.Debug("built", "input", arg, "executable", file.path, "go", gocmd, "target", target)
+	if keep {
+		fmt.Fprintf(out, "executable for %s kept at %s\n", arg, file.path)
+	}
+
+	dw, err := file.DWARF()
+	if err != nil {
+		return nil, fmt.Errorf("could not read debug info of the executable built from %s: %v", arg, err)
+	}
+
+	var cfile Dwarfable = file
+	sdw, sfile, err := splitDWARF(dw, file, file.path, pkgpath)
+	if err != nil {
+		return nil, err
+	}
+	if sdw != nil {
+		defer splitFields.Delete(sdw)
+		dw, cfile = sdw, sfile
+	}
+
+	if compileUnit(dw, pkgpath) == nil {
+		return nil, fmt.Errorf("executable built from %s does not contain package %s", arg, pkgpath)
+	}
+
+	return runChecks(ctx, out, dw, cfile, file.path, pkgpath, target, funcs)
+}
+
+// hasCompilerFlag returns true if flag is one of the compiler flags in
+// flags, which is formatted like the argument of -gcflags or like the
+// flags recorded in DW_AT_producer.
+func hasCompilerFlag(flags, flag string) bool {
+	if i := strings.Index(flags, "="); i >= 0 && !strings.HasPrefix(flags, "-") {
+		// package pattern
+		flags = flags[i+1:]
+	}
+	for _, f := range strings.Fields(flags) {
+		if f == flag {
+			return true
 		}
 	}
+	return false
+}
+
+// pkgArg turns relative directory arguments into something that go list
+// and go build will not mistake for an import path.
+func pkgArg(arg string) string {
+	if strings.HasSuffix(arg, ".go") || filepath.IsAbs(arg) || strings.HasPrefix(arg, ".") {
+		return arg
+	}
+	if fi, err := os.Stat(arg); err == nil && fi.IsDir() {
+		return "." + string(filepath.Separator) + arg
+	}
+	return arg
 }
 
-func getFunc(pc uint64, funcRanges []FuncRange) *Func {
-	//TODO: inefficient
-	for i := range funcRanges {
-		if funcRanges[i].Rng[0] <= pc && pc < funcRanges[i].Rng[1] {
-			return funcRanges[i].Fn
+// srcPackage is a package whose functions are checked.
+type srcPackage struct {
+	path     string // path qualifying the names of its symbols
+	dir      string
+	files    []string
+	asmFiles []string
+}
+
+// sourceFiles returns the packages of input in. If in is built as a test
+// executable the test files are included and the external test package,
+// if any, is returned as a second package.
+func sourceFiles(in input) ([]srcPackage, error) {
+	arg := in.String()
+	if in.files != nil {
+		if testBinary {
+			return nil, fmt.Errorf("-test needs a package, not %s", arg)
+		}
+		files := in.files
+		name := ""
+		for _, file := range files {
+			f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.PackageClauseOnly)
+			if err != nil {
+				return nil, err
+			}
+			if name != "" && f.Name.Name != name {
+				return nil, fmt.Errorf("files of %s belong to different packages, %s and %s", arg, name, f.Name.Name)
+			}
+			name = f.Name.Name
+		}
+		return []srcPackage{{packagePath(name, "command-line-arguments"), filepath.Dir(files[0]), files, nil}}, nil
+	}
+	args := []string{"list", "-json"}
+	if tags != "" {
+		args = append(args, "-tags="+tags)
+	}
+	out, err := goCmd(context.Background(), goCommand, nil, append(args, in.buildArgs()...)...).Output()
+	if err != nil {
+		if exitErr, isExitErr := err.(*exec.ExitError); isExitErr {
+			out = exitErr.Stderr
 		}
+		return nil, fmt.Errorf("error listing %s: %s", arg, strings.TrimSpace(string(out)))
+	}
+	var pkg struct {
+		Dir          string
+		Name         string
+		ImportPath   string
+		GoFiles      []string
+		SFiles       []string
+		TestGoFiles  []string
+		XTestGoFiles []string
+	}
+	must(json.Unmarshal(out, &pkg))
+	join := func(names []string) []string {
+		files := make([]string, len(names))
+		for i := range names {
+			files[i] = filepath.Join(pkg.Dir, names[i])
+		}
+		return files
+	}
+	if !in.test() {
+		return []srcPackage{{packagePath(pkg.Name, pkg.ImportPath), pkg.Dir, join(pkg.GoFiles), join(pkg.SFiles)}}, nil
+	}
+	// in test executables even main packages are qualified by their
+	// import path
+	pkgs := []srcPackage{{pkg.ImportPath, pkg.Dir, join(append(pkg.GoFiles, pkg.TestGoFiles...)), join(pkg.SFiles)}}
+	if len(pkg.XTestGoFiles) > 0 {
+		pkgs = append(pkgs, srcPackage{pkg.ImportPath + "_test", pkg.Dir, join(pkg.XTestGoFiles), nil})
 	}
-	return nil
+	return pkgs, nil
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"debug/dwarf"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+)
+
+// dwarfUnit is a compile unit of the debug info.
+type dwarfUnit struct {
+	off  dwarf.Offset // offset of the compile unit entry
+	name string
+}
+
+// compileUnits returns the compile units of dw, sorted by offset. Units
+// after one whose entry can't be read are not returned.
+func compileUnits(dw *dwarf.Data) []dwarfUnit {
+	var r []dwarfUnit
+	rdr := dw.Reader()
+	for {
+		e, err := rdr.Next()
+		if err != nil || e == nil {
+			break
+		}
+		if e.Tag == dwarf.TagCompileUnit {
+			r = append(r, dwarfUnit{e.Offset, compileUnitName(e)})
+		}
+		rdr.SkipChildren()
+	}
+	return r
+}
+
+// unitAt returns the index of the compile unit of units containing the
+// entry at off, -1 if it's before the first one.
+func unitAt(units []dwarfUnit, off dwarf.Offset) int {
+	return sort.Search(len(units), func(i int) bool { return units[i].off > off }) - 1
+}
+
+// malformedFinding returns the finding reporting err, an error decoding
+// the debug info with the compile units units. The compile unit is the
+// one containing the offset of err if it's a dwarf.DecodeError.
+func malformedFinding(units []dwarfUnit, err error, format string, args ...interface{}) Finding {
+	f := Finding{Check: "dwarf-malformed", Rule: "DWARF_MALFORMED", Message: fmt.Sprintf(format, args...) + ": " + err.Error()}
+	var derr dwarf.DecodeError
+	if errors.As(err, &derr) {
+		if i := unitAt(units, derr.Offset); i >= 0 {
+			f.Func = units[i].name
+		}
+	}
+	return f
+}
+
+// funcMalformedFinding returns the finding reporting err, an error reading
+// the debug info of the function of fr.
+func funcMalformedFinding(fr *FuncRange, err error, format string, args ...interface{}) Finding {
+	return Finding{
+		Check:     "dwarf-malformed",
+		Rule:      "DWARF_MALFORMED",
+		File:      fr.Fn.file,
+		Line:      fr.Fn.startLine,
+		PC:        fr.lowpc(),
+		Func:      fr.Fn.Name,
+		Instance:  instanceName(fr.Name, fr.Fn),
+		StartLine: fr.Fn.startLine,
+		EndLine:   fr.Fn.endLine,
+		Message:   fmt.Sprintf(format, args...) + ": " + err.Error(),
+	}
+}
+
+// decodeError is the panic of a function that can't return err, an error
+// reading the debug info.
+type decodeError struct {
+	err error
+}
+
+// mustDecode panics with a decodeError if err, an error reading the debug
+// info, is not nil.
+func mustDecode(err error) {
+	if err != nil {
+		panic(decodeError{err})
+	}
+}
+
+// recoverMalformed converts the panic of a function reading the debug
+// info, which can be malformed, into an error returned through err. Only
+// the panics of mustDecode and dwarf.DecodeError are recovered, any other
+// panic is a bug.
+func recoverMalformed(err *error) {
+	e := recover()
+	switch e := e.(type) {
+	case nil:
+		return
+	case decodeError:
+		*err = e.err
+	case dwarf.DecodeError:
+		*err = e
+	default:
+		panic(e)
+	}
+	logger.Debug("recovered", "err", *err, "stack", string(debug.Stack()))
+}
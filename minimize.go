@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// if minimizeFindings the program of the input is minimized for each of
+// its findings
+var minimizeFindings bool
+
+// minimizeMain checks the program in the .go file path and prints, for
+// each function with findings of a rule, the smallest program that still
+// has such a finding. It returns the exit status.
+func minimizeMain(ctx context.Context, path string, gocmds [2]string) int {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	out := checkInput(ctx, argInput(path), gocmds)
+	os.Stdout.Write(out.Bytes())
+	if out.failed {
+		return exitError
+	}
+	seen := make(map[string]bool)
+	for _, f := range out.findings {
+		key := minimizeKey(f)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		small := minimize(ctx, src, func(src []byte) bool {
+			return reproduces(ctx, filepath.Base(path), src, key, gocmds)
+		})
+		if ctx.Err() != nil {
+			return exitError
+		}
+		fmt.Printf("--- %s in %s, %d of %d lines\n%s", f.Rule, f.Func, bytes.Count(small, []byte("\n")), bytes.Count(src, []byte("\n")), small)
+	}
+	if len(out.findings) > maxFindings {
+		return exitFindings
+	}
+	return exitClean
+}
+
+// minimizeKey identifies the finding a minimized program must still
+// produce, line numbers change as the program shrinks.
+func minimizeKey(f Finding) string {
+	return f.Rule + " " + f.Func
+}
+
+// reproduces returns true if checking the program src, written to a file
+// called name in a temporary directory, produces a finding with key.
+func reproduces(ctx context.Context, name string, src []byte, key string, gocmds [2]string) bool {
+	dir, err := os.MkdirTemp("", "badlngenerics-min-")
+	if err != nil {
+		return false
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, src, 0666); err != nil {
+		return false
+	}
+	out := checkInput(ctx, argInput(path), gocmds)
+	if out.failed {
+		return false
+	}
+	for _, f := range out.findings {
+		if minimizeKey(f) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// minimize returns the smallest program obtained removing declarations
+// and statements from the program src that still makes keep
+// return true. Comments are dropped. If the program can't be parsed, or
+// formatting it makes keep return false, src is returned unchanged.
+func minimize(ctx context.Context, src []byte, keep func([]byte) bool) []byte {
+	cur, ok := removeNodes(src, -1, 0)
+	if !ok || !keep(cur) {
+		return src
+	}
+	for changed := true; changed && ctx.Err() == nil; {
+		changed = false
+		// removing a declaration together with its uses needs removing
+		// more than one statement at once
+		for _, span := range []int{4, 2, 1} {
+			// the candidates after a removed one take its place
+			for i := 0; ctx.Err() == nil; {
+				next, ok := removeNodes(cur, i, span)
+				if !ok {
+					break
+				}
+				if !bytes.Equal(next, cur) && keep(next) {
+					logger.Debug("minimized", "size", len(next))
+					cur, changed = next, true
+					continue
+				}
+				i++
+			}
+		}
+	}
+	return cur
+}
+
+// removeNodes removes the n-th removable node, in depth first order, and
+// the span-1 nodes following it in the same list from the program src and
+// returns the formatted result, without the imports no longer used. It
+// returns false if the program has less than n+1 removable nodes, or
+// doesn't parse.
+func removeNodes(src []byte, n, span int) ([]byte, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return nil, false
+	}
+
+	i := 0
+	removed := n < 0
+	// removeStmts returns list without the statements starting with the
+	// n-th node, descending into the others
+	var removeStmts func(list []ast.Stmt) []ast.Stmt
+	var visit func(node ast.Node)
+	removeStmts = func(list []ast.Stmt) []ast.Stmt {
+		for j := 0; j < len(list); j++ {
+			if !removed && i == n {
+				removed = true
+				return append(list[:j:j], list[min(j+span, len(list)):]...)
+			}
+			i++
+			visit(list[j])
+		}
+		return list
+	}
+	visit = func(node ast.Node) {
+		ast.Inspect(node, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.BlockStmt:
+				node.List = removeStmts(node.List)
+				return false
+			case *ast.CaseClause:
+				node.Body = removeStmts(node.Body)
+				return false
+			case *ast.CommClause:
+				node.Body = removeStmts(node.Body)
+				return false
+			}
+			return true
+		})
+	}
+
+	for j := 0; j < len(file.Decls); j++ {
+		if gd, ok := file.Decls[j].(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			// unused imports are removed below
+			continue
+		}
+		if !removed && i == n {
+			removed = true
+			file.Decls = append(file.Decls[:j:j], file.Decls[min(j+span, len(file.Decls)):]...)
+			break
+		}
+		i++
+		visit(file.Decls[j])
+	}
+	if !removed {
+		return nil, false
+	}
+	removeUnusedImports(file)
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, false
+	}
+	return tidyBlankLines(buf.Bytes()), true
+}
+
+// removeUnusedImports removes the imports of file whose name isn't used,
+// imports for their side effects are kept.
+func removeUnusedImports(file *ast.File) {
+	used := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+	decls := file.Decls[:0]
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			decls = append(decls, decl)
+			continue
+		}
+		specs := gd.Specs[:0]
+		for _, spec := range gd.Specs {
+			is := spec.(*ast.ImportSpec)
+			path, _ := strconv.Unquote(is.Path.Value)
+			name := path[strings.LastIndex(path, "/")+1:]
+			if is.Name != nil {
+				name = is.Name.Name
+			}
+			if used[name] || name == "_" || name == "." || path == "C" {
+				specs = append(specs, spec)
+			}
+		}
+		gd.Specs = specs
+		if len(specs) > 0 {
+			decls = append(decls, gd)
+		}
+	}
+	file.Decls = decls
+}
+
+// tidyBlankLines removes the blank lines left at the start and at the end
+// of blocks by removed nodes.
+func tidyBlankLines(src []byte) []byte {
+	lines := bytes.Split(src, []byte("\n"))
+	var r [][]byte
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 && i > 0 && i+1 < len(lines) {
+			prev := bytes.TrimSpace(r[len(r)-1])
+			next := bytes.TrimSpace(lines[i+1])
+			if bytes.HasSuffix(prev, []byte("{")) || bytes.HasPrefix(next, []byte("}")) || len(next) == 0 {
+				continue
+			}
+		}
+		r = append(r, line)
+	}
+	return bytes.Join(r, []byte("\n"))
+}
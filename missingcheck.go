@@ -0,0 +1,49 @@
+package main
+
+import "strings"
+
+// checkMissingFuncs reports the checked functions, and the instantiations
+// of generic functions, that have code in the executable but no
+// DW_TAG_subprogram with address ranges. Functions removed by the linker
+// or always inlined have no entry in the runtime's function table and are
+// not reported.
+func checkMissingFuncs(file Dwarfable, funcRanges []FuncRange, funcs map[string]*Func) []Finding {
+	tab := pclntab(file)
+	if tab == nil {
+		return nil
+	}
+	found := make(map[string]bool)
+	for _, fr := range funcRanges {
+		found[fr.Name] = true
+	}
+
+	var r []Finding
+	for i := range tab.Funcs {
+		sym := &tab.Funcs[i]
+		fn := funcs[withoutTypeParams(sym.Name)]
+		if fn == nil || found[sym.Name] || isInstantiationWrapper(sym.Name) || !checkedFunc(fn.Name) {
+			continue
+		}
+		if cuFilter && strings.Contains(sym.Name, "[") {
+			// instantiations in the compile units of other packages
+			// aren't read
+			continue
+		}
+		f := Finding{
+			Check:     "missing-func",
+			Rule:      "SUBPROGRAM_MISSING",
+			File:      fn.file,
+			Line:      fn.startLine,
+			PC:        sym.Entry,
+			Func:      fn.Name,
+			StartLine: fn.startLine,
+			EndLine:   fn.endLine,
+			Message:   "no DW_TAG_subprogram",
+		}
+		if f.Instance = instanceName(sym.Name, fn); f.Instance != "" {
+			f.Message = "no DW_TAG_subprogram for the instantiation"
+		}
+		r = append(r, f)
+	}
+	return r
+}
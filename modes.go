@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// buildModes are the optimization levels that can be used with -modes and
+// the compiler flags they are built with.
+var buildModes = []struct{ name, gcflags string }{
+	{"noopt", "-N -l"},
+	{"inl", "-N"},
+	{"opt", "-l"},
+	// any flag replaces the default -N -l, -l=0 is the default inlining
+	{"opt-inl", "-l=0"},
+}
+
+// if modes is set each input is checked once for each of the optimization
+// levels in it and the findings of the levels are compared
+var modes []string
+
+// parseModes parses the argument of -modes, a comma separated list of
+// optimization levels.
+func parseModes(s string) ([]string, error) {
+	var r []string
+	for _, name := range strings.Split(s, ",") {
+		found := false
+		for _, m := range buildModes {
+			found = found || m.name == name
+		}
+		if !found {
+			var names []string
+			for _, m := range buildModes {
+				names = append(names, m.name)
+			}
+			return nil, fmt.Errorf("unknown mode %q, known modes: %s", name, strings.Join(names, ","))
+		}
+		r = append(r, name)
+	}
+	return r, nil
+}
+
+// setMode sets the compiler flags of the optimization level called name.
+func setMode(name string) {
+	for _, m := range buildModes {
+		if m.name == name {
+			gcflags = m.gcflags
+		}
+	}
+	inline = !hasCompilerFlag(gcflags, "-l")
+	optimized = !hasCompilerFlag(gcflags, "-N")
+}
+
+// modesMain checks inputs once for each optimization level of -modes and
+// prints, for each input, the levels each finding happens with. Levels are
+// checked one after the other, the checks depend on the flags of the
+// build.
+func modesMain(ctx context.Context, inputs []input, gocmds [2]string) int {
+	// findings are only collected, like with -json
+	printJSON := jsonOutput
+	jsonOutput = true
+	results := make([][]*output, len(modes)) // by mode and input
+	for i, mode := range modes {
+		if ctx.Err() != nil {
+			break
+		}
+		setMode(mode)
+		logger.Info("checking mode", "mode", mode, "gcflags", gcflags)
+		outs := checkInputs(ctx, inputs, gocmds)
+		for j := range outs {
+			results[i] = append(results[i], <-outs[j])
+		}
+	}
+	jsonOutput = printJSON
+
+	// addresses change between levels, findings are matched using the
+	// function, the source line and the rule
+	type row struct {
+		f     Finding
+		modes []bool
+	}
+	status := exitClean
+	findings := []Finding{}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for j, input := range inputs {
+		rows := make(map[string]*row)
+		for i, mode := range modes {
+			if j >= len(results[i]) {
+				status = exitError
+				continue
+			}
+			out := results[i][j]
+			if out.failed {
+				fmt.Printf("%s with %s: %s", input, mode, out.String())
+				status = exitError
+			}
+			for _, f := range out.findings {
+				f.Mode = mode
+				findings = append(findings, f)
+				key := fmt.Sprintf("%s %s:%d %s", f.Func, f.File, f.Line, f.Rule)
+				if rows[key] == nil {
+					rows[key] = &row{f, make([]bool, len(modes))}
+				}
+				rows[key].modes[i] = true
+			}
+		}
+		if jsonOutput || len(rows) == 0 {
+			continue
+		}
+
+		sorted := make([]*row, 0, len(rows))
+		for _, r := range rows {
+			sorted = append(sorted, r)
+		}
+		sort.Slice(sorted, func(a, b int) bool {
+			fa, fb := sorted[a].f, sorted[b].f
+			if fa.File != fb.File {
+				return fa.File < fb.File
+			}
+			if fa.Line != fb.Line {
+				return fa.Line < fb.Line
+			}
+			return fa.Rule < fb.Rule
+		})
+		fmt.Fprintf(w, "%s\n", input)
+		fmt.Fprintf(w, "%s\t\n", strings.Join(modes, "\t"))
+		for _, r := range sorted {
+			for _, in := range r.modes {
+				mark := "-"
+				if in {
+					mark = "x"
+				}
+				fmt.Fprintf(w, "%s\t", mark)
+			}
+			name := r.f.Func
+			if r.f.Instance != "" {
+				name = r.f.Instance
+			}
+			fmt.Fprintf(w, "%s:%d %s [%s %s]", baseName(r.f.File), r.f.Line, name, r.f.Severity, r.f.Rule)
+			if r.f.Message != "" {
+				fmt.Fprintf(w, " %s", r.f.Message)
+			}
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		must(enc.Encode(findings))
+	}
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "interrupted, some inputs were not checked\n")
+		status = exitError
+	}
+	if status == exitClean && len(findings) > maxFindings {
+		status = exitFindings
+	}
+	return status
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+)
+
+// checkAbstractOrigins checks the entries of each function that refer to
+// an abstract entry with DW_AT_abstract_origin, which the compiler emits
+// for inlinable functions: the reference must resolve to an entry of the
+// right kind, attributes repeated in the concrete entry must agree with the
+// abstract one and inlined calls must be inside the scope containing them.
+func checkAbstractOrigins(dw *dwarf.Data, funcRanges []FuncRange) []Finding {
+	var r []Finding
+	for i := range funcRanges {
+		r = append(r, checkFuncOrigins(dw, &funcRanges[i])...)
+	}
+	return r
+}
+
+func checkFuncOrigins(dw *dwarf.Data, fr *FuncRange) []Finding {
+	var r []Finding
+	fn := fr.Fn
+	finding := func(rule string, line int, pc uint64, format string, args ...interface{}) {
+		r = append(r, Finding{
+			Check:     "abstract-origin",
+			Rule:      rule,
+			File:      fn.file,
+			Line:      line,
+			PC:        pc,
+			Func:      fn.Name,
+			Instance:  instanceName(fr.Name, fn),
+			StartLine: fn.startLine,
+			EndLine:   fn.endLine,
+			Message:   fmt.Sprintf(format, args...),
+		})
+	}
+
+	check := func(e *dwarf.Entry, line int) {
+		off, ok := e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+		if !ok {
+			return
+		}
+		rdr := dw.Reader()
+		rdr.Seek(off)
+		ae, err := rdr.Next()
+		if err != nil || ae == nil || ae.Tag == 0 {
+			finding("ORIGIN_UNRESOLVED", line, fr.lowpc(), "%v at %#x: abstract origin %#x does not resolve", e.Tag, e.Offset, off)
+			return
+		}
+		want := e.Tag
+		if e.Tag == dwarf.TagInlinedSubroutine {
+			want = dwarf.TagSubprogram
+		}
+		if ae.Tag != want {
+			finding("ORIGIN_MISMATCH", line, fr.lowpc(), "%v at %#x: abstract origin %#x is a %v", e.Tag, e.Offset, off, ae.Tag)
+			return
+		}
+		// file numbers are not compared, the abstract entry can belong to
+		// another compile unit
+		for _, attr := range []dwarf.Attr{dwarf.AttrName, dwarf.AttrDeclLine, dwarf.AttrType} {
+			v, av := e.Val(attr), ae.Val(attr)
+			if v != nil && av != nil && v != av {
+				finding("ORIGIN_MISMATCH", line, fr.lowpc(), "%v at %#x: %v is %v, %v in the abstract origin", e.Tag, e.Offset, attr, v, av)
+			}
+		}
+	}
+
+	rdr := dw.Reader()
+	rdr.Seek(fr.Offset)
+	e, err := rdr.Next()
+	mustDecode(err)
+	if e != nil {
+		check(e, fn.startLine)
+	}
+
+	err = walkScopes(dw, fr, func(e *dwarf.Entry, parent scope) {
+		line := fn.startLine
+		if callLine, ok := e.Val(dwarf.AttrCallLine).(int64); ok {
+			line = int(callLine)
+		}
+		check(e, line)
+		if e.Tag != dwarf.TagInlinedSubroutine {
+			return
+		}
+		rngs, err := dw.Ranges(e)
+		if err != nil {
+			return
+		}
+		for _, rng := range rngs {
+			if !containedIn(rng, parent.rngs) {
+				name, _ := entryName(dw, e)
+				finding("INLINED_CALL_OUT_OF_SCOPE", line, rng[0], "call of %s inlined at %#x-%#x outside of the scope containing it", name, rng[0], rng[1])
+			}
+		}
+	})
+	if err != nil {
+		return append(r, funcMalformedFinding(fr, err, "reading the entries of the subprogram"))
+	}
+	return r
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"strings"
+)
+
+// checkParams checks that every named parameter and result of each
+// function, and the dictionary of the shape instantiations of generic
+// functions, has a DW_TAG_formal_parameter with a type, declared on the
+// lines of the signature.
+func checkParams(dw *dwarf.Data, funcRanges []FuncRange) []Finding {
+	var r []Finding
+	for i := range funcRanges {
+		r = append(r, checkFuncParams(dw, &funcRanges[i])...)
+	}
+	return r
+}
+
+func checkFuncParams(dw *dwarf.Data, fr *FuncRange) []Finding {
+	var r []Finding
+	fn := fr.Fn
+	finding := func(rule string, line int, format string, args ...interface{}) {
+		r = append(r, Finding{
+			Check:     "param",
+			Rule:      rule,
+			File:      fn.file,
+			Line:      line,
+			PC:        fr.lowpc(),
+			Func:      fn.Name,
+			Instance:  instanceName(fr.Name, fn),
+			StartLine: fn.startLine,
+			EndLine:   fn.endLine,
+			Message:   fmt.Sprintf(format, args...),
+		})
+	}
+
+	// the concrete copies of inlined functions get the parameters missing
+	// from their entry, and their attributes, from the abstract origin,
+	// whose parameters have no declaration line
+	params := make(map[string]bool)
+	origin, concrete := subprogramOrigin(dw, fr.Offset)
+	for _, name := range formalParams(dw, origin) {
+		params[name] = true
+	}
+	err := walkScopes(dw, fr, func(e *dwarf.Entry, parent scope) {
+		if e.Tag != dwarf.TagFormalParameter || parent.off != fr.Offset {
+			return
+		}
+		line, hasLine := entryVal(dw, e, dwarf.AttrDeclLine).(int64)
+		name, ok := entryName(dw, e)
+		if !ok || name == "" {
+			finding("PARAM_INCOMPLETE", int(line), "parameter without a name")
+			return
+		}
+		params[name] = true
+		if entryVal(dw, e, dwarf.AttrType) == nil {
+			finding("PARAM_INCOMPLETE", int(line), "parameter %s without a type", name)
+		}
+		switch {
+		case !hasLine && concrete:
+		case !hasLine:
+			finding("PARAM_INCOMPLETE", fn.startLine, "parameter %s without a declaration line", name)
+		case strings.HasPrefix(name, "."):
+			// the dictionary of closures is declared at the enclosing
+			// function
+		case !fn.adjusted && (int(line) < fn.startLine || int(line) > fn.sigLine):
+			finding("PARAM_OUTSIDE_SIGNATURE", int(line), "parameter %s declared outside of the signature (lines %d-%d)", name, fn.startLine, fn.sigLine)
+		}
+	})
+	if err != nil {
+		return append(r, funcMalformedFinding(fr, err, "reading the entries of the subprogram"))
+	}
+
+	for _, name := range fn.params {
+		if !params[name] {
+			finding("PARAM_MISSING", fn.startLine, "parameter %s has no DW_TAG_formal_parameter", name)
+		}
+	}
+	if fn.generic && strings.Contains(fr.Name, "go.shape.") && !params[".dict"] {
+		finding("PARAM_MISSING", fn.startLine, "dictionary parameter has no DW_TAG_formal_parameter")
+	}
+	return r
+}
+
+// subprogramOrigin returns the offset of the abstract origin of the
+// subprogram at off, if it has one.
+func subprogramOrigin(dw *dwarf.Data, off dwarf.Offset) (dwarf.Offset, bool) {
+	rdr := dw.Reader()
+	rdr.Seek(off)
+	e, err := rdr.Next()
+	if err != nil || e == nil {
+		return 0, false
+	}
+	origin, ok := e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+	return origin, ok
+}
+
+// formalParams returns the names of the formal parameters of the
+// subprogram at off, nil if off is zero.
+func formalParams(dw *dwarf.Data, off dwarf.Offset) []string {
+	if off == 0 {
+		return nil
+	}
+	rdr := dw.Reader()
+	rdr.Seek(off)
+	e, err := rdr.Next()
+	if err != nil || e == nil || !e.Children {
+		return nil
+	}
+	var r []string
+	for {
+		e, err := rdr.Next()
+		if err != nil || e == nil || e.Tag == 0 {
+			return r
+		}
+		if e.Tag == dwarf.TagFormalParameter {
+			if name, ok := e.Val(dwarf.AttrName).(string); ok {
+				r = append(r, name)
+			}
+		}
+		rdr.SkipChildren()
+	}
+}
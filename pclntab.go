@@ -0,0 +1,142 @@
+package main
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"debug/gosym"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+)
+
+// checkPclntab checks that the line table of the Go runtime agrees with
+// the DWARF line table at every line entry of the checked functions.
+func checkPclntab(dw *dwarf.Data, file Dwarfable, funcRanges []FuncRange) []Finding {
+	tab := pclntab(file)
+	if tab == nil {
+		return nil
+	}
+
+	var r []Finding
+
+	idx := newFuncIndex(funcRanges)
+
+	forEachFuncLineEntry(dw, funcRanges, func(lne *dwarf.LineEntry) {
+		if lne.EndSequence {
+			return
+		}
+		fr := getFunc(lne.Address, idx)
+		if fr == nil {
+			return
+		}
+		file, line, _ := tab.PCToLine(lne.Address)
+		if line == lne.Line && sameFile(file, lne.File.Name) {
+			return
+		}
+		r = append(r, Finding{
+			Check:     "pclntab",
+			Rule:      "PCLNTAB_MISMATCH",
+			File:      lne.File.Name,
+			Line:      lne.Line,
+			PC:        lne.Address,
+			Func:      fr.Fn.Name,
+			Instance:  instanceName(fr.Name, fr.Fn),
+			StartLine: fr.Fn.startLine,
+			EndLine:   fr.Fn.endLine,
+			IsStmt:    lne.IsStmt,
+			Message:   fmt.Sprintf("gopclntab says %s:%d", baseName(file), line),
+		})
+	})
+
+	return r
+}
+
+// pclntab returns the line table used by the Go runtime, or nil if it
+// can't be found.
+func pclntab(f Dwarfable) *gosym.Table {
+	var data []byte
+	var text uint64
+
+	switch f := f.(type) {
+	case *builtBinary:
+		return pclntab(f.Dwarfable)
+	case *splitBinary:
+		return pclntab(f.Dwarfable)
+	case *detachedBinary:
+		return pclntab(f.Dwarfable)
+	case *elf.File:
+		s, ts := f.Section(".gopclntab"), f.Section(".text")
+		if s == nil {
+			// PIE executables
+			s = f.Section(".data.rel.ro.gopclntab")
+		}
+		if s == nil || ts == nil {
+			return nil
+		}
+		data, _ = s.Data()
+		text = ts.Addr
+		// with external linking (for example with cgo) C code can come
+		// before the Go code in .text
+		if syms, err := f.Symbols(); err == nil {
+			for _, sym := range syms {
+				if sym.Name == "runtime.text" {
+					text = sym.Value
+					break
+				}
+			}
+		}
+	case *macho.File:
+		s, ts := f.Section("__gopclntab"), f.Section("__text")
+		if s == nil || ts == nil {
+			return nil
+		}
+		data, _ = s.Data()
+		text = ts.Addr
+		if f.Symtab != nil {
+			for _, sym := range f.Symtab.Syms {
+				if sym.Name == "runtime.text" {
+					text = sym.Value
+					break
+				}
+			}
+		}
+	case *pe.File:
+		// on windows the table is in .rdata, delimited by runtime.pclntab
+		// and runtime.epclntab
+		var start, end *pe.Symbol
+		for _, sym := range f.Symbols {
+			switch sym.Name {
+			case "runtime.pclntab":
+				start = sym
+			case "runtime.epclntab":
+				end = sym
+			}
+		}
+		ts := f.Section(".text")
+		if start == nil || end == nil || start.SectionNumber != end.SectionNumber || start.SectionNumber <= 0 || int(start.SectionNumber) > len(f.Sections) || ts == nil {
+			return nil
+		}
+		sdata, err := f.Sections[start.SectionNumber-1].Data()
+		if err != nil || end.Value < start.Value || int(end.Value) > len(sdata) {
+			return nil
+		}
+		data = sdata[start.Value:end.Value]
+		var imageBase uint64
+		switch oh := f.OptionalHeader.(type) {
+		case *pe.OptionalHeader32:
+			imageBase = uint64(oh.ImageBase)
+		case *pe.OptionalHeader64:
+			imageBase = oh.ImageBase
+		}
+		text = imageBase + uint64(ts.VirtualAddress)
+	}
+
+	if data == nil {
+		return nil
+	}
+	tab, err := gosym.NewTable(nil, gosym.NewLineTable(data, text))
+	if err != nil {
+		return nil
+	}
+	return tab
+}
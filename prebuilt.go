@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"debug/dwarf"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// checkBinary checks the executable at path, built outside of this
+// program, against the sources of its main package.
+func checkBinary(ctx context.Context, path string) *output {
+	out := &output{}
+
+	file := openBinary(path)
+	if file == nil && isGoObject(path) {
+		// the compiler writes the debug info of each function as the
+		// contents of symbols, the sections and the line table are only
+		// produced by the linker
+		out.error(fmt.Errorf("%s is a Go archive or object file, its debug info can only be read after linking it into an executable", path))
+		return out
+	}
+	if file == nil {
+		out.error(fmt.Errorf("could not open executable %s", path))
+		return out
+	}
+	defer file.Close()
+
+	dw, err := file.DWARF()
+	if err != nil {
+		out.error(fmt.Errorf("could not read debug info of %s: %v", path, err))
+		return out
+	}
+
+	sdw, sfile, err := splitDWARF(dw, file, path, "main")
+	if err != nil {
+		out.error(err)
+		return out
+	}
+	if sdw != nil {
+		defer splitFields.Delete(sdw)
+		dw, file = sdw, sfile
+	}
+
+	cu := compileUnit(dw, "main")
+	if cu == nil {
+		out.error(fmt.Errorf("executable %s does not contain package main", path))
+		return out
+	}
+
+	// the compiler records -N and -l in the producer
+	producer, _ := cu.Val(dwarf.AttrProducer).(string)
+	if i := strings.Index(producer, ";"); i >= 0 {
+		inline = !hasCompilerFlag(producer[i+1:], "-l")
+		optimized = !hasCompilerFlag(producer[i+1:], "-N")
+	}
+
+	files := binarySources(dw, cu)
+	for _, name := range files {
+		local := name
+		if srcDir != "" {
+			local = filepath.Join(srcDir, baseName(name))
+		}
+		if _, err := os.Stat(local); err != nil {
+			out.error(fmt.Errorf("source of %s not found: %v", path, err))
+			return out
+		}
+	}
+
+	funcs := make(map[string]*Func)
+	if err := getLineRanges(files, "main", funcs); err != nil {
+		out.error(err)
+		return out
+	}
+
+	fs, err := runChecks(ctx, out, dw, file, path, "main", "", funcs)
+	if err != nil {
+		out.error(err)
+	}
+	out.reportAll(fs)
+	return out
+}
+
+// binarySources returns the names of the files declaring the functions of
+// compile unit cu. The file table of the compile unit can't be used
+// directly, it also lists the files of functions inlined from other
+// packages.
+func binarySources(dw *dwarf.Data, cu *dwarf.Entry) []string {
+	lnrdr, err := dw.LineReader(cu)
+	if err != nil || lnrdr == nil {
+		return nil
+	}
+	files := lnrdr.Files()
+
+	pkgpath, _ := cu.Val(dwarf.AttrName).(string)
+	seen := make(map[string]bool)
+	var r []string
+
+	rdr := dw.Reader()
+	rdr.Seek(cu.Offset)
+	rdr.Next()
+	for {
+		e, err := rdr.Next()
+		if err != nil {
+			// reported as malformed by runChecks
+			break
+		}
+		if e == nil || e.Tag == dwarf.TagCompileUnit {
+			break
+		}
+		if e.Tag != dwarf.TagSubprogram {
+			continue
+		}
+		rdr.SkipChildren()
+		name, _ := e.Val(dwarf.AttrName).(string)
+		if !strings.HasPrefix(name, pkgpath+".") {
+			continue
+		}
+		declFile, ok := e.Val(dwarf.AttrDeclFile).(int64)
+		if !ok {
+			continue
+		}
+		if file := lineFileName(files, declFile); file != "" && strings.HasSuffix(file, ".go") && !seen[file] {
+			seen[file] = true
+			r = append(r, file)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+// isGoObject returns true if the file at path is an archive or an object
+// file written by the Go compiler, in the Go object format.
+func isGoObject(path string) bool {
+	fh, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer fh.Close()
+	buf := make([]byte, 4096)
+	n, _ := io.ReadFull(fh, buf)
+	buf = buf[:n]
+	if !bytes.HasPrefix(buf, []byte("!<arch>\n")) && !bytes.HasPrefix(buf, []byte("go object ")) {
+		return false
+	}
+	return bytes.Contains(buf, []byte("go object "))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+)
+
+// checkRangeFuncs checks that the functions containing range-over-func
+// loops have no line entries inside the bodies of the loops, which the
+// compiler moves into closures, except for the code of the loop bodies
+// inlined back into them. The line entries of the closures are checked
+// against the lines of the loop by checkLines.
+func checkRangeFuncs(dw *dwarf.Data, funcRanges []FuncRange) []Finding {
+	var r []Finding
+
+	idx := newFuncIndex(funcRanges)
+
+	forEachFuncLineEntry(dw, funcRanges, func(lne *dwarf.LineEntry) {
+		if lne.EndSequence || (onlyStmt && !lne.IsStmt) {
+			return
+		}
+		fr := getFunc(lne.Address, idx)
+		if fr == nil || len(fr.Fn.rangeBodies) == 0 || fr.inlinedAt(lne.Address) != nil || !sameFile(lne.File.Name, fr.Fn.file) {
+			return
+		}
+		for _, body := range fr.Fn.rangeBodies {
+			if lne.Line > body.start && lne.Line < body.end {
+				r = append(r, Finding{
+					Check:     "range-func",
+					Rule:      "RANGE_BODY_IN_PARENT",
+					File:      lne.File.Name,
+					Line:      lne.Line,
+					PC:        lne.Address,
+					Func:      fr.Fn.Name,
+					Instance:  instanceName(fr.Name, fr.Fn),
+					StartLine: fr.Fn.startLine,
+					EndLine:   fr.Fn.endLine,
+					IsStmt:    lne.IsStmt,
+					Message:   fmt.Sprintf("line inside the body of the range-over-func loop at lines %d-%d", body.start, body.end),
+				})
+				return
+			}
+		}
+	})
+
+	return r
+}
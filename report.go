@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// Finding is a problem found with the debug info of a function.
+type Finding struct {
+	Check     string   `json:"check"`
+	Rule      string   `json:"rule"`
+	Severity  severity `json:"severity"`
+	File      string   `json:"file"`
+	Line      int      `json:"line"`
+	PC        uint64   `json:"pc"`
+	Func      string   `json:"func"`
+	Instance  string   `json:"instance,omitempty"`
+	StartLine int      `json:"startLine"`
+	EndLine   int      `json:"endLine"`
+	IsStmt    bool     `json:"isStmt"`
+	Toolchain string   `json:"toolchain,omitempty"`
+	Mode      string   `json:"mode,omitempty"`
+	Target    string   `json:"target,omitempty"`
+	Message   string   `json:"message,omitempty"`
+
+	// consecutive findings differing only by their address are grouped,
+	// PC is the first address and LastPC the last one
+	LastPC uint64 `json:"lastPC,omitempty"`
+	Count  int    `json:"count,omitempty"`
+
+	// instructions around PC, only with -disasm
+	Disasm []string `json:"disasm,omitempty"`
+}
+
+// groupFindings merges the runs of consecutive findings of fs that only
+// differ by their address, unless -no-group was passed.
+func groupFindings(fs []Finding) []Finding {
+	if noGroup {
+		return fs
+	}
+	var r []Finding
+	for _, f := range fs {
+		if n := len(r); n > 0 && sameButPC(r[n-1], f) {
+			g := &r[n-1]
+			if g.Count == 0 {
+				g.Count = 1
+			}
+			g.Count++
+			g.LastPC = f.PC
+			g.IsStmt = g.IsStmt || f.IsStmt
+			continue
+		}
+		r = append(r, f)
+	}
+	return r
+}
+
+// sameButPC returns true if findings a and b are the same except for
+// their address and, unless the is_stmt entries are counted separately
+// with -all-entries, their is_stmt flag.
+func sameButPC(a, b Finding) bool {
+	return a.Check == b.Check && a.Rule == b.Rule && a.File == b.File && a.Line == b.Line && a.Func == b.Func &&
+		a.Instance == b.Instance && (a.IsStmt == b.IsStmt || !allEntries) && a.Toolchain == b.Toolchain && a.Target == b.Target && a.Message == b.Message
+}
+
+// count returns the number of line entries, or other items, reported by
+// f.
+func (f *Finding) count() int {
+	return max(f.Count, 1)
+}
+
+// output is the output produced while checking one input, it is buffered
+// so that the output of inputs checked in parallel doesn't get mixed up.
+type output struct {
+	bytes.Buffer
+	findings []Finding     // reported findings
+	failed   bool          // some error prevented checking the input
+	streamed bool          // the findings were printed by stream
+	buildErr *buildError   // the input failed to build
+	stats    []funcStats   // only with -stats
+	versions []cuVersion   // only with -stats
+	heatmaps []funcHeatmap // only with -heatmap or -heatmap-html
+
+	instantiations []instantiation // only with -list-instantiations
+}
+
+// error reports an error that prevented checking the input.
+func (out *output) error(err error) {
+	fmt.Fprintln(out, err)
+	out.failed = true
+	errors.As(err, &out.buildErr)
+}
+
+func (out *output) report(f Finding) {
+	if conf.excluded(f) || base.suppressed(f) {
+		return
+	}
+	out.findings = append(out.findings, f)
+	if ndjsonOutput && !out.streamed {
+		must(writeNDJSON(os.Stdout, f))
+	}
+	if jsonOutput || sarifOutput {
+		return
+	}
+	fmt.Fprintln(out, findingText(f))
+	if contextLines > 0 {
+		out.reportContext(f)
+	}
+	for _, inst := range f.Disasm {
+		fmt.Fprintf(out, "\t%s\n", inst)
+	}
+}
+
+// stream prints the findings fs with ndjson as soon as they are found,
+// except when comparing toolchains, where only the differences are
+// reported once both builds are checked.
+func (out *output) stream(fs []Finding) {
+	if !ndjsonOutput || compare != "" {
+		return
+	}
+	out.streamed = true
+	for _, f := range fs {
+		if !conf.excluded(f) && !base.suppressed(f) {
+			must(writeNDJSON(os.Stdout, f))
+		}
+	}
+}
+
+// ndjsonMu serializes the lines printed by writeNDJSON, inputs are
+// checked in parallel.
+var ndjsonMu sync.Mutex
+
+// writeNDJSON writes f to w as a single line of JSON. Each finding is
+// written with a single call to Write, w must not be buffered for the
+// consumer to see it immediately.
+func writeNDJSON(w io.Writer, f Finding) error {
+	buf, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	ndjsonMu.Lock()
+	defer ndjsonMu.Unlock()
+	_, err = w.Write(append(buf, '\n'))
+	return err
+}
+
+// findingText returns the line describing finding f in the text output.
+func findingText(f Finding) string {
+	var b strings.Builder
+	name := f.Func
+	if f.Instance != "" {
+		name = f.Instance
+	}
+	// findings about a whole compile unit or file have no line or PC
+	loc := baseName(f.File)
+	if f.Line > 0 {
+		loc += fmt.Sprintf(":%d", f.Line)
+	}
+	if f.PC != 0 {
+		loc += fmt.Sprintf(" %#x", f.PC)
+		if f.Count > 1 {
+			loc += fmt.Sprintf("-%#x", f.LastPC)
+		}
+	}
+	if loc != "" {
+		fmt.Fprintf(&b, "%s ", loc)
+	}
+	fmt.Fprintf(&b, "%s [%s %s]", name, f.Severity, f.Rule)
+	if f.Message != "" {
+		fmt.Fprintf(&b, " %s", f.Message)
+	}
+	if f.Count > 1 {
+		fmt.Fprintf(&b, " (%d entries)", f.Count)
+	}
+	if allEntries && f.IsStmt {
+		fmt.Fprintf(&b, " is_stmt")
+	}
+	if f.Toolchain != "" {
+		fmt.Fprintf(&b, " (only with %s)", f.Toolchain)
+	}
+	if f.Target != "" {
+		fmt.Fprintf(&b, " on %s", f.Target)
+	}
+	return b.String()
+}
+
+// reportContext prints the line range of the function of finding f and
+// the source lines around the line of f.
+func (out *output) reportContext(f Finding) {
+	if f.StartLine > 0 {
+		fmt.Fprintf(out, "\t%s, lines %d-%d\n", f.Func, f.StartLine, f.EndLine)
+	}
+	path := f.File
+	if srcDir != "" {
+		path = filepath.Join(srcDir, baseName(path))
+	}
+	lines, err := sourceLines(path)
+	if err != nil || f.Line < 1 || f.Line > len(lines) {
+		return
+	}
+	for i := max(f.Line-contextLines, 1); i <= min(f.Line+contextLines, len(lines)); i++ {
+		mark := "  "
+		if i == f.Line {
+			mark = "=>"
+		}
+		fmt.Fprintf(out, "\t%s %4d %s\n", mark, i, lines[i-1])
+	}
+}
+
+// sourceCache contains the lines of the files read by sourceLines.
+var sourceCache sync.Map // string -> []string
+
+// sourceLines returns the lines of the file at path.
+func sourceLines(path string) ([]string, error) {
+	if lines, ok := sourceCache.Load(path); ok {
+		return lines.([]string), nil
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n")
+	sourceCache.Store(path, lines)
+	return lines, nil
+}
+
+// reportAll reports the findings fs of an input, followed by the summaries.
+func (out *output) reportAll(fs []Finding) {
+	for _, f := range fs {
+		out.report(f)
+	}
+	if allEntries {
+		out.reportEntriesSummary(out.findings)
+	}
+	out.reportInstancesSummary(out.findings)
+	if stats {
+		out.reportStats(out.stats)
+		out.reportVersions(out.versions)
+	}
+	if heatmap {
+		out.reportHeatmaps(out.heatmaps)
+	}
+	if listInstantiations {
+		out.reportInstantiations(out.instantiations)
+	}
+}
+
+// reportEntriesSummary prints, for each function with findings, the number
+// of bad line entries next to the number of bad is_stmt line entries.
+func (out *output) reportEntriesSummary(fs []Finding) {
+	if jsonOutput || sarifOutput || len(fs) == 0 {
+		return
+	}
+	all, stmt := make(map[string]int), make(map[string]int)
+	for _, f := range fs {
+		all[f.Func] += f.count()
+		if f.IsStmt {
+			stmt[f.Func] += f.count()
+		}
+	}
+	fns := make([]string, 0, len(all))
+	for fn := range all {
+		fns = append(fns, fn)
+	}
+	sort.Strings(fns)
+	w := tabwriter.NewWriter(out, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(w, "function\tall\tis_stmt\n")
+	for _, fn := range fns {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", fn, all[fn], stmt[fn])
+	}
+	w.Flush()
+}
+
+// reportInstancesSummary prints, for each generic function with findings,
+// the list of instantiations that have findings.
+func (out *output) reportInstancesSummary(fs []Finding) {
+	if jsonOutput || sarifOutput {
+		return
+	}
+	instances := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, f := range fs {
+		if f.Instance == "" || seen[f.Instance] {
+			continue
+		}
+		seen[f.Instance] = true
+		instances[f.Func] = append(instances[f.Func], f.Instance)
+	}
+	fns := make([]string, 0, len(instances))
+	for fn := range instances {
+		fns = append(fns, fn)
+	}
+	sort.Strings(fns)
+	for _, fn := range fns {
+		sort.Strings(instances[fn])
+		fmt.Fprintf(out, "%s: instantiations with findings: %s\n", fn, strings.Join(instances[fn], ", "))
+	}
+}
+
+// reportTargetsSummary prints the number of findings for each target.
+func (out *output) reportTargetsSummary(fs []Finding) {
+	if jsonOutput || sarifOutput {
+		return
+	}
+	n := make(map[string]int)
+	for _, f := range fs {
+		n[f.Target]++
+	}
+	for _, target := range targets {
+		fmt.Fprintf(out, "%s: %d findings\n", target, n[target])
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// severity is how bad the problem reported by a finding is.
+type severity int
+
+const (
+	severityNote severity = iota
+	severityWarning
+	severityError
+)
+
+var severityNames = [...]string{"note", "warning", "error"}
+
+func (s severity) String() string { return severityNames[s] }
+
+func (s severity) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+func (s *severity) UnmarshalText(text []byte) error {
+	var err error
+	*s, err = parseSeverity(string(text))
+	return err
+}
+
+// parseSeverity parses the name of a severity.
+func parseSeverity(name string) (severity, error) {
+	for i, n := range severityNames {
+		if n == name {
+			return severity(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity %q, should be one of %s", name, strings.Join(severityNames[:], ", "))
+}
+
+// minSeverity is the severity below which findings are not reported, set
+// with -severity
+var minSeverity = severityNote
+
+// rule identifies a kind of finding with a stable ID, a check can report
+// more than one kind and sets the rule of each finding it creates.
+type rule struct {
+	check    string
+	id       string
+	severity severity
+}
+
+// rules lists the rules of each check.
+var rules = []rule{
+	{"range", "LINE_OUT_OF_RANGE", severityError},
+	{"inline-range", "INLINED_LINE_OUT_OF_RANGE", severityError},
+	{"inline-call", "CALL_LINE_OUT_OF_RANGE", severityError},
+	{"line-sequence", "SEQUENCE_ADDRESS_DECREASES", severityError},
+	{"line-sequence", "SEQUENCE_UNTERMINATED", severityError},
+	{"line-sequence", "SEQUENCE_OVERLAP", severityError},
+	{"decl-line", "DECL_LINE_MISMATCH", severityWarning},
+	{"decl-file", "DECL_FILE_MISSING", severityWarning},
+	{"decl-file", "DECL_FILE_MISMATCH", severityWarning},
+	{"param", "PARAM_OUTSIDE_SIGNATURE", severityWarning},
+	{"param", "PARAM_MISSING", severityWarning},
+	{"param", "PARAM_INCOMPLETE", severityWarning},
+	{"prologue", "PROLOGUE_DUPLICATE", severityError},
+	{"prologue", "PROLOGUE_MISPLACED", severityWarning},
+	{"pre-prologue", "PROLOGUE_BODY_LINE", severityWarning},
+	{"epilogue", "EPILOGUE_MISPLACED", severityWarning},
+	{"stmt-coverage", "STMT_WITHOUT_ENTRY", severityWarning},
+	{"stmt-boundary", "STMT_WITHOUT_IS_STMT", severityWarning},
+	{"stmt-boundary", "IS_STMT_NOT_AT_STMT", severityNote},
+	{"line-pc", "LINE_PC_NOT_INVERTIBLE", severityWarning},
+	{"line-pc", "LINE_PC_SPREAD", severityNote},
+	{"column", "COLUMN_OUT_OF_RANGE", severityError},
+	{"column", "COLUMN_NOT_AT_STMT", severityNote},
+	{"blank-line", "STMT_ON_BRACE", severityWarning},
+	{"blank-line", "LINE_WITHOUT_CODE", severityWarning},
+	{"line-directive", "LINE_DIRECTIVE_TARGET_MISSING", severityWarning},
+	{"range-func", "RANGE_BODY_IN_PARENT", severityError},
+	{"loc-expr", "LOC_EXPR_MALFORMED", severityError},
+	{"loc-list", "LOC_LIST_MALFORMED", severityError},
+	{"loc-range", "LOC_OUT_OF_RANGE", severityError},
+	{"loc-coverage", "LOC_MISSING", severityNote},
+	{"loc-stmt", "LOC_MISSING_AT_STMT", severityWarning},
+	{"type-die", "TYPE_UNRESOLVED", severityError},
+	{"type-die", "TYPE_MISSING", severityError},
+	{"type-die", "TYPE_DICT_INDEX_INVALID", severityError},
+	{"type-die", "TYPE_SIZE_MISMATCH", severityError},
+	{"block-range", "BLOCK_NOT_NESTED", severityError},
+	{"block-decl", "BLOCK_DECL_OUT_OF_RANGE", severityWarning},
+	{"abstract-origin", "ORIGIN_UNRESOLVED", severityError},
+	{"abstract-origin", "INLINED_CALL_OUT_OF_SCOPE", severityError},
+	{"abstract-origin", "ORIGIN_MISMATCH", severityWarning},
+	{"missing-func", "SUBPROGRAM_MISSING", severityError},
+	{"pclntab", "PCLNTAB_MISMATCH", severityError},
+	{"symtab", "SYMBOL_MISSING", severityError},
+	{"symtab", "SYMBOL_MISMATCH", severityError},
+	{"cfi", "FDE_MISSING", severityError},
+	{"cfi", "FDE_MISMATCH", severityError},
+	{"wrapper", "WRAPPER_IN_USER_CODE", severityWarning},
+	{"go-defer-wrapper", "GO_DEFER_WRAPPER_MISPLACED", severityWarning},
+	{"file-table", "FILE_MISSING", severityWarning},
+	{"file-table", "FILE_DUPLICATE", severityNote},
+	{"file-table", "FILE_CHECKSUM_MISMATCH", severityError},
+	{"compile-unit", "CU_LANGUAGE", severityError},
+	{"compile-unit", "CU_PRODUCER_FLAGS", severityError},
+	{"compile-unit", "CU_PRODUCER", severityError},
+	{"compile-unit", "CU_FILE_UNRESOLVED", severityWarning},
+	{"line-header", "LINE_HEADER_VERSION", severityWarning},
+	{"line-header", "LINE_HEADER_FORM", severityError},
+	{"line-header", "LINE_HEADER_FILE_INDEX", severityError},
+	{"line-header", "LINE_HEADER_DIRECTORY", severityWarning},
+	{"line-header", "LINE_HEADER_INVALID", severityError},
+	{"delve", "DELVE_BREAKPOINT", severityWarning},
+	{"gdb", "GDB_MISMATCH", severityWarning},
+	{"lldb", "LLDB_MISMATCH", severityWarning},
+	{"subprogram-range", "SUBPROGRAM_OVERLAP", severityError},
+	{"subprogram-range", "SUBPROGRAM_EMPTY_RANGE", severityWarning},
+	{"subprogram-range", "SUBPROGRAM_OUTSIDE_CODE", severityError},
+	{"orphan-line", "LINE_WITHOUT_SUBPROGRAM", severityError},
+	{"line-density", "LINE_DENSITY_ANOMALY", severityWarning},
+	{"defer-line", "DEFER_REGISTER_LINE", severityWarning},
+	{"defer-line", "DEFER_DISASM_FAILED", severityError},
+	{"defer-line", "DEFER_EXIT_LINE", severityWarning},
+	{"dwarf-malformed", "DWARF_MALFORMED", severityError},
+}
+
+// setSeverity sets the severity of finding f from its rule.
+func setSeverity(f *Finding) {
+	for _, r := range rules {
+		if r.id == f.Rule {
+			f.Severity = r.severity
+			return
+		}
+	}
+	panic(fmt.Sprintf("check %s reported a finding with unknown rule %q", f.Check, f.Rule))
+}
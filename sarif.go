@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ruleDescriptions describes the problem reported by each rule.
+var ruleDescriptions = map[string]string{
+	"LINE_OUT_OF_RANGE":             "Line table entry outside of the function's source lines",
+	"INLINED_LINE_OUT_OF_RANGE":     "Line table entry of inlined code outside of the inlined function's source lines",
+	"CALL_LINE_OUT_OF_RANGE":        "Call site of an inlined call outside of the calling function's source lines",
+	"SEQUENCE_ADDRESS_DECREASES":    "Line table sequence with decreasing addresses",
+	"SEQUENCE_UNTERMINATED":         "Line table sequence not terminated by end_sequence",
+	"SEQUENCE_OVERLAP":              "Line table sequence overlapping another sequence",
+	"DECL_LINE_MISMATCH":            "DW_AT_decl_line of a subprogram doesn't match the function declaration",
+	"DECL_FILE_MISSING":             "Subprogram without DW_AT_decl_file",
+	"DECL_FILE_MISMATCH":            "DW_AT_decl_file of a subprogram doesn't match the file of the function declaration",
+	"PARAM_OUTSIDE_SIGNATURE":       "Parameter declared outside of the function signature",
+	"PARAM_MISSING":                 "Parameter of the function without a DW_TAG_formal_parameter",
+	"PARAM_INCOMPLETE":              "Parameter entry without a name, a type or a declaration line",
+	"PROLOGUE_DUPLICATE":            "prologue_end set on more than one line entry of the function",
+	"PROLOGUE_MISPLACED":            "prologue_end missing or not on the first statement",
+	"PROLOGUE_BODY_LINE":            "Instruction before prologue_end attributed to a line of the function body",
+	"EPILOGUE_MISPLACED":            "epilogue_begin not on a return statement or closing brace",
+	"STMT_WITHOUT_ENTRY":            "Statement without any line table entry",
+	"STMT_WITHOUT_IS_STMT":          "Statement without an is_stmt line entry",
+	"IS_STMT_NOT_AT_STMT":           "is_stmt line entry not at the start of a statement",
+	"LINE_PC_NOT_INVERTIBLE":        "Line whose breakpoint address maps back to another line",
+	"LINE_PC_SPREAD":                "Line whose addresses are spread over too much of its function",
+	"COLUMN_OUT_OF_RANGE":           "Column number past the end of the line",
+	"COLUMN_NOT_AT_STMT":            "Column number not at the start of a statement",
+	"STMT_ON_BRACE":                 "Line entry on the closing brace of an inner block",
+	"LINE_WITHOUT_CODE":             "Line entry on a blank line or a comment",
+	"LINE_DIRECTIVE_TARGET_MISSING": "Line entry refers to a missing file or line through a //line directive",
+	"RANGE_BODY_IN_PARENT":          "Line entry of a function inside the body of a range-over-func loop, which belongs to a closure",
+	"LOC_EXPR_MALFORMED":            "Malformed location expression",
+	"LOC_LIST_MALFORMED":            "Malformed location list",
+	"LOC_OUT_OF_RANGE":              "Location list entry outside of the function",
+	"LOC_MISSING":                   "Variable without a location in part of its scope",
+	"LOC_MISSING_AT_STMT":           "Variable in scope without a location at the address of a statement",
+	"TYPE_UNRESOLVED":               "Type entry of a variable of a generic function that doesn't resolve",
+	"TYPE_MISSING":                  "Variable of a generic function without DW_AT_type",
+	"TYPE_DICT_INDEX_INVALID":       "Type of a variable referring to a dictionary entry the function doesn't have",
+	"TYPE_SIZE_MISMATCH":            "Type entry of a variable with a size different from the type in the source",
+	"BLOCK_NOT_NESTED":              "Lexical block range not contained in its parent scope or overlapping a sibling",
+	"BLOCK_DECL_OUT_OF_RANGE":       "Lexical block declared outside of the function",
+	"ORIGIN_UNRESOLVED":             "DW_AT_abstract_origin that doesn't resolve or isn't of the expected kind",
+	"INLINED_CALL_OUT_OF_SCOPE":     "Inlined call outside of the scope containing it",
+	"ORIGIN_MISMATCH":               "Attribute of a concrete entry different from its abstract origin",
+	"SUBPROGRAM_MISSING":            "Function with code in the executable but no DW_TAG_subprogram",
+	"PCLNTAB_MISMATCH":              "Go runtime line table disagrees with the DWARF line table",
+	"SYMBOL_MISSING":                "Subprogram without a function symbol in the symbol table",
+	"SYMBOL_MISMATCH":               "Subprogram whose address or size doesn't match its function symbol",
+	"FDE_MISSING":                   "Function not covered by an FDE",
+	"FDE_MISMATCH":                  "Function covered by FDEs not matching its range or with undecodable CFA rules",
+	"WRAPPER_IN_USER_CODE":          "Compiler generated wrapper points into unrelated user code",
+	"GO_DEFER_WRAPPER_MISPLACED":    "Wrapper of a go or defer statement points away from the statement",
+	"FILE_MISSING":                  "File of the line table not found",
+	"FILE_DUPLICATE":                "File listed more than once in the line table",
+	"FILE_CHECKSUM_MISMATCH":        "File of the line table with an MD5 checksum not matching its contents",
+	"CU_LANGUAGE":                   "Compile unit with a language other than Go",
+	"CU_PRODUCER_FLAGS":             "Compile unit whose producer flags don't match the optimization and inlining settings",
+	"CU_PRODUCER":                   "Compile unit without a DW_AT_producer of the Go compiler",
+	"CU_FILE_UNRESOLVED":            "Source file not reachable from the file table with the compile unit's DW_AT_comp_dir",
+	"LINE_HEADER_VERSION":           "Line table version different from the compile unit's DWARF version",
+	"LINE_HEADER_FORM":              "Line table header entry format with invalid forms or fields",
+	"LINE_HEADER_FILE_INDEX":        "Line program using a file index not in the file table",
+	"LINE_HEADER_DIRECTORY":         "Line table directory table missing the compilation directory or with invalid indexes",
+	"LINE_HEADER_INVALID":           "Line table header that can't be read or doesn't match the compile unit",
+	"DELVE_BREAKPOINT":              "Breakpoint set with Delve on a statement line fails or resolves outside of the function",
+	"GDB_MISMATCH":                  "gdb maps an address or a line differently from the line table",
+	"LLDB_MISMATCH":                 "lldb maps an address or a line differently from the line table",
+	"SUBPROGRAM_OVERLAP":            "Subprogram with a range overlapping another subprogram",
+	"SUBPROGRAM_EMPTY_RANGE":        "Subprogram with an empty range",
+	"SUBPROGRAM_OUTSIDE_CODE":       "Subprogram with a range outside of the sections containing code",
+	"LINE_WITHOUT_SUBPROGRAM":       "Line entry whose address doesn't belong to any subprogram",
+	"LINE_DENSITY_ANOMALY":          "Instantiation of a generic function with many more line entries than another instantiation of the same source",
+	"DEFER_REGISTER_LINE":           "Call registering a deferred function attributed to a line other than the defer statement",
+	"DEFER_DISASM_FAILED":           "Function with defer statements that couldn't be disassembled",
+	"DEFER_EXIT_LINE":               "Call running deferred functions attributed to a line other than an exit of the function",
+	"DWARF_MALFORMED":               "Debug info that can't be decoded, the rest of the compile unit, function or check is skipped",
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                        `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLocation `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult                    `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// writeSARIF writes findings to w as a SARIF 2.1.0 log.
+func writeSARIF(w io.Writer, findings []Finding) error {
+	run := sarifRun{
+		Tool:    sarifTool{sarifDriver{Name: "badlngenerics", Rules: []sarifRule{}}},
+		Results: []sarifResult{},
+	}
+
+	if wd, err := os.Getwd(); err == nil {
+		run.OriginalURIBaseIDs = map[string]sarifArtifactLocation{srcRoot: {URI: fileURI(wd) + "/"}}
+	}
+
+	sorted := append([]rule(nil), rules...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].id < sorted[j].id })
+	for _, r := range sorted {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{r.id, sarifMessage{ruleDescriptions[r.id]}})
+	}
+
+	for _, f := range findings {
+		name := f.Func
+		if f.Instance != "" {
+			name = f.Instance
+		}
+		msg := fmt.Sprintf("%s at PC %#x in %s (lines %d-%d)", ruleDescriptions[f.Rule], f.PC, name, f.StartLine, f.EndLine)
+		if f.Count > 1 {
+			msg = fmt.Sprintf("%s at %d PCs from %#x to %#x in %s (lines %d-%d)", ruleDescriptions[f.Rule], f.Count, f.PC, f.LastPC, name, f.StartLine, f.EndLine)
+		}
+		if f.Message != "" {
+			msg += ": " + f.Message
+		}
+		if f.Target != "" {
+			msg += " on " + f.Target
+		}
+		res := sarifResult{
+			RuleID:  f.Rule,
+			Level:   f.Severity.String(),
+			Message: sarifMessage{msg},
+		}
+		// findings without a file, about a whole compile unit, are
+		// located by the name of the function
+		switch {
+		case f.File != "":
+			loc := &sarifPhysicalLocation{ArtifactLocation: artifactLocation(f.File)}
+			if f.Line >= 1 {
+				loc.Region = &sarifRegion{f.Line}
+			}
+			res.Locations = []sarifLocation{{PhysicalLocation: loc}}
+		case name != "":
+			res.Locations = []sarifLocation{{LogicalLocations: []sarifLogicalLocation{{name}}}}
+		}
+		run.Results = append(run.Results, res)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{run},
+	})
+}
+
+// srcRoot is the base of the URIs of the files in the current directory,
+// so that the locations of the results don't depend on where the
+// repository is checked out.
+const srcRoot = "%SRCROOT%"
+
+// artifactLocation returns the location of file, relative to srcRoot if
+// it's in the current directory.
+func artifactLocation(file string) sarifArtifactLocation {
+	rel := relFile(file)
+	if filepath.IsAbs(filepath.FromSlash(rel)) {
+		return sarifArtifactLocation{URI: fileURI(rel)}
+	}
+	u := url.URL{Path: rel}
+	return sarifArtifactLocation{URI: u.String(), URIBaseID: srcRoot}
+}
+
+// fileURI converts a file name from the debug info into a file URI.
+func fileURI(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		// windows drive letter
+		path = "/" + path
+	}
+	u := url.URL{Scheme: "file", Path: path}
+	return u.String()
+}
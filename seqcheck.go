@@ -0,0 +1,79 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"sort"
+)
+
+// checkSequences checks the structure of the line tables of the compile
+// units containing the checked functions: addresses must not decrease
+// inside a sequence, every sequence must be terminated by an end_sequence
+// entry and sequences must not overlap.
+func checkSequences(dw *dwarf.Data, funcRanges []FuncRange) []Finding {
+	idx := newFuncIndex(funcRanges)
+
+	var r []Finding
+	finding := func(rule string, cu *dwarf.Entry, lne *dwarf.LineEntry, format string, args ...interface{}) {
+		f := Finding{
+			Check:   "line-sequence",
+			Rule:    rule,
+			Line:    lne.Line,
+			PC:      lne.Address,
+			Func:    compileUnitName(cu),
+			IsStmt:  lne.IsStmt,
+			Message: fmt.Sprintf(format, args...),
+		}
+		if lne.File != nil {
+			f.File = lne.File.Name
+		}
+		if fr := getFunc(lne.Address, idx); fr != nil {
+			f.Func, f.Instance = fr.Fn.Name, instanceName(fr.Name, fr.Fn)
+			f.StartLine, f.EndLine = fr.Fn.startLine, fr.Fn.endLine
+		}
+		r = append(r, f)
+	}
+
+	// a sequence and its first entry
+	type sequence struct {
+		start, end uint64
+		cu         *dwarf.Entry
+		first      dwarf.LineEntry
+	}
+	var seqs []sequence
+
+	for _, cu := range funcCompileUnits(funcRanges) {
+		var cur *sequence
+		var prev dwarf.LineEntry
+		err := forEachCULineEntry(dw, cu, func(lne *dwarf.LineEntry) {
+			if cur == nil {
+				cur = &sequence{start: lne.Address, cu: cu, first: *lne}
+			} else if lne.Address < prev.Address {
+				finding("SEQUENCE_ADDRESS_DECREASES", cu, lne, "address decreases from %#x", prev.Address)
+			}
+			prev = *lne
+			if lne.EndSequence {
+				cur.end = lne.Address
+				if cur.end > cur.start {
+					seqs = append(seqs, *cur)
+				}
+				cur = nil
+			}
+		})
+		mustDecode(err)
+		if cur != nil {
+			finding("SEQUENCE_UNTERMINATED", cu, &prev, "sequence starting at %#x not terminated by end_sequence", cur.start)
+		}
+	}
+
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i].start < seqs[j].start })
+	for i, last := 1, 0; i < len(seqs); i++ {
+		if p := seqs[last]; seqs[i].start < p.end {
+			finding("SEQUENCE_OVERLAP", seqs[i].cu, &seqs[i].first, "sequence %#x-%#x overlaps sequence %#x-%#x", seqs[i].start, seqs[i].end, p.start, p.end)
+		}
+		if seqs[i].end > seqs[last].end {
+			last = i
+		}
+	}
+	return r
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// maxServeRequest is the maximum size of the body of a /check request.
+const maxServeRequest = 10 << 20
+
+// checkRequest is the body of a JSON /check request.
+type checkRequest struct {
+	Files map[string]string `json:"files"` // contents of the .go files of the program by name
+}
+
+// checkResponse is the result of a /check request.
+type checkResponse struct {
+	Findings []Finding `json:"findings"`
+	Failed   bool      `json:"failed"`           // the program couldn't be checked
+	Errors   string    `json:"errors,omitempty"` // why the program couldn't be checked
+}
+
+// serveMain serves the HTTP API of -serve on addr, a TCP address or
+// unix: followed by the path of a socket, until ctx is canceled:
+//
+//	POST /check   checks a program, either the Go source in the body or a
+//	              JSON checkRequest, and responds with a checkResponse
+//	GET  /status  responds with the number of programs being checked
+//	              and checked so far
+func serveMain(ctx context.Context, addr string, gocmds [2]string) int {
+	// findings are only collected, like with -json
+	jsonOutput = true
+
+	network := "tcp"
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		network, addr = "unix", path
+		os.Remove(path)
+	}
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	logger.Info("serving", "network", network, "addr", ln.Addr())
+
+	var running, checked atomic.Int64
+	sem := make(chan struct{}, parallel)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/check", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		files, err := readCheckRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dir, err := os.MkdirTemp("", "badlngenerics-serve-")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer os.RemoveAll(dir)
+		var paths []string
+		for name, src := range files {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(src), 0666); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			paths = append(paths, path)
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-r.Context().Done():
+			return
+		}
+		running.Add(1)
+		out := checkInput(r.Context(), input{files: paths}, gocmds)
+		running.Add(-1)
+		checked.Add(1)
+		<-sem
+
+		// file names are relative to the program
+		resp := checkResponse{Findings: []Finding{}, Failed: out.failed}
+		resp.Errors = strings.ReplaceAll(out.String(), dir+string(filepath.Separator), "")
+		for _, f := range out.findings {
+			if rel, err := filepath.Rel(dir, f.File); err == nil && !strings.HasPrefix(rel, "..") {
+				f.File = rel
+			}
+			resp.Findings = append(resp.Findings, f)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int64{"running": running.Load(), "checked": checked.Load()})
+	})
+
+	srv := &http.Server{Handler: mux, BaseContext: func(net.Listener) context.Context { return ctx }}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return exitClean
+}
+
+// readCheckRequest returns the files of the program of a /check request,
+// by name.
+func readCheckRequest(r *http.Request) (map[string]string, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxServeRequest))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return map[string]string{"main.go": string(body)}, nil
+	}
+	var req checkRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	if len(req.Files) == 0 {
+		return nil, errors.New("no files")
+	}
+	for name := range req.Files {
+		if filepath.Base(name) != name || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			return nil, fmt.Errorf("bad file name %q", name)
+		}
+	}
+	return req.Files, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// if snippet is set it is checked as a program, wrapped in the boilerplate
+// of a main package if it doesn't have one
+var snippet string
+
+// snippetDir is the temporary directory where the programs read from stdin
+// and -e are written, removed by exit.
+var snippetDir string
+
+// snippetArgs returns args with "-" replaced by a file containing the
+// program read from stdin and, if -e was used, with a file containing the
+// snippet appended.
+func snippetArgs(args []string) ([]string, error) {
+	var r []string
+	write := func(name string, src []byte) error {
+		if snippetDir == "" {
+			var err error
+			snippetDir, err = os.MkdirTemp("", "badlngenerics-snippet-")
+			if err != nil {
+				return err
+			}
+		}
+		// each program in its own directory, so that groupFiles doesn't
+		// merge them
+		dir := filepath.Join(snippetDir, name)
+		if err := os.Mkdir(dir, 0777); err != nil {
+			return err
+		}
+		path := filepath.Join(dir, name+".go")
+		r = append(r, path)
+		return os.WriteFile(path, []byte(wrapSnippet(string(src))), 0666)
+	}
+	stdin := false
+	for _, arg := range args {
+		if arg != "-" {
+			r = append(r, arg)
+			continue
+		}
+		if stdin {
+			return nil, fmt.Errorf("- can only be used once")
+		}
+		stdin = true
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("reading stdin: %v", err)
+		}
+		if err := write("stdin", src); err != nil {
+			return nil, err
+		}
+	}
+	if snippet != "" {
+		if err := write("snippet", []byte(snippet)); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// wrapSnippet returns src as the source of a main package. A complete file
+// is returned unchanged, declarations get a package clause and an empty
+// main function if they don't have one and statements are put in the main
+// function, after the imports preceding them.
+func wrapSnippet(src string) string {
+	if _, err := parser.ParseFile(token.NewFileSet(), "", src, parser.PackageClauseOnly); err == nil {
+		return src
+	}
+	if f, err := parser.ParseFile(token.NewFileSet(), "", "package main\n"+src, 0); err == nil {
+		for _, decl := range f.Decls {
+			if fn, isFunc := decl.(*ast.FuncDecl); isFunc && fn.Recv == nil && fn.Name.Name == "main" {
+				return "package main\n" + src
+			}
+		}
+		return "package main\n" + src + "\nfunc main() {}\n"
+	}
+
+	var imports, body []string
+	lines := strings.Split(src, "\n")
+	inImport := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case inImport:
+			imports = append(imports, line)
+			inImport = trimmed != ")"
+		case strings.HasPrefix(trimmed, "import"):
+			imports = append(imports, line)
+			inImport = strings.HasSuffix(trimmed, "(")
+		case trimmed == "" || strings.HasPrefix(trimmed, "//"):
+			imports = append(imports, line)
+		default:
+			body = lines[i:]
+		}
+		if body != nil {
+			break
+		}
+	}
+	return "package main\n\n" + strings.Join(imports, "\n") + "\nfunc main() {\n" + strings.Join(body, "\n") + "\n}\n"
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// GNU extensions used for split DWARF before DWARF 5
+const (
+	attrGNUDwoName  dwarf.Attr = 0x2130
+	attrGNUDwoID    dwarf.Attr = 0x2131
+	attrGNUAddrBase dwarf.Attr = 0x2133
+)
+
+// splitBinary is an executable whose debug info for the checked package
+// is in a .dwo or .dwp file, sections are the sections of the split unit
+// used by the checks, rebased to the unit.
+type splitBinary struct {
+	Dwarfable
+	sections map[string][]byte
+}
+
+// splitFields are the attributes of the skeleton units that the split
+// units read from .dwo and .dwp files need, by split unit.
+var splitFields sync.Map // *dwarf.Data -> []dwarf.Field
+
+// withSkeleton returns compile unit e of dw with the attributes of its
+// skeleton unit if it was read from a split DWARF file, e otherwise.
+func withSkeleton(dw *dwarf.Data, e *dwarf.Entry) *dwarf.Entry {
+	fields, ok := splitFields.Load(dw)
+	if !ok || e == nil {
+		return e
+	}
+	r := *e
+	r.Field = append(append([]dwarf.Field(nil), e.Field...), fields.([]dwarf.Field)...)
+	return &r
+}
+
+// splitDWARF returns the debug info of package pkgpath if the executable
+// at path only contains a skeleton unit for it, its actual debug info
+// being in a .dwo file or in a .dwp file next to the executable. It
+// returns nil if the package isn't in a split unit.
+func splitDWARF(dw *dwarf.Data, file Dwarfable, path, pkgpath string) (*dwarf.Data, Dwarfable, error) {
+	var skeletons []*dwarf.Entry
+	rdr := dw.Reader()
+	for {
+		e, err := rdr.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if e == nil {
+			break
+		}
+		rdr.SkipChildren()
+		if e.Val(dwarf.AttrDwoName) != nil || e.Val(attrGNUDwoName) != nil {
+			skeletons = append(skeletons, e)
+		}
+	}
+	if len(skeletons) == 0 {
+		return nil, nil, nil
+	}
+
+	info := debugSection(file, "info")
+	var dwp *elf.File
+	if f, err := elf.Open(path + ".dwp"); err == nil {
+		defer f.Close()
+		dwp = f
+	}
+
+	for _, sk := range skeletons {
+		sections, err := splitSections(sk, info, dwp, dw.Reader().ByteOrder())
+		if err != nil {
+			return nil, nil, err
+		}
+		sdw, err := newSplitData(sk, sections, file, dw.Reader().ByteOrder())
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading split unit %v: %v", dwoName(sk), err)
+		}
+		cu, err := sdw.Reader().Next()
+		if err == nil && cu != nil && compileUnitName(cu) == pkgpath {
+			return sdw, &splitBinary{file, sections}, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+func dwoName(sk *dwarf.Entry) string {
+	if name, ok := sk.Val(dwarf.AttrDwoName).(string); ok {
+		return name
+	}
+	name, _ := sk.Val(attrGNUDwoName).(string)
+	return name
+}
+
+// splitSections returns the sections of the split unit of skeleton sk,
+// from its .dwo file or from the .dwp file dwp. info is the .debug_info
+// section of the executable.
+func splitSections(sk *dwarf.Entry, info []byte, dwp *elf.File, order binary.ByteOrder) (map[string][]byte, error) {
+	read := func(f *elf.File) map[string][]byte {
+		r := make(map[string][]byte)
+		for _, name := range []string{"info", "abbrev", "str", "str_offsets", "loclists", "loc", "rnglists"} {
+			if s := f.Section(".debug_" + name + ".dwo"); s != nil {
+				r[name], _ = s.Data()
+			}
+		}
+		return r
+	}
+
+	name := dwoName(sk)
+	if !filepath.IsAbs(name) {
+		compDir, _ := sk.Val(dwarf.AttrCompDir).(string)
+		name = filepath.Join(compDir, name)
+	}
+	if f, err := elf.Open(name); err == nil {
+		defer f.Close()
+		return read(f), nil
+	}
+	if dwp == nil {
+		return nil, fmt.Errorf("split unit %s not found", name)
+	}
+
+	// the id of the unit is in the header of DWARF 5 skeleton units, right
+	// before the first entry
+	id, ok := sk.Val(attrGNUDwoID).(int64)
+	if !ok {
+		if sk.Offset < 8 || int(sk.Offset) > len(info) {
+			return nil, fmt.Errorf("no id for split unit %s", dwoName(sk))
+		}
+		id = int64(order.Uint64(info[sk.Offset-8:]))
+	}
+	idx := dwp.Section(".debug_cu_index")
+	if idx == nil {
+		return nil, fmt.Errorf("split unit %s: no .debug_cu_index in the .dwp file", dwoName(sk))
+	}
+	data, _ := idx.Data()
+	contribs, err := dwpContributions(data, uint64(id), order)
+	if err != nil {
+		return nil, fmt.Errorf("split unit %s: %v", dwoName(sk), err)
+	}
+	sections := read(dwp)
+	for name, c := range contribs {
+		s := sections[name]
+		if c[0]+c[1] > uint64(len(s)) {
+			return nil, fmt.Errorf("split unit %s: contribution to .debug_%s.dwo out of bounds", dwoName(sk), name)
+		}
+		sections[name] = s[c[0] : c[0]+c[1]]
+	}
+	return sections, nil
+}
+
+// dwpContributions looks up the unit with the given id in the index of a
+// .dwp file, contents of .debug_cu_index, and returns the offset and size
+// of its contribution to each section.
+func dwpContributions(data []byte, id uint64, order binary.ByteOrder) (map[string][2]uint64, error) {
+	b := &dbuf{data: data, order: order}
+	version := b.u32() & 0xffff
+	ncols, nunits, nslots := b.u32(), b.u32(), b.u32()
+	if b.err != nil || nslots == 0 || nslots&(nslots-1) != 0 {
+		return nil, fmt.Errorf("malformed .debug_cu_index")
+	}
+	hashes := b.off
+	indexes := hashes + int(nslots)*8
+	offsets := indexes + int(nslots)*4
+	sizes := offsets + int(ncols)*4 + int(nunits*ncols)*4
+	if sizes+int(nunits*ncols)*4 > len(data) {
+		return nil, fmt.Errorf("malformed .debug_cu_index")
+	}
+
+	mask := uint64(nslots - 1)
+	slot, step := id&mask, ((id>>32)&mask)|1
+	row := uint32(0)
+	for i := uint32(0); i < nslots; i++ {
+		sig := order.Uint64(data[hashes+int(slot)*8:])
+		r := order.Uint32(data[indexes+int(slot)*4:])
+		if r == 0 {
+			break
+		}
+		if sig == id {
+			row = r
+			break
+		}
+		slot = (slot + step) & mask
+	}
+	if row == 0 || row > nunits {
+		return nil, fmt.Errorf("unit %#x not found in .debug_cu_index", id)
+	}
+
+	// section identifiers
+	names := map[uint32]string{1: "info", 3: "abbrev", 5: "loclists", 6: "str_offsets", 8: "rnglists"}
+	if version < 5 {
+		names = map[uint32]string{1: "info", 3: "abbrev", 5: "loc", 6: "str_offsets"}
+	}
+	r := make(map[string][2]uint64)
+	for col := 0; col < int(ncols); col++ {
+		name, ok := names[order.Uint32(data[offsets+col*4:])]
+		if !ok {
+			continue
+		}
+		cell := (int(row-1)*int(ncols) + col) * 4
+		r[name] = [2]uint64{
+			uint64(order.Uint32(data[offsets+int(ncols)*4+cell:])),
+			uint64(order.Uint32(data[sizes+cell:])),
+		}
+	}
+	return r, nil
+}
+
+// newSplitData returns the debug info of the split unit with the given
+// sections, belonging to skeleton sk of the executable file. The
+// attributes used to find the tables of the unit in .debug_addr,
+// .debug_str_offsets, .debug_rnglists and .debug_loclists are only in the
+// skeleton, so the tables are rebased to start at offset 0.
+func newSplitData(sk *dwarf.Entry, sections map[string][]byte, file Dwarfable, order binary.ByteOrder) (*dwarf.Data, error) {
+	info := sections["info"]
+	if len(info) < 6 {
+		return nil, fmt.Errorf("no .debug_info.dwo section")
+	}
+	// all the tables have the 32-bit DWARF format, their headers are 8
+	// bytes long for .debug_str_offsets and 12 for the range and
+	// location lists
+	dwarf5 := order.Uint16(info[4:]) >= 5
+	skip := func(data []byte, n int) []byte {
+		if !dwarf5 || len(data) < n {
+			return data
+		}
+		return data[n:]
+	}
+	sections["str_offsets"] = skip(sections["str_offsets"], 8)
+	sections["rnglists"] = skip(sections["rnglists"], 12)
+	sections["loclists"] = skip(sections["loclists"], 12)
+
+	addrBase, ok := sk.Val(dwarf.AttrAddrBase).(int64)
+	if !ok {
+		addrBase, _ = sk.Val(attrGNUAddrBase).(int64)
+	}
+	addr := debugSection(file, "addr")
+	if addrBase < 0 || int(addrBase) > len(addr) {
+		return nil, fmt.Errorf("DW_AT_addr_base outside of .debug_addr")
+	}
+	sections["addr"] = addr[addrBase:]
+
+	// the line table is the one of the skeleton
+	dw, err := dwarf.New(sections["abbrev"], nil, nil, info, debugSection(file, "line"), nil, nil, sections["str"])
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"str_offsets", "rnglists", "loclists", "addr"} {
+		if err := dw.AddSection(".debug_"+name, sections[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := dw.AddSection(".debug_line_str", debugSection(file, "line_str")); err != nil {
+		return nil, err
+	}
+
+	var fields []dwarf.Field
+	for _, attr := range []dwarf.Attr{dwarf.AttrStmtList, dwarf.AttrCompDir} {
+		if f := sk.AttrField(attr); f != nil {
+			fields = append(fields, *f)
+		}
+	}
+	fields = append(fields,
+		dwarf.Field{Attr: dwarf.AttrAddrBase, Val: int64(0), Class: dwarf.ClassAddrPtr},
+		dwarf.Field{Attr: dwarf.AttrLoclistsBase, Val: int64(0), Class: dwarf.ClassLocListPtr})
+	splitFields.Store(dw, fields)
+	return dw, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+)
+
+// funcStats are the statistics printed by -stats for a function or, if
+// name is empty, for a file.
+type funcStats struct {
+	name, file string
+	entries    int // line entries
+	outOfRange int // line entries outside of the function
+	stmt       int // is_stmt line entries
+	covered    int // lines with statements that have a line entry
+	stmtLines  int // lines with statements
+}
+
+// lineStats returns the statistics of the line entries of the functions in
+// funcRanges, instantiations of generic functions are counted together.
+func lineStats(dw *dwarf.Data, funcRanges []FuncRange) []funcStats {
+	idx := newFuncIndex(funcRanges)
+	byFunc := make(map[*Func]*funcStats)
+	covered := make(map[*Func]map[int]bool)
+	for i := range funcRanges {
+		fn := funcRanges[i].Fn
+		if byFunc[fn] == nil {
+			byFunc[fn] = &funcStats{name: fn.Name, file: fn.file, stmtLines: len(fn.stmtLines)}
+			covered[fn] = make(map[int]bool)
+		}
+	}
+
+	forEachFuncLineEntry(dw, funcRanges, func(lne *dwarf.LineEntry) {
+		if lne.EndSequence {
+			return
+		}
+		fr := getFunc(lne.Address, idx)
+		if fr == nil {
+			return
+		}
+		s := byFunc[fr.Fn]
+		s.entries++
+		if lne.IsStmt {
+			s.stmt++
+		}
+		fn := fr.Fn
+		if inl := fr.inlinedAt(lne.Address); inl != nil {
+			fn = inl.Fn
+		} else if sameFile(lne.File.Name, fn.file) && fn.stmtLines[lne.Line] {
+			covered[fn][lne.Line] = true
+		}
+		if fn != nil && !fn.contains(lne.File.Name, lne.Line) {
+			s.outOfRange++
+		}
+	})
+
+	r := make([]funcStats, 0, len(byFunc))
+	for fn, s := range byFunc {
+		s.covered = len(covered[fn])
+		r = append(r, *s)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].name < r[j].name })
+	return r
+}
+
+// reportStats prints the statistics of each function followed by the
+// totals of each file.
+func (out *output) reportStats(stats []funcStats) {
+	if jsonOutput || sarifOutput {
+		return
+	}
+	byFile := make(map[string]*funcStats)
+	var files []string
+	for _, s := range stats {
+		t := byFile[s.file]
+		if t == nil {
+			t = &funcStats{file: s.file}
+			byFile[s.file] = t
+			files = append(files, s.file)
+		}
+		t.entries += s.entries
+		t.outOfRange += s.outOfRange
+		t.stmt += s.stmt
+		t.covered += s.covered
+		t.stmtLines += s.stmtLines
+	}
+	sort.Strings(files)
+
+	w := tabwriter.NewWriter(out, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(w, "function\tentries\tout of range\tis_stmt\tlines covered\n")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%s\n", s.name, s.columns())
+	}
+	for _, file := range files {
+		fmt.Fprintf(w, "%s\t%s\n", baseName(file), byFile[file].columns())
+	}
+	w.Flush()
+}
+
+func (s *funcStats) columns() string {
+	pct := 100.0
+	if s.stmtLines > 0 {
+		pct = 100 * float64(s.covered) / float64(s.stmtLines)
+	}
+	return fmt.Sprintf("%d\t%d\t%d\t%d/%d (%.0f%%)", s.entries, s.outOfRange, s.stmt, s.covered, s.stmtLines, pct)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"debug/dwarf"
+	"sort"
+)
+
+// checkStmtCoverage checks that every statement of each function has at
+// least one line table entry inside the function. Inlining moves the code
+// of statements into the callers and optimizations remove it, so the
+// check is skipped for those builds. It only runs with -stmt-coverage.
+func checkStmtCoverage(dw *dwarf.Data, funcRanges []FuncRange) []Finding {
+	if !stmtCoverage || inline || optimized {
+		return nil
+	}
+
+	idx := newFuncIndex(funcRanges)
+
+	// lines with an entry, by function
+	covered := make(map[*FuncRange]map[int]bool)
+
+	forEachFuncLineEntry(dw, funcRanges, func(lne *dwarf.LineEntry) {
+		if lne.EndSequence {
+			return
+		}
+		fr := getFunc(lne.Address, idx)
+		if fr == nil || !sameFile(lne.File.Name, fr.Fn.file) {
+			return
+		}
+		if covered[fr] == nil {
+			covered[fr] = make(map[int]bool)
+		}
+		covered[fr][lne.Line] = true
+	})
+
+	var r []Finding
+	for i := range funcRanges {
+		fr := &funcRanges[i]
+		if fr.Fn.ranges != nil {
+			// statement lines are recorded without their file
+			continue
+		}
+		var missing []int
+		for line := range fr.Fn.stmtLines {
+			if !covered[fr][line] {
+				missing = append(missing, line)
+			}
+		}
+		sort.Ints(missing)
+		for _, line := range missing {
+			r = append(r, Finding{
+				Check:     "stmt-coverage",
+				Rule:      "STMT_WITHOUT_ENTRY",
+				File:      fr.Fn.file,
+				Line:      line,
+				PC:        fr.Rngs[0][0],
+				Func:      fr.Fn.Name,
+				Instance:  instanceName(fr.Name, fr.Fn),
+				StartLine: fr.Fn.startLine,
+				EndLine:   fr.Fn.endLine,
+				Message:   "statement has no line table entry",
+			})
+		}
+	}
+	return r
+}
+
+// checkStmtBoundaries checks that the is_stmt line entries of each
+// function are at the start of one of its statements, the declaration of
+// the function or its closing brace, and that every statement generating
+// code has an is_stmt line entry. Columns are compared when the line
+// table has them. The compiler also puts is_stmt on the lines of the
+// arguments of calls and composite literals spanning more than one line,
+// the check only runs with -stmt-boundaries.
+func checkStmtBoundaries(dw *dwarf.Data, funcRanges []FuncRange) []Finding {
+	if !stmtBoundaries || inline || optimized {
+		return nil
+	}
+
+	var r []Finding
+
+	idx := newFuncIndex(funcRanges)
+
+	// lines with an is_stmt entry, by function
+	covered := make(map[*FuncRange]map[int]bool)
+
+	forEachFuncLineEntry(dw, funcRanges, func(lne *dwarf.LineEntry) {
+		if lne.EndSequence || !lne.IsStmt {
+			return
+		}
+		fr := getFunc(lne.Address, idx)
+		if fr == nil || fr.Fn.ranges != nil || fr.inlinedAt(lne.Address) != nil || !sameFile(lne.File.Name, fr.Fn.file) {
+			return
+		}
+		fn := fr.Fn
+		if covered[fr] == nil {
+			covered[fr] = make(map[int]bool)
+		}
+		covered[fr][lne.Line] = true
+		if lne.Line == fn.startLine || lne.Line == fn.endLine || !fn.contains(lne.File.Name, lne.Line) {
+			// out of range lines are reported by checkLines
+			return
+		}
+		for _, body := range fn.rangeBodies {
+			if lne.Line == body.end {
+				// the end of the body of a range-over-func loop checks
+				// how the loop exited
+				return
+			}
+		}
+		cols, ok := fn.stmtStarts[lne.Line]
+		if ok && lne.Column != 0 {
+			ok = false
+			for _, col := range cols {
+				if col == lne.Column {
+					ok = true
+				}
+			}
+		}
+		if ok {
+			return
+		}
+		r = append(r, Finding{
+			Check:     "stmt-boundary",
+			Rule:      "IS_STMT_NOT_AT_STMT",
+			File:      lne.File.Name,
+			Line:      lne.Line,
+			PC:        lne.Address,
+			Func:      fn.Name,
+			Instance:  instanceName(fr.Name, fn),
+			StartLine: fn.startLine,
+			EndLine:   fn.endLine,
+			IsStmt:    true,
+			Message:   "is_stmt entry not at the start of a statement",
+		})
+	})
+
+	for i := range funcRanges {
+		fr := &funcRanges[i]
+		if fr.Fn.ranges != nil {
+			continue
+		}
+		var missing []int
+		for line := range fr.Fn.stmtLines {
+			if !covered[fr][line] {
+				missing = append(missing, line)
+			}
+		}
+		sort.Ints(missing)
+		for _, line := range missing {
+			r = append(r, Finding{
+				Check:     "stmt-boundary",
+				Rule:      "STMT_WITHOUT_IS_STMT",
+				File:      fr.Fn.file,
+				Line:      line,
+				PC:        fr.lowpc(),
+				Func:      fr.Fn.Name,
+				Instance:  instanceName(fr.Name, fr.Fn),
+				StartLine: fr.Fn.startLine,
+				EndLine:   fr.Fn.endLine,
+				Message:   "statement has no is_stmt entry",
+			})
+		}
+	}
+	return r
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"sort"
+)
+
+// subprogramRange is an address range of a subprogram.
+type subprogramRange struct {
+	rng  [2]uint64
+	name string
+	off  dwarf.Offset
+}
+
+// checkSubprogramRanges checks the address ranges of all the subprograms
+// of the executable, not only the ones of the checked functions: they must
+// not be empty, must not overlap each other and must be inside a section
+// containing code. Otherwise finding the function of an address is
+// ambiguous for every debugger.
+func checkSubprogramRanges(dw *dwarf.Data, file Dwarfable, funcs map[string]*Func) []Finding {
+	rngs := subprogramRanges(dw)
+
+	var r []Finding
+	finding := func(rule string, sr subprogramRange, format string, args ...interface{}) {
+		f := Finding{
+			Check:   "subprogram-range",
+			Rule:    rule,
+			PC:      sr.rng[0],
+			Func:    sr.name,
+			Message: fmt.Sprintf(format, args...),
+		}
+		if fn := funcs[withoutTypeParams(sr.name)]; fn != nil {
+			f.File, f.Line, f.StartLine, f.EndLine = fn.file, fn.startLine, fn.startLine, fn.endLine
+			f.Func, f.Instance = fn.Name, instanceName(sr.name, fn)
+		}
+		r = append(r, f)
+	}
+
+	sections := codeSections(file)
+	last := -1 // range ending last among the ones already seen
+	for i, sr := range rngs {
+		if sr.rng[0] >= sr.rng[1] {
+			finding("SUBPROGRAM_EMPTY_RANGE", sr, "empty range %#x-%#x of the subprogram at %#x", sr.rng[0], sr.rng[1], sr.off)
+			continue
+		}
+		if sections != nil && !inSection(sr.rng, sections) {
+			finding("SUBPROGRAM_OUTSIDE_CODE", sr, "range %#x-%#x of the subprogram at %#x is outside of the sections containing code", sr.rng[0], sr.rng[1], sr.off)
+		}
+		if last >= 0 && sr.rng[0] < rngs[last].rng[1] {
+			other := rngs[last]
+			what := other.name
+			if other.off == sr.off {
+				what = "another of its ranges"
+			}
+			finding("SUBPROGRAM_OVERLAP", sr, "range %#x-%#x of the subprogram at %#x overlaps %s (%#x-%#x, subprogram at %#x)", sr.rng[0], sr.rng[1], sr.off, what, other.rng[0], other.rng[1], other.off)
+		}
+		if last < 0 || sr.rng[1] > rngs[last].rng[1] {
+			last = i
+		}
+	}
+	return r
+}
+
+// checkOrphanLines checks that every line entry with an address in a
+// section containing code is inside the range of a subprogram, the line
+// entries of addresses that don't belong to any function can't be
+// attributed to one by a debugger.
+func checkOrphanLines(dw *dwarf.Data, file Dwarfable) []Finding {
+	if !orphanLines {
+		return nil
+	}
+	// disjoint ranges covered by subprograms, sorted by address
+	var covered [][2]uint64
+	for _, sr := range subprogramRanges(dw) {
+		if n := len(covered); n > 0 && sr.rng[0] <= covered[n-1][1] {
+			covered[n-1][1] = max(covered[n-1][1], sr.rng[1])
+			continue
+		}
+		covered = append(covered, sr.rng)
+	}
+	sections := codeSections(file)
+
+	var r []Finding
+	forEachLineEntry(dw, func(lne *dwarf.LineEntry) {
+		if lne.EndSequence {
+			return
+		}
+		pc := lne.Address
+		if sections != nil && !inSection([2]uint64{pc, pc + 1}, sections) {
+			return
+		}
+		i := sort.Search(len(covered), func(i int) bool { return covered[i][1] > pc })
+		if i < len(covered) && pc >= covered[i][0] {
+			return
+		}
+		r = append(r, Finding{
+			Check:   "orphan-line",
+			Rule:    "LINE_WITHOUT_SUBPROGRAM",
+			File:    lne.File.Name,
+			Line:    lne.Line,
+			PC:      pc,
+			IsStmt:  lne.IsStmt,
+			Message: "no subprogram contains the address of the line entry",
+		})
+	})
+	return r
+}
+
+// subprogramRanges returns the address ranges of all the subprograms of
+// dw, sorted by address.
+func subprogramRanges(dw *dwarf.Data) []subprogramRange {
+	var rngs []subprogramRange
+	rdr := dw.Reader()
+	for {
+		e, err := rdr.Next()
+		mustDecode(err)
+		if e == nil {
+			break
+		}
+		if e.Tag != dwarf.TagSubprogram {
+			continue
+		}
+		rs, err := dw.Ranges(e)
+		mustDecode(err)
+		name, _ := entryName(dw, e)
+		for _, rng := range rs {
+			rngs = append(rngs, subprogramRange{rng, name, e.Offset})
+		}
+	}
+	sort.Slice(rngs, func(i, j int) bool {
+		if rngs[i].rng[0] != rngs[j].rng[0] {
+			return rngs[i].rng[0] < rngs[j].rng[0]
+		}
+		return rngs[i].rng[1] < rngs[j].rng[1]
+	})
+	return rngs
+}
+
+// inSection returns true if rng is contained in one of sections.
+func inSection(rng [2]uint64, sections [][2]uint64) bool {
+	for _, s := range sections {
+		if rng[0] >= s[0] && rng[1] <= s[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// codeSections returns the address ranges of the sections of f containing
+// code, nil if the format isn't supported.
+func codeSections(f Dwarfable) [][2]uint64 {
+	var r [][2]uint64
+	switch f := f.(type) {
+	case *builtBinary:
+		return codeSections(f.Dwarfable)
+	case *splitBinary:
+		return codeSections(f.Dwarfable)
+	case *detachedBinary:
+		return codeSections(f.Dwarfable)
+	case *elf.File:
+		for _, s := range f.Sections {
+			if s.Flags&elf.SHF_EXECINSTR != 0 && s.Flags&elf.SHF_ALLOC != 0 {
+				r = append(r, [2]uint64{s.Addr, s.Addr + s.Size})
+			}
+		}
+	case *macho.File:
+		const instructions = 0x80000000 | 0x400 // S_ATTR_PURE_INSTRUCTIONS | S_ATTR_SOME_INSTRUCTIONS
+		for _, s := range f.Sections {
+			if s.Flags&instructions != 0 {
+				r = append(r, [2]uint64{s.Addr, s.Addr + s.Size})
+			}
+		}
+	case *pe.File:
+		const code = 0x20 | 0x20000000 // IMAGE_SCN_CNT_CODE | IMAGE_SCN_MEM_EXECUTE
+		var imageBase uint64
+		switch oh := f.OptionalHeader.(type) {
+		case *pe.OptionalHeader32:
+			imageBase = uint64(oh.ImageBase)
+		case *pe.OptionalHeader64:
+			imageBase = oh.ImageBase
+		}
+		for _, s := range f.Sections {
+			if s.Characteristics&code != 0 {
+				addr := imageBase + uint64(s.VirtualAddress)
+				r = append(r, [2]uint64{addr, addr + uint64(s.VirtualSize)})
+			}
+		}
+	default:
+		return nil
+	}
+	return r
+}
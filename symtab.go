@@ -0,0 +1,143 @@
+package main
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"fmt"
+	"sort"
+)
+
+// funcSymbol is a function symbol of the symbol table of an executable.
+type funcSymbol struct {
+	name  string
+	value uint64
+	size  uint64
+	exact bool // size comes from the symbol table, otherwise it is the distance to the next symbol
+}
+
+// funcSymbols returns the function symbols of f sorted by address, nil if
+// it has no symbol table or its format isn't supported.
+func funcSymbols(f Dwarfable) []funcSymbol {
+	var r []funcSymbol
+	switch f := f.(type) {
+	case *builtBinary:
+		return funcSymbols(f.Dwarfable)
+	case *splitBinary:
+		return funcSymbols(f.Dwarfable)
+	case *detachedBinary:
+		return funcSymbols(f.Dwarfable)
+	case *elf.File:
+		syms, err := f.Symbols()
+		if err != nil {
+			return nil
+		}
+		for _, sym := range syms {
+			if elf.ST_TYPE(sym.Info) == elf.STT_FUNC && sym.Value != 0 {
+				r = append(r, funcSymbol{sym.Name, sym.Value, sym.Size, true})
+			}
+		}
+	case *macho.File:
+		ts := f.Section("__text")
+		if f.Symtab == nil || ts == nil {
+			return nil
+		}
+		sect := -1
+		for i, s := range f.Sections {
+			if s == ts {
+				sect = i + 1
+			}
+		}
+		var addrs []uint64
+		for _, sym := range f.Symtab.Syms {
+			if sym.Type&0xe0 != 0 || int(sym.Sect) != sect {
+				// debugger symbols and symbols of other sections
+				continue
+			}
+			r = append(r, funcSymbol{name: sym.Name, value: sym.Value})
+			addrs = append(addrs, sym.Value)
+		}
+		// Mach-O symbols have no size
+		sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+		for i := range r {
+			j := sort.Search(len(addrs), func(j int) bool { return addrs[j] > r[i].value })
+			end := ts.Addr + ts.Size
+			if j < len(addrs) {
+				end = addrs[j]
+			}
+			r[i].size = end - r[i].value
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].value < r[j].value })
+	return r
+}
+
+// checkSymbols checks that the symbol table of the executable has a
+// function symbol for each subprogram, with the same name, address and
+// size. For formats whose symbols have no size the subprogram must end
+// before the next symbol.
+func checkSymbols(file Dwarfable, funcRanges []FuncRange) []Finding {
+	syms := funcSymbols(file)
+	if len(syms) == 0 {
+		return nil
+	}
+	// local symbols can have the same name, for example copies of
+	// closures inlined in different places
+	byName := make(map[string][]*funcSymbol)
+	for i := range syms {
+		byName[syms[i].name] = append(byName[syms[i].name], &syms[i])
+	}
+
+	var r []Finding
+	for i := range funcRanges {
+		fr := &funcRanges[i]
+		if len(fr.Rngs) == 0 {
+			continue
+		}
+		lowpc, highpc := fr.lowpc(), fr.Rngs[len(fr.Rngs)-1][1]
+		finding := func(rule, format string, args ...interface{}) {
+			r = append(r, Finding{
+				Check:     "symtab",
+				Rule:      rule,
+				File:      fr.Fn.file,
+				Line:      fr.Fn.startLine,
+				PC:        lowpc,
+				Func:      fr.Fn.Name,
+				Instance:  instanceName(fr.Name, fr.Fn),
+				StartLine: fr.Fn.startLine,
+				EndLine:   fr.Fn.endLine,
+				Message:   fmt.Sprintf(format, args...),
+			})
+		}
+
+		name := fr.Name
+		if fr.Fn.asm && len(byName[name]) == 0 {
+			// assembly functions use ABI0, called through a wrapper
+			// only if Go code needs one
+			name += ".abi0"
+		}
+		var sym *funcSymbol
+		for _, s := range byName[name] {
+			if sym == nil || s.value == lowpc {
+				sym = s
+			}
+		}
+		if sym == nil {
+			j := sort.Search(len(syms), func(j int) bool { return syms[j].value >= lowpc })
+			if j < len(syms) && syms[j].value == lowpc {
+				finding("SYMBOL_MISSING", "no symbol named %s, the symbol at %#x is %s", fr.Name, lowpc, syms[j].name)
+			} else {
+				finding("SYMBOL_MISSING", "no symbol for the subprogram")
+			}
+			continue
+		}
+		switch {
+		case sym.value != lowpc:
+			finding("SYMBOL_MISMATCH", "symbol at %#x, subprogram at %#x", sym.value, lowpc)
+		case sym.exact && sym.size != highpc-lowpc:
+			finding("SYMBOL_MISMATCH", "symbol size %d, subprogram size %d", sym.size, highpc-lowpc)
+		case !sym.exact && highpc > sym.value+sym.size:
+			finding("SYMBOL_MISMATCH", "subprogram ends at %#x, past the next symbol at %#x", highpc, sym.value+sym.size)
+		}
+	}
+	return r
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// outputFormat is the format findings are printed in, set with -format:
+// text, json, ndjson, sarif, tap or junit. With tap and junit each input is
+// a test that fails if it has findings.
+var outputFormat = "text"
+
+// writeTAP writes the results outs of checking inputs as a TAP version 13
+// stream, with the findings of each failed test in its YAML block.
+func writeTAP(w io.Writer, inputs []string, outs []*output) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "TAP version 13\n1..%d\n", len(outs))
+	for i, out := range outs {
+		if !out.failed && len(out.findings) == 0 {
+			fmt.Fprintf(&b, "ok %d - %s\n", i+1, inputs[i])
+			continue
+		}
+		fmt.Fprintf(&b, "not ok %d - %s\n", i+1, inputs[i])
+		b.WriteString("  ---\n")
+		if out.failed {
+			fmt.Fprintf(&b, "  message: %s\n", yamlString(strings.TrimSpace(out.String())))
+		}
+		if len(out.findings) > 0 {
+			b.WriteString("  findings:\n")
+			for _, f := range out.findings {
+				fmt.Fprintf(&b, "    - %s\n", yamlString(findingText(f)))
+			}
+		}
+		b.WriteString("  ...\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// yamlString quotes s for YAML, JSON strings are valid YAML strings.
+func yamlString(s string) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure"`
+	Error     *junitFailure `xml:"error"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes the results outs of checking inputs as a JUnit XML
+// report, with a test case for each input failing with the list of its
+// findings. Inputs that couldn't be checked are errors.
+func writeJUnit(w io.Writer, inputs []string, outs []*output) error {
+	suite := junitTestSuite{Name: "badlngenerics", Tests: len(outs)}
+	for i, out := range outs {
+		tc := junitTestCase{Name: inputs[i], Classname: "badlngenerics"}
+		if len(out.findings) > 0 {
+			// the type is the highest severity of the findings
+			var sev severity
+			lines := make([]string, len(out.findings))
+			for j, f := range out.findings {
+				sev = max(sev, f.Severity)
+				lines[j] = findingText(f)
+			}
+			tc.Failure = &junitFailure{Message: fmt.Sprintf("%d findings", len(out.findings)), Type: sev.String(), Text: strings.Join(lines, "\n")}
+		}
+		if out.failed {
+			tc.Error = &junitFailure{Message: "could not be checked", Text: strings.TrimSpace(out.String())}
+			suite.Errors++
+		} else if tc.Failure != nil {
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// goEnv are the KEY=VALUE environment variables set with -env for the
+// go commands run.
+var goEnv []string
+
+// goCmd returns the command running the go command gocmd with args, in
+// the environment extended with the variables of -env and extra.
+func goCmd(ctx context.Context, gocmd string, extra []string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, gocmd, args...)
+	if len(goEnv) > 0 || len(extra) > 0 {
+		cmd.Env = append(append(os.Environ(), goEnv...), extra...)
+	}
+	return cmd
+}
+
+// envValue returns the value of the environment variable key for the go
+// commands run.
+func envValue(key string) string {
+	for i := len(goEnv) - 1; i >= 0; i-- {
+		if k, v, _ := strings.Cut(goEnv[i], "="); k == key {
+			return v
+		}
+	}
+	return os.Getenv(key)
+}
+
+// setupGotip returns the go command of gotip, installing the gotip
+// wrapper with the go command in PATH and downloading the toolchain when
+// they are missing. If update is set the latest toolchain is downloaded
+// again.
+func setupGotip(update bool) (string, error) {
+	return setupDL("gotip", update)
+}
+
+// setupDL returns the go command of the toolchain downloaded by the
+// golang.org/dl wrapper name, gotip or a release like go1.21.0, installing
+// the wrapper and downloading the toolchain when they are missing. If
+// update is set the toolchain is downloaded again.
+func setupDL(name string, update bool) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	gocmd := filepath.Join(home, "sdk", name, "bin", "go"+exeSuffix())
+	if _, err := os.Stat(gocmd); err == nil && !update {
+		return gocmd, nil
+	}
+
+	wrapper, err := exec.LookPath(name)
+	if err != nil {
+		// go install puts it in GOBIN, which may not be in PATH
+		out, err := exec.Command("go", "env", "GOBIN", "GOPATH").Output()
+		if err != nil {
+			return "", fmt.Errorf("go env: %v", err)
+		}
+		v := strings.Split(strings.TrimSpace(string(out)), "\n")
+		if len(v) != 2 {
+			return "", fmt.Errorf("unexpected output of go env: %q", out)
+		}
+		bin := v[0]
+		if bin == "" {
+			bin = filepath.Join(filepath.SplitList(v[1])[0], "bin")
+		}
+		wrapper = filepath.Join(bin, name+exeSuffix())
+		if _, err := os.Stat(wrapper); err != nil {
+			if err := runVerbose("go", "install", "golang.org/dl/"+name+"@latest"); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if err := runVerbose(wrapper, "download"); err != nil {
+		return "", err
+	}
+	return gocmd, nil
+}
+
+// runVerbose runs a command printing its output to stderr.
+func runVerbose(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %v", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// exeSuffix returns the suffix of executables on this system.
+func exeSuffix() string {
+	if runtime.GOOS == "windows" {
+		return ".exe"
+	}
+	return ""
+}
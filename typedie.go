@@ -0,0 +1,239 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// attrGoDictIndex is the index in the dictionary of a generic function of
+// the runtime type of a type parameter, on the DW_TAG_typedef entries the
+// compiler emits for the types of the variables of instantiations.
+const attrGoDictIndex dwarf.Attr = 0x2906
+
+// checkTypes checks the type entries of the variables and parameters of
+// the instantiations of generic functions: they must resolve, have the
+// size of the type of the variable in the source and, if they claim that
+// the concrete type can be found in the dictionary, the function must have
+// a dictionary with that index. Closures use the dictionary of the
+// instantiation they belong to.
+func checkTypes(dw *dwarf.Data, funcRanges []FuncRange) []Finding {
+	rdr := dw.Reader()
+	sizes := types.SizesFor("gc", "amd64")
+	if rdr.AddressSize() == 4 {
+		sizes = types.SizesFor("gc", "386")
+	}
+	dictLens := make(map[string]int64)
+	for i := range funcRanges {
+		fr := &funcRanges[i]
+		if instanceName(fr.Name, fr.Fn) != "" {
+			dictLens[fr.Name] = funcDictLen(dw, fr)
+		}
+	}
+	var r []Finding
+	for i := range funcRanges {
+		fr := &funcRanges[i]
+		if instanceName(fr.Name, fr.Fn) != "" {
+			r = append(r, checkFuncTypes(dw, sizes, fr, closureDictLen(fr.Name, dictLens))...)
+		}
+	}
+	return r
+}
+
+// funcDictLen returns the number of entries of the .dict parameter of fr,
+// -1 if it has none and -2 if its entries can't be read.
+func funcDictLen(dw *dwarf.Data, fr *FuncRange) int64 {
+	n := int64(-1)
+	err := walkScopes(dw, fr, func(e *dwarf.Entry, parent scope) {
+		if name, _ := entryName(dw, e); e.Tag != dwarf.TagFormalParameter || name != ".dict" {
+			return
+		}
+		off, ok := entryVal(dw, e, dwarf.AttrType).(dwarf.Offset)
+		if !ok {
+			return
+		}
+		typ, err := dw.Type(off)
+		if err != nil {
+			return
+		}
+		if pt, ok := typ.(*dwarf.PtrType); ok {
+			if at, ok := pt.Type.(*dwarf.ArrayType); ok {
+				n = at.Count
+			}
+		}
+	})
+	if err != nil {
+		return -2
+	}
+	return n
+}
+
+// closureDictLen returns the number of entries of the dictionary of the
+// function called name, which for closures without a .dict parameter is
+// the one of the enclosing instantiation: -1 if there is none and -2 if
+// it can't be determined.
+func closureDictLen(name string, dictLens map[string]int64) int64 {
+	if n, ok := dictLens[name]; ok && n >= 0 {
+		return n
+	}
+	for {
+		// the closure suffixes follow the type arguments
+		i := strings.LastIndex(name, "]") + 1
+		j := max(strings.LastIndex(name[i:], "."), strings.LastIndex(name[i:], "-range"))
+		if j < 0 {
+			break
+		}
+		name = name[:i+j]
+		if n, ok := dictLens[name]; ok && n >= 0 {
+			return n
+		}
+	}
+	if strings.Contains(name, ".func") || strings.Contains(name, "-range") {
+		return -2
+	}
+	return -1
+}
+
+func checkFuncTypes(dw *dwarf.Data, sizes types.Sizes, fr *FuncRange, dictLen int64) []Finding {
+	var r []Finding
+	finding := func(rule string, line int64, format string, args ...interface{}) {
+		r = append(r, Finding{
+			Check:     "type-die",
+			Rule:      rule,
+			File:      fr.Fn.file,
+			Line:      int(line),
+			PC:        fr.lowpc(),
+			Func:      fr.Fn.Name,
+			Instance:  instanceName(fr.Name, fr.Fn),
+			StartLine: fr.Fn.startLine,
+			EndLine:   fr.Fn.endLine,
+			Message:   fmt.Sprintf(format, args...),
+		})
+	}
+
+	type dictRef struct {
+		name  string
+		line  int64
+		index int64
+	}
+	var refs []dictRef
+
+	err := walkScopes(dw, fr, func(e *dwarf.Entry, parent scope) {
+		if e.Tag != dwarf.TagVariable && e.Tag != dwarf.TagFormalParameter {
+			return
+		}
+		name, _ := entryName(dw, e)
+		line, _ := entryVal(dw, e, dwarf.AttrDeclLine).(int64)
+		off, ok := entryVal(dw, e, dwarf.AttrType).(dwarf.Offset)
+		if !ok {
+			finding("TYPE_MISSING", line, "variable %s has no DW_AT_type", name)
+			return
+		}
+		typ, err := dw.Type(off)
+		if err != nil {
+			finding("TYPE_UNRESOLVED", line, "variable %s: type %#x does not resolve: %v", name, off, err)
+			return
+		}
+		if name == ".dict" {
+			return
+		}
+
+		if idx, ok := typeEntry(dw, off).Val(attrGoDictIndex).(int64); ok {
+			refs = append(refs, dictRef{name, line, idx})
+		}
+
+		size := typ.Size()
+		gotyp := fr.Fn.varTypes[varKey(name, int(line))]
+		if size < 0 || gotyp == nil {
+			return
+		}
+		if _, ok := gotyp.(*types.TypeParam); ok {
+			// the size of a type parameter is the size of its shape
+			gotyp = shapeType(typ)
+			if gotyp == nil {
+				return
+			}
+		} else if hasTypeParams(gotyp) {
+			return
+		}
+		if want := sizes.Sizeof(gotyp); want != size {
+			finding("TYPE_SIZE_MISMATCH", line, "variable %s: type %s has size %d, %s has size %d", name, typ, size, gotyp, want)
+		}
+	})
+	if err != nil {
+		return append(r, funcMalformedFinding(fr, err, "reading the entries of the subprogram"))
+	}
+
+	for _, ref := range refs {
+		switch {
+		case dictLen == -2:
+			// closure of an instantiation that isn't checked
+		case dictLen < 0:
+			finding("TYPE_DICT_INDEX_INVALID", ref.line, "variable %s: type refers to dictionary entry %d but the function has no .dict parameter", ref.name, ref.index)
+		case ref.index < 0 || ref.index >= dictLen:
+			finding("TYPE_DICT_INDEX_INVALID", ref.line, "variable %s: type refers to dictionary entry %d but .dict has %d entries", ref.name, ref.index, dictLen)
+		}
+	}
+	return r
+}
+
+// typeEntry returns the type entry at off.
+func typeEntry(dw *dwarf.Data, off dwarf.Offset) *dwarf.Entry {
+	rdr := dw.Reader()
+	rdr.Seek(off)
+	e, err := rdr.Next()
+	if err != nil || e == nil {
+		return &dwarf.Entry{}
+	}
+	return e
+}
+
+// shapeType returns the Go type of the shape type typ refers to, through
+// typedefs, or nil if it isn't a shape type or its underlying type can't be
+// parsed without the package it was declared in.
+func shapeType(typ dwarf.Type) types.Type {
+	for {
+		name := typ.Common().Name
+		if u, ok := strings.CutPrefix(name, "go.shape."); ok {
+			tv, err := types.Eval(token.NewFileSet(), nil, token.NoPos, u)
+			if err != nil || !tv.IsType() {
+				return nil
+			}
+			return tv.Type
+		}
+		td, ok := typ.(*dwarf.TypedefType)
+		if !ok {
+			return nil
+		}
+		typ = td.Type
+	}
+}
+
+// hasTypeParams returns true if the size of t depends on type parameters,
+// pointers and slices have the same size for all instantiations.
+func hasTypeParams(t types.Type) bool {
+	switch t := t.(type) {
+	case *types.TypeParam:
+		return true
+	case *types.Array:
+		return hasTypeParams(t.Elem())
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if hasTypeParams(t.Field(i).Type()) {
+				return true
+			}
+		}
+	case *types.Named:
+		args := t.TypeArgs()
+		for i := 0; i < args.Len(); i++ {
+			if hasTypeParams(args.At(i)) {
+				return true
+			}
+		}
+	case *types.Alias:
+		return hasTypeParams(types.Unalias(t))
+	}
+	return false
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// checkVariables checks the location descriptions of the variables and
+// parameters of each function.
+func checkVariables(dw *dwarf.Data, file Dwarfable, funcRanges []FuncRange) []Finding {
+	rdr := dw.Reader()
+	locs := &locReader{
+		loc:      debugSection(file, "loc"),
+		loclists: debugSection(file, "loclists"),
+		addr:     debugSection(file, "addr"),
+		order:    rdr.ByteOrder(),
+		addrSize: rdr.AddressSize(),
+	}
+	var r []Finding
+	for i := range funcRanges {
+		r = append(r, checkFuncVariables(dw, locs, &funcRanges[i])...)
+	}
+	return r
+}
+
+func checkFuncVariables(dw *dwarf.Data, locs *locReader, fr *FuncRange) []Finding {
+	var r []Finding
+	err := walkScopes(dw, fr, func(e *dwarf.Entry, parent scope) {
+		switch e.Tag {
+		case dwarf.TagVariable, dwarf.TagFormalParameter:
+			r = append(r, checkLocation(dw, locs, fr, e, parent.rngs)...)
+		}
+	})
+	if err != nil {
+		return append(r, funcMalformedFinding(fr, err, "reading the entries of the subprogram"))
+	}
+	return r
+}
+
+// checkLocation checks the location description of variable e, declared in
+// a scope covering the address ranges in scope.
+func checkLocation(dw *dwarf.Data, locs *locReader, fr *FuncRange, e *dwarf.Entry, scope [][2]uint64) []Finding {
+	var r []Finding
+
+	name, _ := entryName(dw, e)
+	line, _ := entryVal(dw, e, dwarf.AttrDeclLine).(int64)
+	finding := func(check, rule string, pc uint64, format string, args ...interface{}) {
+		r = append(r, Finding{
+			Check:     check,
+			Rule:      rule,
+			File:      fr.Fn.file,
+			Line:      int(line),
+			PC:        pc,
+			Func:      fr.Fn.Name,
+			Instance:  instanceName(fr.Name, fr.Fn),
+			StartLine: fr.Fn.startLine,
+			EndLine:   fr.Fn.endLine,
+			Message:   fmt.Sprintf("variable %s: ", name) + fmt.Sprintf(format, args...),
+		})
+	}
+
+	field := e.AttrField(dwarf.AttrLocation)
+	if field == nil {
+		// optimized away
+		return nil
+	}
+
+	switch field.Class {
+	case dwarf.ClassExprLoc:
+		if err := checkExpr(field.Val.([]byte), locs.order, locs.addrSize); err != nil {
+			finding("loc-expr", "LOC_EXPR_MALFORMED", fr.lowpc(), "%v", err)
+		}
+
+	case dwarf.ClassLocListPtr, dwarf.ClassLocList:
+		off := field.Val.(int64)
+		if field.Class == dwarf.ClassLocList {
+			var err error
+			off, err = locs.loclistx(fr.CU, off)
+			if err != nil {
+				finding("loc-list", "LOC_LIST_MALFORMED", fr.lowpc(), "%v", err)
+				return r
+			}
+		}
+		entries, err := locs.list(fr.CU, off)
+		if err != nil {
+			finding("loc-list", "LOC_LIST_MALFORMED", fr.lowpc(), "%v", err)
+			return r
+		}
+		for _, ent := range entries {
+			if err := checkExpr(ent.expr, locs.order, locs.addrSize); err != nil {
+				finding("loc-expr", "LOC_EXPR_MALFORMED", ent.rng[0], "%v", err)
+			}
+			if !containedIn(ent.rng, fr.Rngs) {
+				finding("loc-range", "LOC_OUT_OF_RANGE", ent.rng[0], "location list entry %#x-%#x outside of function", ent.rng[0], ent.rng[1])
+			}
+		}
+		if !inline && !optimized {
+			// without optimizations variables should always be available
+			if pc, ok := uncovered(entries, scope); ok {
+				finding("loc-coverage", "LOC_MISSING", pc, "no location at %#x", pc)
+			}
+		}
+
+	default:
+		finding("loc-expr", "LOC_EXPR_MALFORMED", fr.lowpc(), "unexpected location class %v", field.Class)
+	}
+
+	return r
+}
+
+// uncovered returns the first address in scope that isn't covered by any
+// location list entry.
+func uncovered(entries []locEntry, scope [][2]uint64) (uint64, bool) {
+	rngs := make([][2]uint64, 0, len(entries))
+	for _, ent := range entries {
+		rngs = append(rngs, ent.rng)
+	}
+	sort.Slice(rngs, func(i, j int) bool { return rngs[i][0] < rngs[j][0] })
+	for _, s := range scope {
+		pc := s[0]
+		for _, rng := range rngs {
+			if rng[0] > pc {
+				break
+			}
+			if rng[1] > pc {
+				pc = rng[1]
+			}
+		}
+		if pc < s[1] {
+			return pc, true
+		}
+	}
+	return 0, false
+}
+
+// locReader reads location lists from .debug_loc (DWARF 4) and
+// .debug_loclists (DWARF 5).
+type locReader struct {
+	loc, loclists, addr []byte
+	order               binary.ByteOrder
+	addrSize            int
+}
+
+type locEntry struct {
+	rng  [2]uint64
+	expr []byte
+}
+
+// list reads the location list at offset off of the location lists
+// section, cu is the compile unit containing the reference.
+func (locs *locReader) list(cu *dwarf.Entry, off int64) ([]locEntry, error) {
+	base, _ := cu.Val(dwarf.AttrLowpc).(uint64)
+	if locs.loclists != nil {
+		return locs.list5(cu, base, off)
+	}
+	return locs.list4(base, off)
+}
+
+func (locs *locReader) list4(base uint64, off int64) ([]locEntry, error) {
+	if off < 0 || off >= int64(len(locs.loc)) {
+		return nil, fmt.Errorf("location list offset %#x outside of .debug_loc", off)
+	}
+	b := &dbuf{data: locs.loc, off: int(off), order: locs.order}
+	maxAddr := ^uint64(0)
+	if locs.addrSize == 4 {
+		maxAddr = 0xffffffff
+	}
+	var r []locEntry
+	for b.err == nil {
+		start, end := b.addr(locs.addrSize), b.addr(locs.addrSize)
+		switch {
+		case start == 0 && end == 0:
+			return r, b.err
+		case start == maxAddr:
+			base = end
+		default:
+			expr := b.bytes(int(b.u16()))
+			r = append(r, locEntry{[2]uint64{base + start, base + end}, expr})
+		}
+	}
+	return nil, b.err
+}
+
+const (
+	lleEndOfList       = 0x00
+	lleBaseAddressx    = 0x01
+	lleStartxEndx      = 0x02
+	lleStartxLength    = 0x03
+	lleOffsetPair      = 0x04
+	lleDefaultLocation = 0x05
+	lleBaseAddress     = 0x06
+	lleStartEnd        = 0x07
+	lleStartLength     = 0x08
+)
+
+func (locs *locReader) list5(cu *dwarf.Entry, base uint64, off int64) ([]locEntry, error) {
+	if off < 0 || off >= int64(len(locs.loclists)) {
+		return nil, fmt.Errorf("location list offset %#x outside of .debug_loclists", off)
+	}
+	b := &dbuf{data: locs.loclists, off: int(off), order: locs.order}
+	var err error
+	addrx := func() uint64 {
+		var a uint64
+		if err == nil {
+			a, err = locs.addrx(cu, b.uleb())
+		}
+		return a
+	}
+	var r []locEntry
+	for b.err == nil && err == nil {
+		var rng [2]uint64
+		switch kind := b.u8(); kind {
+		case lleEndOfList:
+			return r, b.err
+		case lleBaseAddressx:
+			base = addrx()
+			continue
+		case lleStartxEndx:
+			rng = [2]uint64{addrx(), addrx()}
+		case lleStartxLength:
+			rng[0] = addrx()
+			rng[1] = rng[0] + b.uleb()
+		case lleOffsetPair:
+			rng = [2]uint64{base + b.uleb(), base + b.uleb()}
+		case lleDefaultLocation:
+			rng = [2]uint64{0, ^uint64(0)}
+		case lleBaseAddress:
+			base = b.addr(locs.addrSize)
+			continue
+		case lleStartEnd:
+			rng = [2]uint64{b.addr(locs.addrSize), b.addr(locs.addrSize)}
+		case lleStartLength:
+			rng[0] = b.addr(locs.addrSize)
+			rng[1] = rng[0] + b.uleb()
+		default:
+			return nil, fmt.Errorf("unknown location list entry kind %#x at %#x", kind, b.off-1)
+		}
+		expr := b.bytes(int(b.uleb()))
+		r = append(r, locEntry{rng, expr})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, b.err
+}
+
+// loclistx converts an index into the location list offsets table of cu
+// into a .debug_loclists offset.
+func (locs *locReader) loclistx(cu *dwarf.Entry, idx int64) (int64, error) {
+	base, ok := cu.Val(dwarf.AttrLoclistsBase).(int64)
+	if !ok {
+		return 0, errors.New("location list index without DW_AT_loclists_base")
+	}
+	// only the 32bit DWARF format is supported
+	b := &dbuf{data: locs.loclists, off: int(base + idx*4), order: locs.order}
+	off := b.u32()
+	if b.err != nil {
+		return 0, fmt.Errorf("location list index %d outside of .debug_loclists", idx)
+	}
+	return base + int64(off), nil
+}
+
+// addrx returns the address at index idx of the .debug_addr table of cu.
+func (locs *locReader) addrx(cu *dwarf.Entry, idx uint64) (uint64, error) {
+	base, ok := cu.Val(dwarf.AttrAddrBase).(int64)
+	if !ok {
+		return 0, errors.New("address index without DW_AT_addr_base")
+	}
+	b := &dbuf{data: locs.addr, off: int(base) + int(idx)*locs.addrSize, order: locs.order}
+	a := b.addr(locs.addrSize)
+	if b.err != nil {
+		return 0, fmt.Errorf("address index %d outside of .debug_addr", idx)
+	}
+	return a, nil
+}
+
+// checkExpr checks that expr is a well formed DWARF expression.
+func checkExpr(expr []byte, order binary.ByteOrder, addrSize int) error {
+	b := &dbuf{data: expr, order: order}
+	for b.off < len(b.data) && b.err == nil {
+		op := b.u8()
+		switch {
+		case op == 0x03: // DW_OP_addr
+			b.addr(addrSize)
+		case op == 0x08 || op == 0x09 || op == 0x15 || op == 0x94 || op == 0x95: // DW_OP_const1u, DW_OP_const1s, DW_OP_pick, DW_OP_deref_size, DW_OP_xderef_size
+			b.bytes(1)
+		case op == 0x0a || op == 0x0b || op == 0x28 || op == 0x2f || op == 0x98: // DW_OP_const2u, DW_OP_const2s, DW_OP_bra, DW_OP_skip, DW_OP_call2
+			b.bytes(2)
+		case op == 0x0c || op == 0x0d || op == 0x99 || op == 0x9a: // DW_OP_const4u, DW_OP_const4s, DW_OP_call4, DW_OP_call_ref
+			b.bytes(4)
+		case op == 0x0e || op == 0x0f: // DW_OP_const8u, DW_OP_const8s
+			b.bytes(8)
+		case op == 0x10 || op == 0x23 || op == 0x90 || op == 0x93 || op == 0xa1 || op == 0xa2 || op == 0xa8 || op == 0xa9: // DW_OP_constu, DW_OP_plus_uconst, DW_OP_regx, DW_OP_piece, DW_OP_addrx, DW_OP_constx, DW_OP_convert, DW_OP_reinterpret
+			b.uleb()
+		case op == 0x11 || op == 0x91 || (op >= 0x70 && op <= 0x8f): // DW_OP_consts, DW_OP_fbreg, DW_OP_breg0..31
+			b.sleb()
+		case op == 0x92: // DW_OP_bregx
+			b.uleb()
+			b.sleb()
+		case op == 0x9d || op == 0xa5: // DW_OP_bit_piece, DW_OP_regval_type
+			b.uleb()
+			b.uleb()
+		case op == 0x9e || op == 0xa3: // DW_OP_implicit_value, DW_OP_entry_value
+			b.bytes(int(b.uleb()))
+		case op == 0xa0: // DW_OP_implicit_pointer
+			b.bytes(4)
+			b.sleb()
+		case op == 0xa4: // DW_OP_const_type
+			b.uleb()
+			b.bytes(int(b.u8()))
+		case op == 0xa6 || op == 0xa7: // DW_OP_deref_type, DW_OP_xderef_type
+			b.bytes(1)
+			b.uleb()
+		case op == 0x06 || (op >= 0x12 && op <= 0x2e) || (op >= 0x30 && op <= 0x6f) || (op >= 0x96 && op <= 0x9f):
+			// operations without operands
+		default:
+			return fmt.Errorf("unknown DWARF operation %#x at offset %d", op, b.off-1)
+		}
+	}
+	if b.err != nil {
+		return errors.New("truncated DWARF expression")
+	}
+	return nil
+}
+
+// dbuf reads values out of a DWARF section.
+type dbuf struct {
+	data  []byte
+	off   int
+	order binary.ByteOrder
+	err   error
+}
+
+var errTruncated = errors.New("truncated data")
+
+func (b *dbuf) bytes(n int) []byte {
+	if b.err != nil || n < 0 || b.off < 0 || b.off+n > len(b.data) {
+		b.err = errTruncated
+		return nil
+	}
+	r := b.data[b.off : b.off+n]
+	b.off += n
+	return r
+}
+
+func (b *dbuf) u8() uint8 {
+	if x := b.bytes(1); x != nil {
+		return x[0]
+	}
+	return 0
+}
+
+func (b *dbuf) u16() uint16 {
+	if x := b.bytes(2); x != nil {
+		return b.order.Uint16(x)
+	}
+	return 0
+}
+
+func (b *dbuf) u32() uint32 {
+	if x := b.bytes(4); x != nil {
+		return b.order.Uint32(x)
+	}
+	return 0
+}
+
+func (b *dbuf) addr(size int) uint64 {
+	x := b.bytes(size)
+	switch {
+	case x == nil:
+		return 0
+	case size == 4:
+		return uint64(b.order.Uint32(x))
+	default:
+		return b.order.Uint64(x)
+	}
+}
+
+func (b *dbuf) uleb() uint64 {
+	var r uint64
+	var shift uint
+	for {
+		c := b.u8()
+		if b.err != nil {
+			return 0
+		}
+		r |= uint64(c&0x7f) << shift
+		shift += 7
+		if c&0x80 == 0 {
+			return r
+		}
+	}
+}
+
+func (b *dbuf) sleb() int64 {
+	var r int64
+	var shift uint
+	for {
+		c := b.u8()
+		if b.err != nil {
+			return 0
+		}
+		r |= int64(c&0x7f) << shift
+		shift += 7
+		if c&0x80 == 0 {
+			if shift < 64 && c&0x40 != 0 {
+				r |= -1 << shift
+			}
+			return r
+		}
+	}
+}
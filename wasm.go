@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// wasmFile is a WebAssembly module, its debug info is in custom sections
+// named like the ELF sections. The gc linker doesn't emit them, only other
+// toolchains, like TinyGo, do.
+type wasmFile struct {
+	sections map[string][]byte // custom sections by name
+}
+
+var wasmMagic = []byte("\x00asm\x01\x00\x00\x00")
+
+// openWasm reads the custom sections of the WebAssembly module at path.
+func openWasm(path string) (*wasmFile, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(buf, wasmMagic) {
+		return nil, fmt.Errorf("%s is not a WebAssembly module", path)
+	}
+	f := &wasmFile{sections: make(map[string][]byte)}
+	buf = buf[len(wasmMagic):]
+	for len(buf) > 0 {
+		id := buf[0]
+		size, n := binary.Uvarint(buf[1:])
+		if n <= 0 || size > uint64(len(buf)-1-n) {
+			return nil, fmt.Errorf("%s: malformed section", path)
+		}
+		data := buf[1+n : 1+n+int(size)]
+		buf = buf[1+n+int(size):]
+		if id != 0 {
+			continue
+		}
+		// custom sections start with their name
+		l, n := binary.Uvarint(data)
+		if n <= 0 || l > uint64(len(data)-n) {
+			return nil, fmt.Errorf("%s: malformed custom section", path)
+		}
+		f.sections[string(data[n:n+int(l)])] = data[n+int(l):]
+	}
+	return f, nil
+}
+
+func (f *wasmFile) DWARF() (*dwarf.Data, error) {
+	s := func(name string) []byte { return f.sections[".debug_"+name] }
+	if s("info") == nil {
+		if f.language("Go") {
+			return nil, errors.New("no DWARF custom sections in the WebAssembly module, the Go linker does not emit DWARF for wasm")
+		}
+		return nil, errors.New("no DWARF custom sections in the WebAssembly module")
+	}
+	dw, err := dwarf.New(s("abbrev"), s("aranges"), s("frame"), s("info"), s("line"), s("pubnames"), s("ranges"), s("str"))
+	if err != nil {
+		return nil, err
+	}
+	for name, data := range f.sections {
+		switch strings.TrimPrefix(name, ".debug_") {
+		case "addr", "line_str", "loclists", "rnglists", "str_offsets":
+			if err := dw.AddSection(name, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return dw, nil
+}
+
+func (f *wasmFile) Close() error { return nil }
+
+// language returns true if the producers section of f lists lang as a
+// source language of the module.
+func (f *wasmFile) language(lang string) bool {
+	buf := f.sections["producers"]
+	str := func() (string, bool) {
+		l, n := binary.Uvarint(buf)
+		if n <= 0 || l > uint64(len(buf)-n) {
+			return "", false
+		}
+		s := string(buf[n : n+int(l)])
+		buf = buf[n+int(l):]
+		return s, true
+	}
+	nfields, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return false
+	}
+	buf = buf[n:]
+	for ; nfields > 0; nfields-- {
+		field, ok := str()
+		if !ok {
+			return false
+		}
+		nvalues, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return false
+		}
+		buf = buf[n:]
+		for ; nvalues > 0; nvalues-- {
+			name, ok1 := str()
+			_, ok2 := str() // version
+			if !ok1 || !ok2 {
+				return false
+			}
+			if field == "language" && name == lang {
+				return true
+			}
+		}
+	}
+	return false
+}
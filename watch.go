@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// watchInterval is how often the watched files are polled.
+const watchInterval = 500 * time.Millisecond
+
+// watchMain checks ins every time their source files or the compiler and
+// linker of the go command change, until ctx is canceled. After the first
+// run only the findings that appeared or went away are printed.
+func watchMain(ctx context.Context, ins []input, gocmds [2]string) int {
+	tools := toolFiles(gocmds)
+	var prev map[string]Finding
+	for {
+		files := append([]string(nil), tools...)
+		cur := make(map[string]Finding)
+		failed := false
+		for i, ch := range checkInputs(ctx, ins, gocmds) {
+			out := <-ch
+			if prev == nil || out.failed {
+				os.Stdout.Write(out.Bytes())
+			}
+			failed = failed || out.failed
+			for _, f := range out.findings {
+				cur[watchKey(f)] = f
+			}
+			files = append(files, watchedFiles(ins[i])...)
+		}
+		if ctx.Err() != nil {
+			return exitClean
+		}
+
+		switch {
+		case prev == nil:
+			fmt.Printf("--- %s: %d findings\n", time.Now().Format(time.TimeOnly), len(cur))
+		case failed:
+			// the next run is compared with the last complete one
+			fmt.Printf("--- %s: some inputs could not be checked\n", time.Now().Format(time.TimeOnly))
+		default:
+			printFindingsDiff(prev, cur)
+		}
+		if !failed || prev == nil {
+			prev = cur
+		}
+
+		if !waitForChange(ctx, files) {
+			return exitClean
+		}
+	}
+}
+
+// watchKey identifies finding f across builds, where its address can change.
+func watchKey(f Finding) string {
+	e := newBaselineEntry(f)
+	return fmt.Sprintf("%s %s:%d %s %s %s %s", f.Rule, e.File, e.Line, e.Func, e.Instance, f.Target, f.Message)
+}
+
+// printFindingsDiff prints the findings of cur that aren't in prev,
+// prefixed by a +, and the ones of prev that aren't in cur, prefixed by a -.
+func printFindingsDiff(prev, cur map[string]Finding) {
+	type change struct {
+		key, text string
+	}
+	var changes []change
+	diff := func(a, b map[string]Finding, prefix string) int {
+		n := 0
+		for k, f := range a {
+			if _, ok := b[k]; ok {
+				continue
+			}
+			out := &output{}
+			out.report(f)
+			text := strings.TrimSuffix(out.String(), "\n")
+			changes = append(changes, change{k, prefix + strings.ReplaceAll(text, "\n", "\n"+prefix) + "\n"})
+			n++
+		}
+		return n
+	}
+	added := diff(cur, prev, "+")
+	removed := diff(prev, cur, "-")
+	sort.Slice(changes, func(i, j int) bool { return changes[i].key < changes[j].key })
+	fmt.Printf("--- %s: %d findings, %d new, %d fixed\n", time.Now().Format(time.TimeOnly), len(cur), added, removed)
+	for _, c := range changes {
+		fmt.Print(c.text)
+	}
+}
+
+// watchedFiles returns the source files of input in and the directories
+// containing them, so that added files are noticed.
+func watchedFiles(in input) []string {
+	pkgs, err := sourceFiles(in)
+	if err != nil {
+		return nil
+	}
+	var r []string
+	dirs := make(map[string]bool)
+	for _, pkg := range pkgs {
+		for _, file := range append(pkg.files, pkg.asmFiles...) {
+			r = append(r, file)
+			dirs[filepath.Dir(file)] = true
+		}
+	}
+	for dir := range dirs {
+		r = append(r, dir)
+	}
+	return r
+}
+
+// toolFiles returns the compiler and the linker of the go commands used,
+// so that installing a patched toolchain triggers a new run.
+func toolFiles(gocmds [2]string) []string {
+	cmds := gocmds[:]
+	if compare == "" {
+		cmds = []string{goCommand}
+	}
+	var r []string
+	for _, gocmd := range cmds {
+		out, err := goCmd(context.Background(), gocmd, nil, "env", "GOTOOLDIR").Output()
+		if err != nil {
+			continue
+		}
+		dir := strings.TrimSpace(string(out))
+		r = append(r, filepath.Join(dir, "compile"+exeSuffix()), filepath.Join(dir, "link"+exeSuffix()))
+	}
+	return r
+}
+
+// waitForChange waits until the modification time or the size of one of
+// files changes, or a missing one appears. It returns false if ctx is
+// canceled first.
+func waitForChange(ctx context.Context, files []string) bool {
+	type stat struct {
+		mtime time.Time
+		size  int64
+	}
+	statAll := func() map[string]stat {
+		r := make(map[string]stat)
+		for _, file := range files {
+			if fi, err := os.Stat(file); err == nil {
+				r[file] = stat{fi.ModTime(), fi.Size()}
+			}
+		}
+		return r
+	}
+	old := statAll()
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+		cur := statAll()
+		if len(cur) != len(old) {
+			return true
+		}
+		for file, s := range cur {
+			if old[file] != s {
+				return true
+			}
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// wrapperRange is a function generated by the compiler, wrapping fn.
+type wrapperRange struct {
+	FuncRange
+	fn       *Func  // wrapped function, nil for wrappers of types
+	declOnly bool   // the wrapper can only point at the declaration of fn
+	kind     string // "go" or "defer" for the wrappers of go and defer statements
+	n        int    // number of the go or defer wrapper inside fn
+}
+
+// checkWrappers checks that the line entries of the wrappers generated by
+// the compiler for package pkgpath are either autogenerated or point at
+// the entity they wrap: method values, pointer receiver wrappers and
+// instantiations with concrete types at the declaration of the function.
+// The wrappers of go and defer statements are checked by
+// checkGoDeferWrappers.
+func checkWrappers(dw *dwarf.Data, pkgpath string, funcs map[string]*Func) []Finding {
+	var r []Finding
+	forEachWrapperLineEntry(dw, getWrapperRanges(dw, pkgpath, funcs), false, func(w *wrapperRange, lne *dwarf.LineEntry) {
+		f := Finding{
+			Check:  "wrapper",
+			Rule:   "WRAPPER_IN_USER_CODE",
+			File:   lne.File.Name,
+			Line:   lne.Line,
+			PC:     lne.Address,
+			Func:   w.Name,
+			IsStmt: lne.IsStmt,
+		}
+		switch {
+		case w.fn == nil:
+			f.Message = "wrapper of a type points into user code"
+		case w.declOnly && lne.Line != w.fn.startLine:
+			f.Message = fmt.Sprintf("not at the declaration of %s", w.fn.Name)
+		case !w.declOnly && !w.fn.contains(lne.File.Name, lne.Line):
+			f.Message = fmt.Sprintf("outside of %s", w.fn.Name)
+		default:
+			return
+		}
+		if w.fn != nil {
+			f.StartLine, f.EndLine = w.fn.startLine, w.fn.endLine
+		}
+		r = append(r, f)
+	})
+	return r
+}
+
+// checkGoDeferWrappers checks that the line entries of the wrappers of go
+// and defer statements point at the statement. The statements that get a
+// wrapper, which is numbered in order of appearance inside the function,
+// are guessed from the source; if the guess doesn't match the number of
+// wrappers any go or defer statement of the function is accepted.
+func checkGoDeferWrappers(dw *dwarf.Data, pkgpath string, funcs map[string]*Func) []Finding {
+	wrappers := getWrapperRanges(dw, pkgpath, funcs)
+	nwrappers := make(map[*Func]int)
+	for _, w := range wrappers {
+		if w.kind != "" && w.fn != nil {
+			nwrappers[w.fn] = max(nwrappers[w.fn], w.n)
+		}
+	}
+
+	var r []Finding
+	forEachWrapperLineEntry(dw, wrappers, true, func(w *wrapperRange, lne *dwarf.LineEntry) {
+		if w.fn == nil {
+			return
+		}
+		f := Finding{
+			Check:     "go-defer-wrapper",
+			Rule:      "GO_DEFER_WRAPPER_MISPLACED",
+			File:      lne.File.Name,
+			Line:      lne.Line,
+			PC:        lne.Address,
+			Func:      w.Name,
+			StartLine: w.fn.startLine,
+			EndLine:   w.fn.endLine,
+			IsStmt:    lne.IsStmt,
+		}
+
+		var wrapped []goDeferStmt
+		for _, stmt := range w.fn.goDefers {
+			if stmt.wrapped {
+				wrapped = append(wrapped, stmt)
+			}
+		}
+		if len(wrapped) == nwrappers[w.fn] && w.n <= len(wrapped) && wrapped[w.n-1].kind == w.kind {
+			stmt := wrapped[w.n-1]
+			if sameFile(lne.File.Name, w.fn.file) && lne.Line >= stmt.start && lne.Line <= stmt.end {
+				return
+			}
+			f.StartLine, f.EndLine = stmt.start, stmt.end
+			f.Message = fmt.Sprintf("not at the %s statement at line %d", w.kind, stmt.start)
+			r = append(r, f)
+			return
+		}
+
+		for _, stmt := range w.fn.goDefers {
+			if stmt.kind == w.kind && sameFile(lne.File.Name, w.fn.file) && lne.Line >= stmt.start && lne.Line <= stmt.end {
+				return
+			}
+		}
+		f.Message = fmt.Sprintf("not at a %s statement of %s", w.kind, w.fn.Name)
+		r = append(r, f)
+	})
+	return r
+}
+
+// forEachWrapperLineEntry calls fn for the line entries of wrappers that
+// point into user code, only for the wrappers of go and defer statements
+// if goDefer is set and only for the others otherwise.
+func forEachWrapperLineEntry(dw *dwarf.Data, wrappers []wrapperRange, goDefer bool, fn func(*wrapperRange, *dwarf.LineEntry)) {
+	var idx funcIndex
+	byRange := make(map[*FuncRange]*wrapperRange)
+	for i := range wrappers {
+		if (wrappers[i].kind != "") != goDefer {
+			continue
+		}
+		for _, rng := range wrappers[i].Rngs {
+			idx = append(idx, funcIndexEntry{rng, &wrappers[i].FuncRange})
+		}
+		byRange[&wrappers[i].FuncRange] = &wrappers[i]
+	}
+	sort.Slice(idx, func(i, j int) bool { return idx[i].rng[0] < idx[j].rng[0] })
+
+	if len(idx) == 0 {
+		return
+	}
+	err := forEachCULineEntry(dw, wrappers[0].CU, func(lne *dwarf.LineEntry) {
+		if lne.EndSequence || lne.Line == 0 || lne.File == nil || lne.File.Name == "<autogenerated>" {
+			return
+		}
+		fr := getFunc(lne.Address, idx)
+		if fr == nil || fr.inlinedAt(lne.Address) != nil {
+			return
+		}
+		fn(byRange[fr], lne)
+	})
+	mustDecode(err)
+}
+
+// getWrapperRanges returns the address ranges of the wrappers in the
+// compile unit of package pkgpath.
+func getWrapperRanges(dw *dwarf.Data, pkgpath string, funcs map[string]*Func) []wrapperRange {
+	cu := compileUnit(dw, pkgpath)
+	if cu == nil {
+		return nil
+	}
+
+	var r []wrapperRange
+
+	rdr := dw.Reader()
+	rdr.Seek(cu.Offset)
+	rdr.Next()
+	cur := -1
+	for {
+		e, err := rdr.Next()
+		mustDecode(err)
+		if e == nil || e.Tag == dwarf.TagCompileUnit {
+			break
+		}
+		switch e.Tag {
+		case dwarf.TagSubprogram:
+			cur = -1
+			name, ok := entryName(dw, e)
+			if !ok {
+				break
+			}
+			fn, declOnly, ok := wrappedFunc(name, funcs)
+			if !ok {
+				break
+			}
+			rngs, err := dw.Ranges(e)
+			mustDecode(err)
+			if len(rngs) == 0 {
+				break
+			}
+			_, kind, n, _ := goDeferWrapper(name)
+			r = append(r, wrapperRange{FuncRange{Rngs: rngs, Name: name, Offset: e.Offset, CU: cu}, fn, declOnly, kind, n})
+			cur = len(r) - 1
+		case dwarf.TagInlinedSubroutine:
+			// inlined code belongs to the inlined function
+			if cur >= 0 {
+				rngs, err := dw.Ranges(e)
+				mustDecode(err)
+				r[cur].Inlined = append(r[cur].Inlined, InlinedCall{Rngs: rngs, Depth: 1})
+			}
+		}
+	}
+	return r
+}
+
+// wrappedFunc returns the function wrapped by the compiler generated
+// function name and whether the wrapper should only refer to its
+// declaration. The last return value is false if name isn't a wrapper.
+func wrappedFunc(name string, funcs map[string]*Func) (fn *Func, declOnly, ok bool) {
+	if strings.HasPrefix(name, "type:.") || strings.HasPrefix(name, "type..") {
+		// equality and hash functions
+		return nil, false, true
+	}
+
+	if base, isMethodValue := strings.CutSuffix(name, "-fm"); isMethodValue {
+		base = withoutTypeParams(base)
+		if fn := funcs[base]; fn != nil {
+			return fn, true, true
+		}
+		return funcs[valueReceiver(base)], true, true
+	}
+
+	if outer, _, _, ok := goDeferWrapper(name); ok {
+		return funcs[withoutTypeParams(outer)], false, true
+	}
+
+	base := withoutTypeParams(name)
+	if isInstantiationWrapper(name) {
+		// wrappers of generic types of other packages, like
+		// sync/atomic.Pointer, are emitted in the packages using them
+		fn := funcs[base]
+		return fn, true, fn != nil
+	}
+
+	// methods with a value receiver called through a pointer
+	if funcs[base] == nil && base != valueReceiver(base) {
+		if fn := funcs[valueReceiver(base)]; fn != nil {
+			return fn, true, true
+		}
+	}
+
+	return nil, false, false
+}
+
+// goDeferWrapper splits the name of the wrapper of a go or defer statement,
+// outer.gowrapN or outer.deferwrapN, into the name of the function
+// containing the statement, the kind of statement and N.
+func goDeferWrapper(name string) (outer, kind string, n int, ok bool) {
+	for _, kind := range []string{"defer", "go"} {
+		i := strings.LastIndex(name, "."+kind+"wrap")
+		if i < 0 {
+			continue
+		}
+		n, err := strconv.Atoi(name[i+len(kind)+5:])
+		if err != nil {
+			continue
+		}
+		return name[:i], kind, n, true
+	}
+	return "", "", 0, false
+}
+
+// valueReceiver turns pkg.(*T).M into pkg.T.M.
+func valueReceiver(name string) string {
+	i := strings.Index(name, ".(*")
+	if i < 0 {
+		return name
+	}
+	j := strings.Index(name[i:], ").")
+	if j < 0 {
+		return name
+	}
+	return name[:i+1] + name[i+3:i+j] + name[i+j+1:]
+}